@@ -0,0 +1,60 @@
+package envoy
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/pivotal-cf-experimental/envoy/domain"
+)
+
+// AuditLogger defines the interface for an audit trail of the mutating
+// operations performed by the service broker. Audit is called before and
+// after each provision, update, bind, unbind and deprovision request. When
+// it returns an error before a request, the request is rejected.
+type AuditLogger interface {
+	Audit(domain.AuditRecord) error
+}
+
+// FileAuditLogger is an AuditLogger that appends each record to a file as
+// a line of JSON.
+type FileAuditLogger struct {
+	mutex sync.Mutex
+	file  *os.File
+}
+
+// NewFileAuditLogger returns a FileAuditLogger that appends to the file at
+// the given path, creating it if it does not exist.
+func NewFileAuditLogger(path string) (*FileAuditLogger, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileAuditLogger{
+		file: file,
+	}, nil
+}
+
+// Audit writes the record to the file, and waits for it to be flushed to
+// disk before returning.
+func (l *FileAuditLogger) Audit(record domain.AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+
+	return l.file.Sync()
+}
+
+// Close closes the underlying file.
+func (l *FileAuditLogger) Close() error {
+	return l.file.Close()
+}
@@ -0,0 +1,62 @@
+package envoy_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pivotal-cf-experimental/envoy"
+	"github.com/pivotal-cf-experimental/envoy/domain"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FileAuditLogger", func() {
+	var directory string
+	var path string
+
+	BeforeEach(func() {
+		var err error
+		directory, err = ioutil.TempDir("", "envoy-audit")
+		Expect(err).NotTo(HaveOccurred())
+		path = filepath.Join(directory, "audit.log")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(directory)
+	})
+
+	It("appends each record to the file as a line of JSON", func() {
+		logger, err := envoy.NewFileAuditLogger(path)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(logger.Audit(domain.AuditRecord{Phase: domain.AuditPhaseBefore, Operation: "bind"})).To(Succeed())
+		Expect(logger.Audit(domain.AuditRecord{Phase: domain.AuditPhaseAfter, Operation: "bind", Status: 201})).To(Succeed())
+		Expect(logger.Close()).To(Succeed())
+
+		file, err := os.Open(path)
+		Expect(err).NotTo(HaveOccurred())
+		defer file.Close()
+
+		var records []domain.AuditRecord
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			var record domain.AuditRecord
+			Expect(json.Unmarshal(scanner.Bytes(), &record)).To(Succeed())
+			records = append(records, record)
+		}
+
+		Expect(records).To(HaveLen(2))
+		Expect(records[0].Phase).To(Equal(domain.AuditPhaseBefore))
+		Expect(records[1].Phase).To(Equal(domain.AuditPhaseAfter))
+		Expect(records[1].Status).To(Equal(201))
+	})
+
+	It("returns an error when the file cannot be opened", func() {
+		_, err := envoy.NewFileAuditLogger(filepath.Join(directory, "missing", "audit.log"))
+		Expect(err).To(HaveOccurred())
+	})
+})
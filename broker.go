@@ -33,7 +33,7 @@ type Provisioner interface {
 
 // Deprovisioner defines the interface for a request to deprovision a service.
 type Deprovisioner interface {
-	Deprovision(domain.DeprovisionRequest) error
+	Deprovision(domain.DeprovisionRequest) (domain.DeprovisionResponse, error)
 }
 
 // Binder defines the interface for a request to bind a service.
@@ -45,3 +45,55 @@ type Binder interface {
 type Unbinder interface {
 	Unbind(domain.UnbindRequest) error
 }
+
+// ServiceInstanceDetailer defines the interface for a request to fetch a
+// service instance. It is optional; when the Broker also implements it,
+// the broker handler serves GET requests for service instances.
+type ServiceInstanceDetailer interface {
+	ServiceInstanceDetails(domain.ServiceInstanceDetailsRequest) (domain.ServiceInstanceDetails, error)
+}
+
+// Updater defines the interface for a request to update a service. It is
+// optional; when the Broker also implements it, the broker handler serves
+// PATCH requests for service instances.
+type Updater interface {
+	Update(domain.UpdateRequest) (domain.UpdateResponse, error)
+}
+
+// UpdateValidator defines the interface for checking whether a service
+// instance may change from one plan to another, such as to forbid
+// downgrades. It is optional; when the Broker also implements it, update
+// requests for a forbidden plan change are rejected with a 422
+// Unprocessable Entity before they reach the Updater.
+type UpdateValidator interface {
+	ValidateTransition(from, to string) error
+}
+
+// LastOperationer defines the interface for a request to poll the state of
+// an asynchronous operation. It is optional; when the Broker also implements
+// it, the broker handler serves GET requests for the last operation on
+// service instances.
+//
+// The broker should return a domain.OperationNotFoundError when the
+// operation being polled is not known to it, which is reported to the
+// client as a 404 Not Found, or as a failed operation when the handler
+// is configured with WithUnknownOperationsFailed.
+type LastOperationer interface {
+	LastOperation(domain.LastOperationRequest) (domain.LastOperationResponse, error)
+}
+
+// CredentialTransformer defines the interface for a hook that transforms
+// binding credentials before they are returned to the platform, such as by
+// encrypting sensitive values that the platform will decrypt.
+type CredentialTransformer interface {
+	TransformCredentials(domain.BindingCredentials) (domain.BindingCredentials, error)
+}
+
+// CatalogTransformer defines the interface for a hook that post-processes
+// the catalog each time it is served, such as by injecting plan metadata
+// that depends on the environment. The transformer is given a copy of the
+// services and plans, so the catalog held by the broker is not modified,
+// but nested slices and maps should be replaced rather than changed.
+type CatalogTransformer interface {
+	TransformCatalog(domain.Catalog) domain.Catalog
+}
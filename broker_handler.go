@@ -1,36 +1,318 @@
 package envoy
 
 import (
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
 	"strings"
 
 	"github.com/gorilla/mux"
+	"github.com/pivotal-cf-experimental/envoy/domain"
 	"github.com/pivotal-cf-experimental/envoy/internal/handlers"
 	"github.com/pivotal-cf-experimental/envoy/internal/middleware"
 )
 
 // NewBrokerHandler returns an http.Handler that can be bound used to
-// serve HTTP requests for the CloudFoundry service broker API.
-func NewBrokerHandler(broker Broker) http.Handler {
+// serve HTTP requests for the CloudFoundry service broker API. An error
+// is returned if the catalog provided by the broker is not valid, or
+// declares updateable plans that the broker cannot update, so that a
+// misconfigured broker fails when it starts rather than on its first
+// request.
+func NewBrokerHandler(broker Broker, options ...Option) (http.Handler, error) {
+	config := newConfig(options)
+
+	if err := broker.Catalog().Validate(); err != nil {
+		return nil, err
+	}
+
+	if config.schemaSizeLimit > 0 {
+		if err := broker.Catalog().ValidateSchemaSizes(config.schemaSizeLimit); err != nil {
+			return nil, err
+		}
+	}
+
+	var trustedProxies []*net.IPNet
+	for _, cidr := range config.trustedProxies {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy: %s", err)
+		}
+		trustedProxies = append(trustedProxies, network)
+	}
+
+	if _, ok := broker.(Updater); !ok {
+		for _, service := range broker.Catalog().Services {
+			if service.HasUpdateablePlans() {
+				return nil, domain.InvalidCatalogError(fmt.Sprintf("service %q has updateable plans, but the broker does not implement Updater", service.ID))
+			}
+		}
+	}
+
 	catalogHandler := handlers.NewCatalogHandler(broker)
+	if config.catalogTTL > 0 {
+		cache := handlers.NewCatalogCache(broker, config.catalogTTL)
+		if config.metrics != nil {
+			cache.Metrics = config.metrics
+		}
+		catalogHandler = handlers.NewCatalogHandler(cache)
+	}
+	catalogHandler.Transformer = config.catalogTransformer
+	catalogHandler.Logger = config.logger
+
 	provisionHandler := handlers.NewProvisionHandler(broker)
+	provisionHandler.BodyReadTimeout = config.bodyReadTimeout
+	provisionHandler.IncludeSyncOperation = config.syncOperation
+	provisionHandler.Logger = config.logger
+	provisionHandler.Cataloger = broker
+	provisionHandler.RejectUnknownPlans = config.rejectUnknownPlans
+	provisionHandler.AllowMissingSpace = config.allowMissingSpace
+	provisionHandler.DefaultPlanID = config.defaultPlanID
+	provisionHandler.WarnUnrecognizedParameters = config.warnParameters
+
 	bindHandler := handlers.NewBindHandler(broker)
+	bindHandler.BodyReadTimeout = config.bodyReadTimeout
+	bindHandler.Logger = config.logger
+	bindHandler.Cataloger = broker
+	bindHandler.StripUndeclaredSyslogDrain = config.stripSyslogDrain
+	bindHandler.CredentialTransformer = config.transformer
+	bindHandler.WarnUnrecognizedParameters = config.warnParameters
+	bindHandler.WarnSameIDs = config.warnSameIDs
+
 	unbindHandler := handlers.NewUnbindHandler(broker)
+	unbindHandler.Logger = config.logger
+	unbindHandler.MissingInstanceNotFound = config.unbindNotFound
+	unbindHandler.WarnSameIDs = config.warnSameIDs
+
 	deprovisionHandler := handlers.NewDeprovisionHandler(broker)
+	deprovisionHandler.BodyReadTimeout = config.bodyReadTimeout
+	deprovisionHandler.Logger = config.logger
+	deprovisionHandler.Cataloger = broker
+	if config.checkDeprovisions {
+		detailer, ok := broker.(ServiceInstanceDetailer)
+		if !ok {
+			return nil, errors.New("validating deprovision requests requires a broker that implements ServiceInstanceDetailer")
+		}
+		deprovisionHandler.Instances = detailer
+	}
+
+	provisionRequests := handlers.NewProvisionRequests()
+	if config.debugProvisions {
+		provisionHandler.Requests = provisionRequests
+		deprovisionHandler.Requests = provisionRequests
+	}
+
+	signer := handlers.NewOperationSigner(config.operationSigningKey)
+	if config.signOperations {
+		if len(config.operationSigningKey) == 0 {
+			return nil, errors.New("operation signing key must not be empty")
+		}
+
+		provisionHandler.Signer = signer
+		bindHandler.Signer = signer
+		deprovisionHandler.Signer = signer
+	}
+
+	if config.guardOperations && config.operationStore == nil {
+		return nil, errors.New("guarding concurrent operations requires an operation store")
+	}
+
+	if config.retryLogWindow > 0 && config.logger == nil {
+		return nil, errors.New("logging retries requires a Logger")
+	}
+
+	// The replay guard and the retry logger share one store of the request
+	// identities they have seen, kept for as long as either needs.
+	identityRetention := config.replayWindow
+	if config.retryLogWindow > identityRetention {
+		identityRetention = config.retryLogWindow
+	}
+	identities := middleware.NewIdentityStore(identityRetention)
+
+	mutating := func(operation string, handler http.Handler) http.Handler {
+		if config.guardOperations && operation != "provision" {
+			handler = middleware.NewConcurrencyGuard(handler, config.operationStore)
+		}
+
+		// Retries are answered before the concurrency guard, so that a
+		// retry of the request that started an operation gets its original
+		// response rather than being rejected because of that operation.
+		if config.idempotencyStore != nil {
+			handler = middleware.NewIdempotency(handler, config.idempotencyStore)
+		}
+
+		if config.replayWindow > 0 {
+			handler = middleware.NewReplayGuard(handler, identities, config.replayWindow)
+		}
+
+		if config.auditLogger == nil {
+			return handler
+		}
+
+		return middleware.NewAuditor(handler, operation, config.auditLogger)
+	}
+
+	serviceCredentialers := map[string][]middleware.Credentialer{}
+	for serviceID, credentialers := range config.serviceCredentialers {
+		for _, credentialer := range credentialers {
+			serviceCredentialers[serviceID] = append(serviceCredentialers[serviceID], credentialer)
+		}
+	}
+
+	var brokerCredentialer middleware.Credentialer = broker
+	if config.credentialsProvider != nil {
+		brokerCredentialer = middleware.ProvidedCredentials(config.credentialsProvider)
+	}
+
+	authenticate := func(handler http.Handler, credentialers ...middleware.Credentialer) http.Handler {
+		return middleware.NewServiceAuthenticator(handler, serviceCredentialers, config.bodyReadTimeout, credentialers...)
+	}
+
+	// Endpoints that do not concern a single service, such as the catalog,
+	// are only ever authenticated with the broker's own credentials.
+	authenticateBroker := func(handler http.Handler, credentialers ...middleware.Credentialer) http.Handler {
+		return middleware.NewAuthenticator(handler, credentialers...)
+	}
+
+	readCredentialers := []middleware.Credentialer{brokerCredentialer}
+	if config.readOnlyCredentialer != nil {
+		readCredentialers = append(readCredentialers, config.readOnlyCredentialer)
+	}
 
 	routes := map[string]http.Handler{
-		"GET /v2/catalog":                                                          middleware.NewAuthenticator(catalogHandler, broker),
-		"PUT /v2/service_instances/{instance_id}":                                  middleware.NewAuthenticator(provisionHandler, broker),
-		"PUT /v2/service_instances/{instance_id}/service_bindings/{binding_id}":    middleware.NewAuthenticator(bindHandler, broker),
-		"DELETE /v2/service_instances/{instance_id}/service_bindings/{binding_id}": middleware.NewAuthenticator(unbindHandler, broker),
-		"DELETE /v2/service_instances/{instance_id}":                               middleware.NewAuthenticator(deprovisionHandler, broker),
+		"GET /v2/catalog":                                                          authenticateBroker(catalogHandler, readCredentialers...),
+		"PUT /v2/service_instances/{instance_id}":                                  authenticate(mutating("provision", provisionHandler), brokerCredentialer),
+		"PUT /v2/service_instances/{instance_id}/service_bindings/{binding_id}":    authenticate(mutating("bind", bindHandler), brokerCredentialer),
+		"DELETE /v2/service_instances/{instance_id}/service_bindings/{binding_id}": authenticate(mutating("unbind", unbindHandler), brokerCredentialer),
+		"DELETE /v2/service_instances/{instance_id}":                               authenticate(mutating("deprovision", deprovisionHandler), brokerCredentialer),
+	}
+
+	if config.debugProvisions {
+		routes["GET /debug/service_instances/{instance_id}/provision_request"] = authenticateBroker(handlers.NewProvisionRequestHandler(provisionRequests), brokerCredentialer)
+	}
+
+	exchanges := handlers.NewRecordedExchanges(config.recordedExchanges)
+	if config.recordedExchanges > 0 {
+		routes["GET /debug/exchanges"] = authenticateBroker(handlers.NewRecordedExchangesHandler(exchanges), brokerCredentialer)
+	}
+
+	if detailer, ok := broker.(ServiceInstanceDetailer); ok {
+		detailsHandler := handlers.NewServiceInstanceDetailsHandler(detailer)
+		detailsHandler.Logger = config.logger
+		detailsHandler.DescribeNotFound = config.describeNotFound
+
+		routes["GET /v2/service_instances/{instance_id}"] = authenticateBroker(detailsHandler, readCredentialers...)
+	}
+
+	if updater, ok := broker.(Updater); ok {
+		updateHandler := handlers.NewUpdateHandler(updater)
+		updateHandler.BodyReadTimeout = config.bodyReadTimeout
+		updateHandler.Logger = config.logger
+		updateHandler.Cataloger = broker
+		updateHandler.WarnUnrecognizedParameters = config.warnParameters
+		if config.signOperations {
+			updateHandler.Signer = signer
+		}
+		if validator, ok := broker.(UpdateValidator); ok {
+			updateHandler.Validator = validator
+		}
+
+		routes["PATCH /v2/service_instances/{instance_id}"] = authenticate(mutating("update", updateHandler), brokerCredentialer)
+	}
+
+	if lastOperationer, ok := broker.(LastOperationer); ok {
+		lastOperationHandler := handlers.NewLastOperationHandler(lastOperationer)
+		lastOperationHandler.Logger = config.logger
+		if config.operationStore != nil {
+			lastOperationHandler.Operations = config.operationStore
+		}
+		if config.signOperations {
+			lastOperationHandler.Verifier = signer
+		}
+		lastOperationHandler.FailUnknownOperations = config.failUnknownOps
+
+		routes["GET /v2/service_instances/{instance_id}/last_operation"] = authenticate(lastOperationHandler, readCredentialers...)
 	}
 
 	router := mux.NewRouter()
+	router.NotFoundHandler = handlers.NotFoundHandler{}
 	for endpoint, handler := range routes {
 		parts := strings.Split(endpoint, " ")
 		router.Handle(parts[1], handler).Methods(parts[0])
 	}
 
-	return router
+	var handler http.Handler = router
+	if config.recordedExchanges > 0 {
+		handler = middleware.NewBodyRecorder(handler, exchanges)
+	}
+
+	if config.recoverPanics {
+		handler = middleware.NewRecoverer(handler, config.logger)
+	}
+
+	if config.validateIdentity {
+		handler = middleware.NewOriginatingIdentity(handler, config.strictIdentity)
+	}
+
+	if config.minimumAPIVersion != "" || config.maximumAPIVersion != "" {
+		handler = middleware.NewAPIVersion(handler, config.minimumAPIVersion, config.maximumAPIVersion)
+	}
+
+	if len(config.corsOrigins) > 0 {
+		policy := middleware.CORSPolicy{
+			Paths:          []string{"/v2/catalog"},
+			AllowedOrigins: config.corsOrigins,
+			AllowedMethods: config.corsMethods,
+			AllowedHeaders: config.corsHeaders,
+		}
+		if len(policy.AllowedMethods) == 0 {
+			policy.AllowedMethods = []string{"GET"}
+		}
+		if len(policy.AllowedHeaders) == 0 {
+			policy.AllowedHeaders = []string{"Authorization", "X-Broker-API-Version"}
+		}
+
+		handler = middleware.NewCORS(handler, policy)
+	}
+
+	if config.requireHTTPS {
+		handler = middleware.NewHTTPSEnforcer(handler, config.trustForwardedProto)
+	}
+
+	if config.messageAlias {
+		handler = middleware.NewMessageAlias(handler)
+	}
+
+	if config.compress {
+		var encodings []middleware.Encoding
+		for _, encoder := range config.encoders {
+			encodings = append(encodings, middleware.Encoding{
+				Name:    encoder.name,
+				Encoder: encoder.newEncoder,
+			})
+		}
+
+		handler = middleware.NewCompressor(handler, append(encodings, middleware.GzipEncoding)...)
+	}
+
+	if config.accessLog != nil {
+		var logger middleware.Logger
+		if config.logger != nil && !config.accessLogOnly {
+			logger = config.logger
+		}
+
+		handler = middleware.NewAccessLogger(handler, logger, config.accessLog, trustedProxies...)
+	} else if config.logger != nil {
+		handler = middleware.NewRequestLogger(handler, config.logger, trustedProxies...)
+	}
+
+	if config.requestIdentity {
+		handler = middleware.NewRequestIdentity(handler)
+	}
+
+	if config.retryLogWindow > 0 {
+		handler = middleware.NewRetryLogger(handler, config.logger, identities, config.retryLogWindow)
+	}
+
+	return handler, nil
 }
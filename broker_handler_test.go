@@ -1,7 +1,15 @@
 package envoy_test
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/pivotal-cf-experimental/envoy"
@@ -13,7 +21,11 @@ import (
 	. "github.com/onsi/gomega"
 )
 
-type TestBroker struct{}
+type TestBroker struct {
+	TestCatalog           domain.Catalog
+	TestProvisionResponse domain.ProvisionResponse
+	ProvisionCallCount    int
+}
 
 func NewTestBroker() *TestBroker {
 	return &TestBroker{}
@@ -24,7 +36,12 @@ func (broker TestBroker) Credentials() (string, string) {
 }
 
 func (broker *TestBroker) Provision(instance domain.ProvisionRequest) (domain.ProvisionResponse, error) {
-	return domain.ProvisionResponse{}, nil
+	if instance.InstanceID == "panic" {
+		panic("provisioning failed catastrophically")
+	}
+
+	broker.ProvisionCallCount++
+	return broker.TestProvisionResponse, nil
 }
 
 func (broker *TestBroker) Bind(binding domain.BindRequest) (domain.BindResponse, error) {
@@ -35,12 +52,164 @@ func (broker *TestBroker) Unbind(unbinding domain.UnbindRequest) error {
 	return nil
 }
 
-func (broker *TestBroker) Deprovision(deprovision domain.DeprovisionRequest) error {
-	return nil
+func (broker *TestBroker) Deprovision(deprovision domain.DeprovisionRequest) (domain.DeprovisionResponse, error) {
+	return domain.DeprovisionResponse{}, nil
 }
 
 func (b TestBroker) Catalog() domain.Catalog {
-	return domain.Catalog{}
+	return b.TestCatalog
+}
+
+type TestDetailerBroker struct {
+	TestBroker
+}
+
+func (b *TestDetailerBroker) ServiceInstanceDetails(request domain.ServiceInstanceDetailsRequest) (domain.ServiceInstanceDetails, error) {
+	return domain.ServiceInstanceDetails{}, nil
+}
+
+type TestUpdaterBroker struct {
+	TestBroker
+}
+
+func (b *TestUpdaterBroker) Update(request domain.UpdateRequest) (domain.UpdateResponse, error) {
+	return domain.UpdateResponse{}, nil
+}
+
+type TestLastOperationBroker struct {
+	TestBroker
+}
+
+func (b *TestLastOperationBroker) LastOperation(request domain.LastOperationRequest) (domain.LastOperationResponse, error) {
+	return domain.LastOperationResponse{}, nil
+}
+
+// TestLostOperationBroker does not recognize any operation it is polled
+// for, as though it had lost its state.
+type TestLostOperationBroker struct {
+	TestBroker
+}
+
+func (b *TestLostOperationBroker) LastOperation(request domain.LastOperationRequest) (domain.LastOperationResponse, error) {
+	return domain.LastOperationResponse{}, domain.OperationNotFoundError("unknown operation")
+}
+
+// TestInMemoryBroker keeps the service instances it provisions in memory,
+// so that they can be fetched and updated.
+type TestInMemoryBroker struct {
+	TestBroker
+	Instances map[string]domain.ServiceInstanceDetails
+}
+
+func NewTestInMemoryBroker() *TestInMemoryBroker {
+	return &TestInMemoryBroker{
+		Instances: map[string]domain.ServiceInstanceDetails{},
+	}
+}
+
+func (b *TestInMemoryBroker) Provision(request domain.ProvisionRequest) (domain.ProvisionResponse, error) {
+	b.Instances[request.InstanceID] = domain.ServiceInstanceDetails{
+		ServiceID: request.ServiceID,
+		PlanID:    request.PlanID,
+	}
+
+	return domain.ProvisionResponse{}, nil
+}
+
+func (b *TestInMemoryBroker) Update(request domain.UpdateRequest) (domain.UpdateResponse, error) {
+	instance, ok := b.Instances[request.InstanceID]
+	if !ok {
+		return domain.UpdateResponse{}, domain.ServiceInstanceNotFoundError("")
+	}
+
+	if request.PlanID != "" {
+		instance.PlanID = request.PlanID
+	}
+	b.Instances[request.InstanceID] = instance
+
+	return domain.UpdateResponse{}, nil
+}
+
+func (b *TestInMemoryBroker) ServiceInstanceDetails(request domain.ServiceInstanceDetailsRequest) (domain.ServiceInstanceDetails, error) {
+	instance, ok := b.Instances[request.InstanceID]
+	if !ok {
+		return domain.ServiceInstanceDetails{}, domain.ServiceInstanceNotFoundError("")
+	}
+
+	return instance, nil
+}
+
+// TestAsyncUpdateBroker updates service instances asynchronously, and
+// reports the operations it is polled for as in progress.
+type TestAsyncUpdateBroker struct {
+	TestBroker
+	PolledWith domain.LastOperationRequest
+}
+
+func (b *TestAsyncUpdateBroker) Update(request domain.UpdateRequest) (domain.UpdateResponse, error) {
+	if !request.AcceptsIncomplete {
+		return domain.UpdateResponse{}, domain.AsyncRequiredError("this broker only updates asynchronously")
+	}
+
+	return domain.UpdateResponse{IsAsync: true, OperationData: "update-" + request.PlanID}, nil
+}
+
+func (b *TestAsyncUpdateBroker) LastOperation(request domain.LastOperationRequest) (domain.LastOperationResponse, error) {
+	b.PolledWith = request
+	return domain.LastOperationResponse{State: domain.LastOperationInProgress, Description: "resizing"}, nil
+}
+
+type TestMetrics map[string]int
+
+func (m TestMetrics) IncrementCounter(name string) {
+	m[name]++
+}
+
+type TestCatalogTransformer struct{}
+
+func (t TestCatalogTransformer) TransformCatalog(catalog domain.Catalog) domain.Catalog {
+	for i := range catalog.Services {
+		catalog.Services[i].Tags = append(catalog.Services[i].Tags, "transformed")
+	}
+
+	return catalog
+}
+
+type TestCredentialer struct{}
+
+func (c TestCredentialer) Credentials() (string, string) {
+	return "reader", "read-only"
+}
+
+type TestCredentialsProvider struct {
+	Username string
+	Password string
+	Error    error
+}
+
+func (p *TestCredentialsProvider) ProvideCredentials() (string, string, error) {
+	return p.Username, p.Password, p.Error
+}
+
+type TestServiceCredentialer struct {
+	Username string
+	Password string
+}
+
+func (c TestServiceCredentialer) Credentials() (string, string) {
+	return c.Username, c.Password
+}
+
+type TestLogger struct {
+	Messages []string
+}
+
+func (l *TestLogger) Info(message string, data map[string]interface{}) {
+	l.Messages = append(l.Messages, message)
+}
+
+func (l *TestLogger) Error(message string, data map[string]interface{}) {
+	l.Messages = append(l.Messages, message)
 }
 
 var _ = Describe("BrokerHandler", func() {
@@ -49,7 +218,9 @@ var _ = Describe("BrokerHandler", func() {
 
 	BeforeEach(func() {
 		testBroker = NewTestBroker()
-		router = envoy.NewBrokerHandler(testBroker).(*mux.Router)
+		handler, err := envoy.NewBrokerHandler(testBroker)
+		Expect(err).NotTo(HaveOccurred())
+		router = handler.(*mux.Router)
 	})
 
 	Context("GET /v2/catalog", func() {
@@ -176,4 +347,1225 @@ var _ = Describe("BrokerHandler", func() {
 			Expect(router.Match(request, &match)).To(BeFalse())
 		})
 	})
+
+	Describe("Instance details endpoint: GET /v2/service_instances/:instance_id", func() {
+		It("is not routed when the broker cannot fetch service instances", func() {
+			request, err := http.NewRequest("GET", "/v2/service_instances/my-instance", nil)
+			if err != nil {
+				panic(err)
+			}
+
+			var match mux.RouteMatch
+			Expect(router.Match(request, &match)).To(BeFalse())
+		})
+
+		It("routes to the ServiceInstanceDetailsHandler when the broker can fetch service instances", func() {
+			handler, err := envoy.NewBrokerHandler(&TestDetailerBroker{})
+			Expect(err).NotTo(HaveOccurred())
+
+			request, err := http.NewRequest("GET", "/v2/service_instances/my-instance", nil)
+			if err != nil {
+				panic(err)
+			}
+
+			var match mux.RouteMatch
+			Expect(handler.(*mux.Router).Match(request, &match)).To(BeTrue())
+			Expect(match.Handler).To(BeAssignableToTypeOf(middleware.Authenticator{}))
+			auth := match.Handler.(middleware.Authenticator)
+			Expect(auth.Handler).To(BeAssignableToTypeOf(handlers.ServiceInstanceDetailsHandler{}))
+		})
+	})
+
+	Describe("Update endpoint: PATCH /v2/service_instances/:instance_id", func() {
+		It("is not routed when the broker cannot update service instances", func() {
+			request, err := http.NewRequest("PATCH", "/v2/service_instances/my-instance", nil)
+			if err != nil {
+				panic(err)
+			}
+
+			var match mux.RouteMatch
+			Expect(router.Match(request, &match)).To(BeFalse())
+		})
+
+		It("routes to the UpdateHandler when the broker can update service instances", func() {
+			handler, err := envoy.NewBrokerHandler(&TestUpdaterBroker{})
+			Expect(err).NotTo(HaveOccurred())
+
+			request, err := http.NewRequest("PATCH", "/v2/service_instances/my-instance", nil)
+			if err != nil {
+				panic(err)
+			}
+
+			var match mux.RouteMatch
+			Expect(handler.(*mux.Router).Match(request, &match)).To(BeTrue())
+			Expect(match.Handler).To(BeAssignableToTypeOf(middleware.Authenticator{}))
+			auth := match.Handler.(middleware.Authenticator)
+			Expect(auth.Handler).To(BeAssignableToTypeOf(handlers.UpdateHandler{}))
+		})
+	})
+
+	Describe("Last operation endpoint: GET /v2/service_instances/:instance_id/last_operation", func() {
+		It("is not routed when the broker cannot report operations", func() {
+			request, err := http.NewRequest("GET", "/v2/service_instances/my-instance/last_operation", nil)
+			if err != nil {
+				panic(err)
+			}
+
+			var match mux.RouteMatch
+			router.Match(request, &match)
+			Expect(match.MatchErr).To(Equal(mux.ErrNotFound))
+		})
+
+		It("routes to the LastOperationHandler when the broker can report operations", func() {
+			handler, err := envoy.NewBrokerHandler(&TestLastOperationBroker{})
+			Expect(err).NotTo(HaveOccurred())
+
+			request, err := http.NewRequest("GET", "/v2/service_instances/my-instance/last_operation?operation=task-1", nil)
+			if err != nil {
+				panic(err)
+			}
+
+			var match mux.RouteMatch
+			Expect(handler.(*mux.Router).Match(request, &match)).To(BeTrue())
+			Expect(match.Handler).To(BeAssignableToTypeOf(middleware.Authenticator{}))
+			auth := match.Handler.(middleware.Authenticator)
+			Expect(auth.Handler).To(BeAssignableToTypeOf(handlers.LastOperationHandler{}))
+		})
+	})
+
+	Context("when an instance is updated asynchronously", func() {
+		It("returns a 202 with the operation, which can then be polled", func() {
+			broker := &TestAsyncUpdateBroker{}
+			handler, err := envoy.NewBrokerHandler(broker)
+			Expect(err).NotTo(HaveOccurred())
+
+			request, err := http.NewRequest("PATCH", "/v2/service_instances/banana?accepts_incomplete=true", strings.NewReader(`{
+				"service_id": "service-id",
+				"plan_id": "large-plan"
+			}`))
+			if err != nil {
+				panic(err)
+			}
+			request.SetBasicAuth("username", "password")
+
+			writer := httptest.NewRecorder()
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusAccepted))
+			Expect(writer.Body.String()).To(MatchJSON(`{"operation":"update-large-plan"}`))
+
+			request, err = http.NewRequest("GET", writer.Header().Get("Location"), nil)
+			if err != nil {
+				panic(err)
+			}
+			request.SetBasicAuth("username", "password")
+
+			writer = httptest.NewRecorder()
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusOK))
+			Expect(writer.Body.String()).To(MatchJSON(`{"state":"in progress","description":"resizing"}`))
+			Expect(broker.PolledWith).To(Equal(domain.LastOperationRequest{
+				InstanceID:    "banana",
+				ServiceID:     "service-id",
+				PlanID:        "large-plan",
+				OperationData: "update-large-plan",
+			}))
+		})
+	})
+
+	Context("when a schema size limit is configured", func() {
+		It("returns an error when a plan schema is over the limit", func() {
+			testBroker.TestCatalog = domain.Catalog{
+				Services: []domain.Service{{
+					ID: "service-id",
+					Plans: []domain.Plan{{
+						ID: "plan-id",
+						Schemas: &domain.Schemas{
+							ServiceInstance: &domain.ServiceInstanceSchema{
+								Create: &domain.InputParametersSchema{
+									Parameters: map[string]interface{}{
+										"type":        "object",
+										"description": strings.Repeat("x", 100),
+									},
+								},
+							},
+						},
+					}},
+				}},
+			}
+
+			_, err := envoy.NewBrokerHandler(testBroker, envoy.WithSchemaSizeLimit(64))
+			Expect(err).To(BeAssignableToTypeOf(domain.InvalidCatalogError("")))
+
+			_, err = envoy.NewBrokerHandler(testBroker, envoy.WithSchemaSizeLimit(1024))
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("when deprovision requests are validated", func() {
+		It("rejects a deprovision with the wrong service_id", func() {
+			broker := NewTestInMemoryBroker()
+			broker.Instances["banana"] = domain.ServiceInstanceDetails{ServiceID: "service-id", PlanID: "plan-id"}
+
+			handler, err := envoy.NewBrokerHandler(broker, envoy.WithDeprovisionServiceValidation())
+			Expect(err).NotTo(HaveOccurred())
+
+			request, err := http.NewRequest("DELETE", "/v2/service_instances/banana?service_id=other-service-id&plan_id=plan-id", nil)
+			if err != nil {
+				panic(err)
+			}
+			request.SetBasicAuth("username", "password")
+
+			writer := httptest.NewRecorder()
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusBadRequest))
+		})
+
+		It("requires a broker that can look up service instances", func() {
+			_, err := envoy.NewBrokerHandler(testBroker, envoy.WithDeprovisionServiceValidation())
+			Expect(err).To(MatchError("validating deprovision requests requires a broker that implements ServiceInstanceDetailer"))
+		})
+	})
+
+	Context("when an instance is fetched after its plan is updated", func() {
+		It("returns the updated plan", func() {
+			broker := NewTestInMemoryBroker()
+			handler, err := envoy.NewBrokerHandler(broker)
+			Expect(err).NotTo(HaveOccurred())
+
+			serve := func(method, path, body string) *httptest.ResponseRecorder {
+				request, err := http.NewRequest(method, path, strings.NewReader(body))
+				if err != nil {
+					panic(err)
+				}
+				request.SetBasicAuth("username", "password")
+
+				writer := httptest.NewRecorder()
+				handler.ServeHTTP(writer, request)
+
+				return writer
+			}
+
+			writer := serve("PUT", "/v2/service_instances/banana", `{
+				"service_id": "service-id",
+				"plan_id": "small-plan",
+				"organization_guid": "organization-guid",
+				"space_guid": "space-guid"
+			}`)
+			Expect(writer.Code).To(Equal(http.StatusCreated))
+
+			writer = serve("PATCH", "/v2/service_instances/banana", `{
+				"service_id": "service-id",
+				"plan_id": "large-plan",
+				"previous_values": {"plan_id": "small-plan"}
+			}`)
+			Expect(writer.Code).To(Equal(http.StatusOK))
+
+			writer = serve("GET", "/v2/service_instances/banana", "")
+			Expect(writer.Code).To(Equal(http.StatusOK))
+			Expect(writer.Body.String()).To(MatchJSON(`{
+				"service_id": "service-id",
+				"plan_id": "large-plan"
+			}`))
+		})
+	})
+
+	Context("when a logger is provided", func() {
+		It("logs each request that is served", func() {
+			logger := &TestLogger{}
+			handler, err := envoy.NewBrokerHandler(testBroker, envoy.WithLogger(logger))
+			Expect(err).NotTo(HaveOccurred())
+
+			request, err := http.NewRequest("GET", "/v2/catalog", nil)
+			if err != nil {
+				panic(err)
+			}
+			request.SetBasicAuth("username", "password")
+
+			handler.ServeHTTP(httptest.NewRecorder(), request)
+
+			Expect(logger.Messages).To(Equal([]string{"request.served"}))
+		})
+	})
+
+	Context("when the Common Log Format is enabled", func() {
+		It("writes an access log line for a catalog request", func() {
+			accessLog := &bytes.Buffer{}
+			handler, err := envoy.NewBrokerHandler(testBroker, envoy.WithCommonLogFormat(accessLog, true))
+			Expect(err).NotTo(HaveOccurred())
+
+			request, err := http.NewRequest("GET", "/v2/catalog", nil)
+			if err != nil {
+				panic(err)
+			}
+			request.RemoteAddr = "192.0.2.10:40000"
+			request.SetBasicAuth("username", "password")
+
+			handler.ServeHTTP(httptest.NewRecorder(), request)
+
+			Expect(accessLog.String()).To(MatchRegexp(
+				`^192\.0\.2\.10 - username \[[^\]]+\] "GET /v2/catalog HTTP/1\.1" 200 \d+\n$`))
+		})
+
+		It("replaces the structured request logs when asked to", func() {
+			logger := &TestLogger{}
+			handler, err := envoy.NewBrokerHandler(testBroker, envoy.WithLogger(logger), envoy.WithCommonLogFormat(ioutil.Discard, true))
+			Expect(err).NotTo(HaveOccurred())
+
+			request, err := http.NewRequest("GET", "/v2/catalog", nil)
+			if err != nil {
+				panic(err)
+			}
+			request.SetBasicAuth("username", "password")
+
+			handler.ServeHTTP(httptest.NewRecorder(), request)
+
+			Expect(logger.Messages).To(BeEmpty())
+		})
+
+		It("logs the forwarded client IP of requests from a trusted proxy", func() {
+			accessLog := &bytes.Buffer{}
+			handler, err := envoy.NewBrokerHandler(testBroker, envoy.WithCommonLogFormat(accessLog, true), envoy.WithTrustedProxies("192.0.2.0/24"))
+			Expect(err).NotTo(HaveOccurred())
+
+			request, err := http.NewRequest("GET", "/v2/catalog", nil)
+			if err != nil {
+				panic(err)
+			}
+			request.RemoteAddr = "192.0.2.10:40000"
+			request.Header.Set("X-Forwarded-For", "198.51.100.20")
+			request.SetBasicAuth("username", "password")
+
+			handler.ServeHTTP(httptest.NewRecorder(), request)
+
+			Expect(accessLog.String()).To(HavePrefix("198.51.100.20 - username ["))
+		})
+
+		It("returns an error when a trusted proxy range is invalid", func() {
+			_, err := envoy.NewBrokerHandler(testBroker, envoy.WithTrustedProxies("not-a-cidr"))
+			Expect(err).To(MatchError(ContainSubstring("invalid trusted proxy")))
+		})
+	})
+
+	Context("when read-only credentials are provided", func() {
+		var handler http.Handler
+
+		BeforeEach(func() {
+			var err error
+			handler, err = envoy.NewBrokerHandler(testBroker, envoy.WithReadOnlyCredentials(TestCredentialer{}))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("allows the read-only credentials to fetch the catalog", func() {
+			request, err := http.NewRequest("GET", "/v2/catalog", nil)
+			if err != nil {
+				panic(err)
+			}
+			request.SetBasicAuth("reader", "read-only")
+
+			writer := httptest.NewRecorder()
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusOK))
+		})
+
+		It("rejects the read-only credentials when provisioning", func() {
+			request, err := http.NewRequest("PUT", "/v2/service_instances/banana", strings.NewReader(`{
+				"service_id": "service-id",
+				"plan_id": "plan-id",
+				"organization_guid": "organization-guid",
+				"space_guid": "space-guid"
+			}`))
+			if err != nil {
+				panic(err)
+			}
+			request.SetBasicAuth("reader", "read-only")
+
+			writer := httptest.NewRecorder()
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("still allows the broker credentials to provision", func() {
+			request, err := http.NewRequest("PUT", "/v2/service_instances/banana", strings.NewReader(`{
+				"service_id": "service-id",
+				"plan_id": "plan-id",
+				"organization_guid": "organization-guid",
+				"space_guid": "space-guid"
+			}`))
+			if err != nil {
+				panic(err)
+			}
+			request.SetBasicAuth("username", "password")
+
+			writer := httptest.NewRecorder()
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusCreated))
+		})
+	})
+
+	Context("when a credentials provider is configured", func() {
+		var (
+			handler  http.Handler
+			provider *TestCredentialsProvider
+		)
+
+		fetchCatalog := func(username, password string) int {
+			request, err := http.NewRequest("GET", "/v2/catalog", nil)
+			if err != nil {
+				panic(err)
+			}
+			request.SetBasicAuth(username, password)
+
+			writer := httptest.NewRecorder()
+			handler.ServeHTTP(writer, request)
+
+			return writer.Code
+		}
+
+		BeforeEach(func() {
+			provider = &TestCredentialsProvider{Username: "admin", Password: "first-secret"}
+
+			var err error
+			handler, err = envoy.NewBrokerHandler(testBroker, envoy.WithCredentialsProvider(provider))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("authenticates with the provided credentials instead of the broker credentials", func() {
+			Expect(fetchCatalog("admin", "first-secret")).To(Equal(http.StatusOK))
+			Expect(fetchCatalog("username", "password")).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("consults the provider on each request", func() {
+			Expect(fetchCatalog("admin", "first-secret")).To(Equal(http.StatusOK))
+
+			provider.Password = "second-secret"
+
+			Expect(fetchCatalog("admin", "first-secret")).To(Equal(http.StatusUnauthorized))
+			Expect(fetchCatalog("admin", "second-secret")).To(Equal(http.StatusOK))
+		})
+
+		It("rejects requests while the provider fails", func() {
+			provider.Username = ""
+			provider.Password = ""
+			provider.Error = errors.New("secret store unavailable")
+
+			Expect(fetchCatalog("", "")).To(Equal(http.StatusUnauthorized))
+		})
+	})
+
+	Context("when credentials are provided for individual services", func() {
+		var handler http.Handler
+
+		provision := func(serviceID, username, password string) int {
+			request, err := http.NewRequest("PUT", "/v2/service_instances/banana", strings.NewReader(`{
+				"service_id": "`+serviceID+`",
+				"plan_id": "plan-id",
+				"organization_guid": "organization-guid",
+				"space_guid": "space-guid"
+			}`))
+			if err != nil {
+				panic(err)
+			}
+			request.SetBasicAuth(username, password)
+
+			writer := httptest.NewRecorder()
+			handler.ServeHTTP(writer, request)
+
+			return writer.Code
+		}
+
+		BeforeEach(func() {
+			var err error
+			handler, err = envoy.NewBrokerHandler(testBroker,
+				envoy.WithServiceCredentials("mysql", TestServiceCredentialer{Username: "mysql-user", Password: "mysql-password"}),
+				envoy.WithServiceCredentials("redis", TestServiceCredentialer{Username: "redis-user", Password: "redis-password"}),
+			)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("authenticates each service with its own credentials", func() {
+			Expect(provision("mysql", "mysql-user", "mysql-password")).To(Equal(http.StatusCreated))
+			Expect(provision("redis", "redis-user", "redis-password")).To(Equal(http.StatusCreated))
+		})
+
+		It("rejects the credentials of one service for another", func() {
+			Expect(provision("mysql", "redis-user", "redis-password")).To(Equal(http.StatusUnauthorized))
+			Expect(provision("redis", "mysql-user", "mysql-password")).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("rejects the broker credentials for a service with its own credentials", func() {
+			Expect(provision("mysql", "username", "password")).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("rejects a provision whose query names a different service than its body", func() {
+			request, err := http.NewRequest("PUT", "/v2/service_instances/banana?service_id=redis", strings.NewReader(`{
+				"service_id": "mysql",
+				"plan_id": "plan-id",
+				"organization_guid": "organization-guid",
+				"space_guid": "space-guid"
+			}`))
+			if err != nil {
+				panic(err)
+			}
+			request.SetBasicAuth("redis-user", "redis-password")
+
+			writer := httptest.NewRecorder()
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusBadRequest))
+			Expect(testBroker.ProvisionCallCount).To(BeZero())
+		})
+
+		It("rejects a deprovision that names the service more than once", func() {
+			request, err := http.NewRequest("DELETE", "/v2/service_instances/banana?service_id=redis&service_id=mysql&plan_id=plan-id", strings.NewReader(`{
+				"service_id": "mysql",
+				"plan_id": "plan-id"
+			}`))
+			if err != nil {
+				panic(err)
+			}
+			request.SetBasicAuth("redis-user", "redis-password")
+
+			writer := httptest.NewRecorder()
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusBadRequest))
+		})
+
+		It("rejects service credentials for the catalog, whatever the query names", func() {
+			request, err := http.NewRequest("GET", "/v2/catalog?service_id=mysql", nil)
+			if err != nil {
+				panic(err)
+			}
+			request.SetBasicAuth("mysql-user", "mysql-password")
+
+			writer := httptest.NewRecorder()
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("uses the broker credentials for other services", func() {
+			Expect(provision("service-id", "username", "password")).To(Equal(http.StatusCreated))
+			Expect(provision("service-id", "mysql-user", "mysql-password")).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("uses the broker credentials to fetch the catalog", func() {
+			request, err := http.NewRequest("GET", "/v2/catalog", nil)
+			if err != nil {
+				panic(err)
+			}
+			request.SetBasicAuth("username", "password")
+
+			writer := httptest.NewRecorder()
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusOK))
+		})
+	})
+
+	Context("when idempotency keys are enabled", func() {
+		It("calls the broker once for a provision repeated with the same key", func() {
+			handler, err := envoy.NewBrokerHandler(testBroker, envoy.WithIdempotencyKeys(envoy.NewMemoryIdempotencyStore(0)))
+			Expect(err).NotTo(HaveOccurred())
+
+			testBroker.TestProvisionResponse = domain.ProvisionResponse{DashboardURL: "http://dashboard.example.com"}
+
+			provision := func() *httptest.ResponseRecorder {
+				request, err := http.NewRequest("PUT", "/v2/service_instances/banana", strings.NewReader(`{
+					"service_id": "service-id",
+					"plan_id": "plan-id",
+					"organization_guid": "organization-guid",
+					"space_guid": "space-guid"
+				}`))
+				if err != nil {
+					panic(err)
+				}
+				request.SetBasicAuth("username", "password")
+				request.Header.Set("Idempotency-Key", "retry-me")
+
+				writer := httptest.NewRecorder()
+				handler.ServeHTTP(writer, request)
+
+				return writer
+			}
+
+			first := provision()
+			second := provision()
+
+			Expect(testBroker.ProvisionCallCount).To(Equal(1))
+			Expect(first.Code).To(Equal(http.StatusCreated))
+			Expect(second.Code).To(Equal(http.StatusCreated))
+			Expect(second.Body.String()).To(MatchJSON(`{"dashboard_url": "http://dashboard.example.com"}`))
+		})
+	})
+
+	Context("when replay protection is enabled", func() {
+		It("calls the broker once for a provision replayed with the same request identity", func() {
+			handler, err := envoy.NewBrokerHandler(testBroker, envoy.WithReplayProtection(time.Minute))
+			Expect(err).NotTo(HaveOccurred())
+
+			provision := func() *httptest.ResponseRecorder {
+				request, err := http.NewRequest("PUT", "/v2/service_instances/banana", strings.NewReader(`{
+					"service_id": "service-id",
+					"plan_id": "plan-id",
+					"organization_guid": "organization-guid",
+					"space_guid": "space-guid"
+				}`))
+				if err != nil {
+					panic(err)
+				}
+				request.SetBasicAuth("username", "password")
+				request.Header.Set("X-Broker-API-Request-Identity", "identity-1")
+
+				writer := httptest.NewRecorder()
+				handler.ServeHTTP(writer, request)
+
+				return writer
+			}
+
+			first := provision()
+			second := provision()
+
+			Expect(testBroker.ProvisionCallCount).To(Equal(1))
+			Expect(second.Code).To(Equal(first.Code))
+			Expect(second.Body.String()).To(Equal(first.Body.String()))
+		})
+	})
+
+	Context("when body recording is enabled", func() {
+		It("returns the recorded requests with their secrets redacted", func() {
+			handler, err := envoy.NewBrokerHandler(testBroker, envoy.WithBodyRecording(10))
+			Expect(err).NotTo(HaveOccurred())
+
+			request, err := http.NewRequest("PUT", "/v2/service_instances/banana", strings.NewReader(`{
+				"service_id": "service-id",
+				"plan_id": "plan-id",
+				"organization_guid": "organization-guid",
+				"space_guid": "space-guid",
+				"parameters": {"password": "hunter2"}
+			}`))
+			if err != nil {
+				panic(err)
+			}
+			request.SetBasicAuth("username", "password")
+			handler.ServeHTTP(httptest.NewRecorder(), request)
+
+			request, err = http.NewRequest("GET", "/debug/exchanges", nil)
+			if err != nil {
+				panic(err)
+			}
+			request.SetBasicAuth("username", "password")
+
+			writer := httptest.NewRecorder()
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusOK))
+			Expect(writer.Body.String()).To(ContainSubstring(`"path":"/v2/service_instances/banana"`))
+			Expect(writer.Body.String()).To(ContainSubstring(`[REDACTED]`))
+			Expect(writer.Body.String()).NotTo(ContainSubstring("hunter2"))
+		})
+
+		It("does not serve the recordings when it is not enabled", func() {
+			handler, err := envoy.NewBrokerHandler(testBroker)
+			Expect(err).NotTo(HaveOccurred())
+
+			request, err := http.NewRequest("GET", "/debug/exchanges", nil)
+			if err != nil {
+				panic(err)
+			}
+			request.SetBasicAuth("username", "password")
+
+			writer := httptest.NewRecorder()
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	Context("when the route is unknown", func() {
+		It("returns a coded 404 error", func() {
+			handler, err := envoy.NewBrokerHandler(testBroker)
+			Expect(err).NotTo(HaveOccurred())
+
+			request, err := http.NewRequest("GET", "/v2/bananas", nil)
+			if err != nil {
+				panic(err)
+			}
+			request.SetBasicAuth("username", "password")
+
+			writer := httptest.NewRecorder()
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusNotFound))
+			Expect(writer.Header().Get("Content-Type")).To(Equal("application/json"))
+			Expect(writer.Body.String()).To(MatchJSON(`{
+				"error": "NotFound",
+				"description": "no route for GET /v2/bananas"
+			}`))
+		})
+	})
+
+	Context("when provision request debugging is configured", func() {
+		provisionAndFetch := func(handler http.Handler) *httptest.ResponseRecorder {
+			request, err := http.NewRequest("PUT", "/v2/service_instances/banana", strings.NewReader(`{
+				"service_id": "service-id",
+				"plan_id": "plan-id",
+				"organization_guid": "organization-guid",
+				"space_guid": "space-guid",
+				"parameters": {"size": "large"}
+			}`))
+			if err != nil {
+				panic(err)
+			}
+			request.SetBasicAuth("username", "password")
+			handler.ServeHTTP(httptest.NewRecorder(), request)
+
+			request, err = http.NewRequest("GET", "/debug/service_instances/banana/provision_request", nil)
+			if err != nil {
+				panic(err)
+			}
+			request.SetBasicAuth("username", "password")
+
+			writer := httptest.NewRecorder()
+			handler.ServeHTTP(writer, request)
+
+			return writer
+		}
+
+		It("returns a 404 when it is disabled", func() {
+			handler, err := envoy.NewBrokerHandler(testBroker)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(provisionAndFetch(handler).Code).To(Equal(http.StatusNotFound))
+		})
+
+		It("returns the stored provision request when it is enabled", func() {
+			handler, err := envoy.NewBrokerHandler(testBroker, envoy.WithProvisionRequestDebugging())
+			Expect(err).NotTo(HaveOccurred())
+
+			writer := provisionAndFetch(handler)
+
+			Expect(writer.Code).To(Equal(http.StatusOK))
+			Expect(writer.Body.String()).To(MatchJSON(`{
+				"instance_id": "banana",
+				"service_id": "service-id",
+				"plan_id": "plan-id",
+				"organization_guid": "organization-guid",
+				"space_guid": "space-guid",
+				"accepts_incomplete": false,
+				"parameters": {"size": "large"}
+			}`))
+		})
+
+		It("requires the broker's credentials", func() {
+			handler, err := envoy.NewBrokerHandler(testBroker, envoy.WithProvisionRequestDebugging())
+			Expect(err).NotTo(HaveOccurred())
+
+			request, err := http.NewRequest("GET", "/debug/service_instances/banana/provision_request", nil)
+			if err != nil {
+				panic(err)
+			}
+
+			writer := httptest.NewRecorder()
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusUnauthorized))
+		})
+	})
+
+	Context("when concurrent operations are guarded", func() {
+		It("rejects a deprovision while an operation on the instance is in progress", func() {
+			store := domain.NewMemoryOperationStore()
+			Expect(store.Create("banana", domain.OperationRecord{ID: "op-1", State: domain.LastOperationInProgress})).To(Succeed())
+
+			handler, err := envoy.NewBrokerHandler(testBroker, envoy.WithOperationStore(store), envoy.WithConcurrentOperationGuard())
+			Expect(err).NotTo(HaveOccurred())
+
+			request, err := http.NewRequest("DELETE", "/v2/service_instances/banana?service_id=service-id&plan_id=plan-id", nil)
+			if err != nil {
+				panic(err)
+			}
+			request.SetBasicAuth("username", "password")
+
+			writer := httptest.NewRecorder()
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusUnprocessableEntity))
+			Expect(writer.Body.String()).To(ContainSubstring(`"error":"ConcurrencyError"`))
+		})
+
+		It("returns the original response to a retry with the same idempotency key while the operation is in progress", func() {
+			store := domain.NewMemoryOperationStore()
+
+			handler, err := envoy.NewBrokerHandler(testBroker,
+				envoy.WithOperationStore(store),
+				envoy.WithConcurrentOperationGuard(),
+				envoy.WithIdempotencyKeys(envoy.NewMemoryIdempotencyStore(0)),
+			)
+			Expect(err).NotTo(HaveOccurred())
+
+			deprovision := func() *httptest.ResponseRecorder {
+				request, err := http.NewRequest("DELETE", "/v2/service_instances/banana?service_id=service-id&plan_id=plan-id", nil)
+				if err != nil {
+					panic(err)
+				}
+				request.SetBasicAuth("username", "password")
+				request.Header.Set("Idempotency-Key", "retry-me")
+
+				writer := httptest.NewRecorder()
+				handler.ServeHTTP(writer, request)
+
+				return writer
+			}
+
+			first := deprovision()
+			Expect(first.Code).To(Equal(http.StatusOK))
+
+			Expect(store.Create("banana", domain.OperationRecord{ID: "op-1", State: domain.LastOperationInProgress})).To(Succeed())
+
+			second := deprovision()
+			Expect(second.Code).To(Equal(http.StatusOK))
+			Expect(second.Body.String()).To(Equal(first.Body.String()))
+		})
+
+		It("requires an operation store", func() {
+			_, err := envoy.NewBrokerHandler(testBroker, envoy.WithConcurrentOperationGuard())
+			Expect(err).To(MatchError("guarding concurrent operations requires an operation store"))
+		})
+	})
+
+	Context("when operation signing is enabled", func() {
+		It("requires a signing key", func() {
+			_, err := envoy.NewBrokerHandler(testBroker, envoy.WithOperationSigning(nil))
+			Expect(err).To(MatchError("operation signing key must not be empty"))
+		})
+
+		It("rejects polling with an operation that was not signed", func() {
+			handler, err := envoy.NewBrokerHandler(&TestLastOperationBroker{}, envoy.WithOperationSigning([]byte("signing-key")))
+			Expect(err).NotTo(HaveOccurred())
+
+			request, err := http.NewRequest("GET", "/v2/service_instances/banana/last_operation?operation=task-1", nil)
+			if err != nil {
+				panic(err)
+			}
+			request.SetBasicAuth("username", "password")
+
+			writer := httptest.NewRecorder()
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+
+	Context("when unknown operations are reported as failed", func() {
+		It("returns a failed state for an operation the broker does not recognize", func() {
+			handler, err := envoy.NewBrokerHandler(&TestLostOperationBroker{}, envoy.WithUnknownOperationsFailed())
+			Expect(err).NotTo(HaveOccurred())
+
+			request, err := http.NewRequest("GET", "/v2/service_instances/banana/last_operation?operation=task-1", nil)
+			if err != nil {
+				panic(err)
+			}
+			request.SetBasicAuth("username", "password")
+
+			writer := httptest.NewRecorder()
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusOK))
+			Expect(writer.Body.String()).To(MatchJSON(`{"state":"failed","description":"unknown operation"}`))
+		})
+	})
+
+	Context("when CORS is enabled for the catalog", func() {
+		var handler http.Handler
+
+		BeforeEach(func() {
+			var err error
+			handler, err = envoy.NewBrokerHandler(testBroker,
+				envoy.WithCatalogCORS([]string{"https://dashboard.example.com"}, nil, nil),
+				envoy.WithAPIVersions("2.10", ""),
+			)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("answers a preflight request without credentials", func() {
+			request, err := http.NewRequest("OPTIONS", "/v2/catalog", nil)
+			if err != nil {
+				panic(err)
+			}
+			request.Header.Set("Origin", "https://dashboard.example.com")
+			request.Header.Set("Access-Control-Request-Method", "GET")
+			request.Header.Set("Access-Control-Request-Headers", "authorization, x-broker-api-version")
+
+			writer := httptest.NewRecorder()
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusNoContent))
+			Expect(writer.Header().Get("Access-Control-Allow-Origin")).To(Equal("https://dashboard.example.com"))
+			Expect(writer.Header().Get("Access-Control-Allow-Methods")).To(Equal("GET"))
+			Expect(writer.Header().Get("Access-Control-Allow-Headers")).To(Equal("Authorization, X-Broker-API-Version"))
+		})
+
+		It("serves the catalog to an allowed origin", func() {
+			request, err := http.NewRequest("GET", "/v2/catalog", nil)
+			if err != nil {
+				panic(err)
+			}
+			request.Header.Set("Origin", "https://dashboard.example.com")
+			request.Header.Set("X-Broker-API-Version", "2.13")
+			request.SetBasicAuth("username", "password")
+
+			writer := httptest.NewRecorder()
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusOK))
+			Expect(writer.Header().Get("Access-Control-Allow-Origin")).To(Equal("https://dashboard.example.com"))
+		})
+
+		It("still requires credentials to fetch the catalog", func() {
+			request, err := http.NewRequest("GET", "/v2/catalog", nil)
+			if err != nil {
+				panic(err)
+			}
+			request.Header.Set("Origin", "https://dashboard.example.com")
+			request.Header.Set("X-Broker-API-Version", "2.13")
+
+			writer := httptest.NewRecorder()
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusUnauthorized))
+		})
+	})
+
+	Context("when the catalog is cached", func() {
+		It("reports cache hits and misses to the metrics", func() {
+			metrics := TestMetrics{}
+			handler, err := envoy.NewBrokerHandler(testBroker, envoy.WithCatalogCache(time.Hour), envoy.WithMetrics(metrics))
+			Expect(err).NotTo(HaveOccurred())
+
+			for i := 0; i < 3; i++ {
+				request, err := http.NewRequest("GET", "/v2/catalog", nil)
+				if err != nil {
+					panic(err)
+				}
+				request.SetBasicAuth("username", "password")
+
+				writer := httptest.NewRecorder()
+				handler.ServeHTTP(writer, request)
+				Expect(writer.Code).To(Equal(http.StatusOK))
+			}
+
+			Expect(metrics).To(Equal(TestMetrics{
+				envoy.CatalogCacheMissCounter: 1,
+				envoy.CatalogCacheHitCounter:  2,
+			}))
+		})
+	})
+
+	Context("when a catalog transformer is configured", func() {
+		It("serves the transformed catalog", func() {
+			testBroker.TestCatalog = domain.Catalog{
+				Services: []domain.Service{{ID: "service-1", Name: "first"}},
+			}
+			handler, err := envoy.NewBrokerHandler(testBroker, envoy.WithCatalogTransformer(TestCatalogTransformer{}))
+			Expect(err).NotTo(HaveOccurred())
+
+			request, err := http.NewRequest("GET", "/v2/catalog", nil)
+			if err != nil {
+				panic(err)
+			}
+			request.SetBasicAuth("username", "password")
+
+			writer := httptest.NewRecorder()
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusOK))
+			Expect(writer.Body.String()).To(MatchJSON(`{
+				"services": [{
+					"id": "service-1",
+					"name": "first",
+					"description": "",
+					"bindable": false,
+					"tags": ["transformed"],
+					"plans": null
+				}]
+			}`))
+		})
+	})
+
+	Context("when the catalog has duplicate service IDs", func() {
+		BeforeEach(func() {
+			testBroker.TestCatalog = domain.Catalog{
+				Services: []domain.Service{
+					{ID: "service-1", Name: "first"},
+					{ID: "service-1", Name: "second"},
+				},
+			}
+		})
+
+		It("fails to construct the handler", func() {
+			handler, err := envoy.NewBrokerHandler(testBroker)
+			Expect(err).To(MatchError(domain.InvalidCatalogError(`duplicate service ID "service-1"`)))
+			Expect(handler).To(BeNil())
+		})
+	})
+
+	Context("when the catalog declares plan schemas", func() {
+		catalogWithSchema := func(parameters map[string]interface{}) domain.Catalog {
+			return domain.Catalog{
+				Services: []domain.Service{
+					{
+						ID: "service-1",
+						Plans: []domain.Plan{
+							{
+								ID: "plan-1",
+								Schemas: &domain.Schemas{
+									ServiceInstance: &domain.ServiceInstanceSchema{
+										Create: &domain.InputParametersSchema{Parameters: parameters},
+									},
+								},
+							},
+						},
+					},
+				},
+			}
+		}
+
+		It("constructs the handler when the schemas are well-formed", func() {
+			testBroker.TestCatalog = catalogWithSchema(map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"size": map[string]interface{}{"type": "integer"},
+				},
+			})
+
+			handler, err := envoy.NewBrokerHandler(testBroker)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(handler).NotTo(BeNil())
+		})
+
+		It("fails to construct the handler when a schema is malformed", func() {
+			testBroker.TestCatalog = catalogWithSchema(map[string]interface{}{
+				"type":       "object",
+				"properties": []interface{}{"size"},
+			})
+
+			handler, err := envoy.NewBrokerHandler(testBroker)
+			Expect(err).To(MatchError(domain.InvalidCatalogError(
+				`plan "plan-1": invalid schema: service_instance.create.parameters.properties must be an object`)))
+			Expect(handler).To(BeNil())
+		})
+	})
+
+	Context("when the catalog has updateable plans", func() {
+		BeforeEach(func() {
+			updateable := true
+			testBroker.TestCatalog = domain.Catalog{
+				Services: []domain.Service{
+					{
+						ID:    "service-1",
+						Plans: []domain.Plan{{ID: "plan-1", PlanUpdateable: &updateable}},
+					},
+				},
+			}
+		})
+
+		It("returns an error when the broker cannot update service instances", func() {
+			_, err := envoy.NewBrokerHandler(testBroker)
+			Expect(err).To(MatchError(`service "service-1" has updateable plans, but the broker does not implement Updater`))
+		})
+
+		It("succeeds when the broker can update service instances", func() {
+			_, err := envoy.NewBrokerHandler(&TestUpdaterBroker{TestBroker: *testBroker})
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("when panic recovery is enabled", func() {
+		var server *httptest.Server
+
+		BeforeEach(func() {
+			handler, err := envoy.NewBrokerHandler(testBroker, envoy.WithPanicRecovery())
+			Expect(err).NotTo(HaveOccurred())
+
+			server = httptest.NewServer(handler)
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		provision := func(instanceID string) int {
+			request, err := http.NewRequest("PUT", server.URL+"/v2/service_instances/"+instanceID, strings.NewReader(`{
+				"service_id": "service-id",
+				"plan_id": "plan-id",
+				"organization_guid": "organization-guid",
+				"space_guid": "space-guid"
+			}`))
+			if err != nil {
+				panic(err)
+			}
+			request.SetBasicAuth("username", "password")
+
+			response, err := http.DefaultClient.Do(request)
+			if err != nil {
+				return 0
+			}
+			defer response.Body.Close()
+
+			return response.StatusCode
+		}
+
+		It("isolates a panicking request from concurrent requests", func() {
+			instanceIDs := []string{"panic"}
+			for i := 0; i < 10; i++ {
+				instanceIDs = append(instanceIDs, fmt.Sprintf("instance-%d", i))
+			}
+
+			statuses := make([]int, len(instanceIDs))
+			var wg sync.WaitGroup
+			for i, instanceID := range instanceIDs {
+				wg.Add(1)
+				go func(i int, instanceID string) {
+					defer wg.Done()
+					defer GinkgoRecover()
+					statuses[i] = provision(instanceID)
+				}(i, instanceID)
+			}
+			wg.Wait()
+
+			Expect(statuses[0]).To(Equal(http.StatusInternalServerError))
+			for _, status := range statuses[1:] {
+				Expect(status).To(Equal(http.StatusCreated))
+			}
+		})
+	})
+
+	Context("when served over HTTP/2", func() {
+		var server *httptest.Server
+
+		BeforeEach(func() {
+			testBroker.TestCatalog = domain.Catalog{
+				Services: []domain.Service{{ID: "service-1", Name: "first"}},
+			}
+
+			handler, err := envoy.NewBrokerHandler(testBroker, envoy.WithCompression(), envoy.WithLogger(&TestLogger{}))
+			Expect(err).NotTo(HaveOccurred())
+
+			server = httptest.NewUnstartedServer(handler)
+			server.EnableHTTP2 = true
+			server.StartTLS()
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("serves the catalog", func() {
+			request, err := http.NewRequest("GET", server.URL+"/v2/catalog", nil)
+			if err != nil {
+				panic(err)
+			}
+			request.SetBasicAuth("username", "password")
+
+			response, err := server.Client().Do(request)
+			Expect(err).NotTo(HaveOccurred())
+			defer response.Body.Close()
+
+			body, err := ioutil.ReadAll(response.Body)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(response.ProtoMajor).To(Equal(2))
+			Expect(response.StatusCode).To(Equal(http.StatusOK))
+			Expect(body).To(MatchJSON(`{
+				"services": [{"id": "service-1", "name": "first", "description": "", "bindable": false, "plans": null}]
+			}`))
+		})
+	})
+
+	Context("when request identities are enabled", func() {
+		var handler http.Handler
+
+		BeforeEach(func() {
+			testBroker.TestProvisionResponse = domain.ProvisionResponse{
+				IsAsync:       true,
+				OperationData: "task-1",
+			}
+
+			var err error
+			handler, err = envoy.NewBrokerHandler(testBroker, envoy.WithRequestIdentity())
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		provision := func(identity string) *httptest.ResponseRecorder {
+			body := strings.NewReader(`{
+				"service_id": "service-id",
+				"plan_id": "plan-id",
+				"organization_guid": "organization-guid",
+				"space_guid": "space-guid"
+			}`)
+			request, err := http.NewRequest("PUT", "/v2/service_instances/instance-id?accepts_incomplete=true", body)
+			if err != nil {
+				panic(err)
+			}
+			request.SetBasicAuth("username", "password")
+			if identity != "" {
+				request.Header.Set("X-Broker-API-Request-Identity", identity)
+			}
+
+			writer := httptest.NewRecorder()
+			handler.ServeHTTP(writer, request)
+
+			return writer
+		}
+
+		It("echoes the platform's request identity on an asynchronous provision response", func() {
+			writer := provision("platform-request-id")
+
+			Expect(writer.Code).To(Equal(http.StatusAccepted))
+			Expect(writer.Header().Get("X-Broker-API-Request-Identity")).To(Equal("platform-request-id"))
+		})
+
+		It("returns a generated request identity on an asynchronous provision response", func() {
+			writer := provision("")
+
+			Expect(writer.Code).To(Equal(http.StatusAccepted))
+			Expect(writer.Header().Get("X-Broker-API-Request-Identity")).NotTo(BeEmpty())
+		})
+	})
+
+	Context("when retry logging is enabled", func() {
+		It("logs a retry when the same request identity is seen twice", func() {
+			logger := &TestLogger{}
+			handler, err := envoy.NewBrokerHandler(testBroker, envoy.WithLogger(logger), envoy.WithRetryLogging(time.Minute))
+			Expect(err).NotTo(HaveOccurred())
+
+			for i := 0; i < 2; i++ {
+				request, err := http.NewRequest("GET", "/v2/catalog", nil)
+				if err != nil {
+					panic(err)
+				}
+				request.SetBasicAuth("username", "password")
+				request.Header.Set("X-Broker-API-Request-Identity", "platform-request-id")
+
+				writer := httptest.NewRecorder()
+				handler.ServeHTTP(writer, request)
+
+				Expect(writer.Code).To(Equal(http.StatusOK))
+			}
+
+			Expect(logger.Messages).To(ContainElement("request.retry-detected"))
+		})
+
+		It("returns an error when no logger is configured", func() {
+			_, err := envoy.NewBrokerHandler(testBroker, envoy.WithRetryLogging(time.Minute))
+			Expect(err).To(MatchError("logging retries requires a Logger"))
+		})
+	})
 })
@@ -0,0 +1,67 @@
+package envoy
+
+import (
+	"fmt"
+	"os"
+)
+
+// CredentialsProvider defines the interface for looking up the Basic Auth
+// credentials required to interact with the service broker. Unlike the
+// Credentialer of the Broker, a provider may fail, such as when the
+// credentials are kept in an external secret store that cannot be reached.
+// It is consulted on every request, so credentials can be rotated without
+// restarting the broker. While it returns an error, requests are rejected
+// with a 401 Unauthorized.
+type CredentialsProvider interface {
+	ProvideCredentials() (username, password string, err error)
+}
+
+// StaticCredentialsProvider is a CredentialsProvider that always provides
+// the same credentials.
+type StaticCredentialsProvider struct {
+	Username string
+	Password string
+}
+
+// ProvideCredentials returns the username and password of the provider.
+func (p StaticCredentialsProvider) ProvideCredentials() (string, string, error) {
+	return p.Username, p.Password, nil
+}
+
+// EnvCredentialsProvider is a CredentialsProvider that reads the
+// credentials from environment variables each time they are needed.
+type EnvCredentialsProvider struct {
+	// UsernameVar is the name of the environment variable holding the
+	// username.
+	UsernameVar string
+
+	// PasswordVar is the name of the environment variable holding the
+	// password.
+	PasswordVar string
+}
+
+// NewEnvCredentialsProvider returns an EnvCredentialsProvider that reads
+// the credentials from the environment variables with the given names.
+func NewEnvCredentialsProvider(usernameVar, passwordVar string) EnvCredentialsProvider {
+	return EnvCredentialsProvider{
+		UsernameVar: usernameVar,
+		PasswordVar: passwordVar,
+	}
+}
+
+// ProvideCredentials returns the values of the environment variables. An
+// error is returned if either variable is unset or empty, so that a
+// missing secret does not allow requests with empty credentials.
+func (p EnvCredentialsProvider) ProvideCredentials() (string, string, error) {
+	username := os.Getenv(p.UsernameVar)
+	if username == "" {
+		return "", "", fmt.Errorf("environment variable %q is not set", p.UsernameVar)
+	}
+
+	password := os.Getenv(p.PasswordVar)
+	if password == "" {
+		return "", "", fmt.Errorf("environment variable %q is not set", p.PasswordVar)
+	}
+
+	return username, password, nil
+}
@@ -0,0 +1,58 @@
+package envoy_test
+
+import (
+	"os"
+
+	"github.com/pivotal-cf-experimental/envoy"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("StaticCredentialsProvider", func() {
+	It("provides its credentials", func() {
+		provider := envoy.StaticCredentialsProvider{Username: "admin", Password: "secret"}
+
+		username, password, err := provider.ProvideCredentials()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(username).To(Equal("admin"))
+		Expect(password).To(Equal("secret"))
+	})
+})
+
+var _ = Describe("EnvCredentialsProvider", func() {
+	var provider envoy.EnvCredentialsProvider
+
+	BeforeEach(func() {
+		provider = envoy.NewEnvCredentialsProvider("ENVOY_TEST_USERNAME", "ENVOY_TEST_PASSWORD")
+		os.Setenv("ENVOY_TEST_USERNAME", "admin")
+		os.Setenv("ENVOY_TEST_PASSWORD", "secret")
+	})
+
+	AfterEach(func() {
+		os.Unsetenv("ENVOY_TEST_USERNAME")
+		os.Unsetenv("ENVOY_TEST_PASSWORD")
+	})
+
+	It("provides the credentials from the environment", func() {
+		username, password, err := provider.ProvideCredentials()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(username).To(Equal("admin"))
+		Expect(password).To(Equal("secret"))
+	})
+
+	It("reads the environment each time", func() {
+		os.Setenv("ENVOY_TEST_PASSWORD", "rotated")
+
+		_, password, err := provider.ProvideCredentials()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(password).To(Equal("rotated"))
+	})
+
+	It("returns an error when a variable is not set", func() {
+		os.Unsetenv("ENVOY_TEST_PASSWORD")
+
+		_, _, err := provider.ProvideCredentials()
+		Expect(err).To(MatchError(`environment variable "ENVOY_TEST_PASSWORD" is not set`))
+	})
+})
@@ -0,0 +1,47 @@
+package domain
+
+import "time"
+
+// AuditPhase describes whether an audit record was written before or
+// after the operation it describes.
+type AuditPhase string
+
+const (
+	// AuditPhaseBefore is used for records written before the broker
+	// performs the operation.
+	AuditPhaseBefore AuditPhase = "before"
+
+	// AuditPhaseAfter is used for records written once the response to
+	// the operation is known.
+	AuditPhaseAfter AuditPhase = "after"
+)
+
+// AuditRecord describes a mutating operation performed by the service
+// broker. It includes the metadata of the request, but never its body,
+// so that secrets such as parameters are not recorded.
+type AuditRecord struct {
+	// Time is when the record was created.
+	Time time.Time `json:"time"`
+
+	// Phase is whether the record was written before or after the
+	// operation.
+	Phase AuditPhase `json:"phase"`
+
+	// Operation is the kind of operation, such as "provision" or
+	// "bind".
+	Operation string `json:"operation"`
+
+	// Method is the HTTP method of the request.
+	Method string `json:"method"`
+
+	// Path is the path of the request, which identifies the service
+	// instance and service binding being operated on.
+	Path string `json:"path"`
+
+	// RequestID is the identity of the request, when there is one.
+	RequestID string `json:"request_id,omitempty"`
+
+	// Status is the HTTP status code of the response. It is only set
+	// for records written after the operation.
+	Status int `json:"status,omitempty"`
+}
@@ -1,5 +1,13 @@
 package domain
 
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
 // BindRequest encapsulates the request payload information
 // for a bind request.
 type BindRequest struct {
@@ -23,7 +31,83 @@ type BindRequest struct {
 
 	// AppGUID is the GUID value of the application that the
 	// service instance is to be bound to in this bind request.
+	// When the request does not include it at the top level, it
+	// is taken from the bind_resource.
 	AppGUID string
+
+	// BindResource describes the resource that the service
+	// instance is to be bound to, such as an application or a
+	// route. This field is optional.
+	BindResource *BindResource
+
+	// Context is platform specific contextual information about the
+	// service binding. For a shared service instance, it may describe
+	// a different space than the one the instance was provisioned
+	// into. This field is optional.
+	Context map[string]interface{}
+
+	// Parameters is the set of configuration parameters for the
+	// service binding, such as the "mount" path of a volume mount.
+	// This field is optional.
+	Parameters map[string]interface{}
+
+	// AcceptsIncomplete indicates that the client is willing to
+	// accept an asynchronous response to this bind request.
+	// When it is false, a binder that can only bind
+	// asynchronously should return an AsyncRequiredError.
+	AcceptsIncomplete bool
+}
+
+// BindResource describes the resource that a service instance is
+// bound to.
+type BindResource struct {
+	// AppGUID is the GUID value of the application that the
+	// service instance is to be bound to. This field is optional.
+	AppGUID string `json:"app_guid,omitempty"`
+
+	// SpaceGUID is the GUID value of the space of the resource,
+	// such as for a service key. This field is optional.
+	SpaceGUID string `json:"space_guid,omitempty"`
+
+	// Route is the URL of the route that requests are to be
+	// proxied from, for a route service binding. This field is
+	// optional.
+	Route string `json:"route,omitempty"`
+
+	// CredentialClientID is the ID of the OAuth client that the
+	// platform uses for the binding. This field is optional.
+	CredentialClientID string `json:"credential_client_id,omitempty"`
+}
+
+// RequestsVolumeMount reports whether the bind request asks for
+// a volume to be mounted into the bound application, which it
+// does by passing a "mount" parameter.
+func (r BindRequest) RequestsVolumeMount() bool {
+	_, ok := r.Parameters["mount"]
+	return ok
+}
+
+// Fingerprint returns a digest of the parameters of the bind request. A
+// binder can store it alongside a binding, and compare it to the
+// fingerprint of a later request for the same binding ID to determine
+// whether the request is an identical retry. The Parameters and the
+// BindResource are included, with the keys of the parameters in sorted
+// order so that their order in the request does not matter, and empty
+// parameters are treated as missing ones. The Context is not included, as
+// it may change between otherwise identical requests.
+func (r BindRequest) Fingerprint() string {
+	var bindParameters map[string]interface{}
+	if len(r.Parameters) > 0 {
+		bindParameters = r.Parameters
+	}
+
+	parameters, err := json.Marshal([]interface{}{r.InstanceID, r.BindingID, r.ServiceID, r.PlanID, r.AppGUID, r.BindResource, bindParameters})
+	if err != nil {
+		panic(err)
+	}
+
+	digest := sha256.Sum256(parameters)
+	return hex.EncodeToString(digest[:])
 }
 
 // BindResponse encapsulates the response payload information
@@ -36,8 +120,185 @@ type BindResponse struct {
 	// SyslogDrainURL is a URL to which CloudFoundry should
 	// drain logs for the bound application.
 	SyslogDrainURL string
+
+	// RouteServiceURL is a URL to which CloudFoundry should
+	// proxy requests for the bound route.
+	RouteServiceURL string
+
+	// VolumeMounts is a list of volumes that should be mounted
+	// into the containers of the bound application.
+	VolumeMounts []VolumeMount
+
+	// Endpoints is a list of network endpoints that the bound
+	// application will need to access in order to use the
+	// service.
+	Endpoints []Endpoint
+
+	// AlreadyExists indicates that the binding already existed
+	// with identical parameters, such as when the request is a
+	// retry. The binding is returned with a 200 OK rather than
+	// a 201 Created. A binding that already exists with
+	// different parameters should instead be reported with a
+	// ServiceBindingAlreadyExistsError.
+	AlreadyExists bool
+
+	// IsAsync indicates that the bind operation will be
+	// completed asynchronously. This may only be set when the
+	// request accepts incomplete responses. The rest of the
+	// response is not written to the client, which fetches the
+	// binding once the operation has succeeded.
+	IsAsync bool
+
+	// OperationData is an opaque value identifying the bind
+	// operation. It is returned to the client so that it can be
+	// provided when polling for the state of the operation.
+	OperationData string
+
+	// CredentialsProvider generates the credentials for the
+	// binding. It is only called once the binding is about to be
+	// written to the client, so that credentials that are
+	// expensive to generate are not generated for a response that
+	// is never written. When set, the credentials it returns
+	// replace Credentials. They must be a JSON object, such as a
+	// BindingCredentials or a struct. An error results in a 500
+	// Internal Server Error. This field is optional.
+	CredentialsProvider func() (interface{}, error)
+}
+
+// ProvideCredentials replaces the credentials of the response with
+// those returned by its CredentialsProvider, if it has one. An
+// error is returned if the provider fails, or if its credentials
+// are not a JSON object.
+func (r *BindResponse) ProvideCredentials() error {
+	if r.CredentialsProvider == nil {
+		return nil
+	}
+
+	provided, err := r.CredentialsProvider()
+	if err != nil {
+		return err
+	}
+
+	switch credentials := provided.(type) {
+	case nil:
+		r.Credentials = nil
+	case BindingCredentials:
+		r.Credentials = credentials
+	case map[string]interface{}:
+		r.Credentials = BindingCredentials(credentials)
+	default:
+		data, err := json.Marshal(credentials)
+		if err != nil {
+			return fmt.Errorf("binding credentials cannot be written as JSON: %s", err)
+		}
+
+		r.Credentials = BindingCredentials{}
+		if err := json.Unmarshal(data, &r.Credentials); err != nil {
+			return errors.New("binding credentials must be a JSON object")
+		}
+	}
+
+	return nil
+}
+
+// Body returns the representation of this bind response that
+// is written to the client. The credentials key is omitted when
+// no credentials are set, but an empty set of credentials is
+// written as {}.
+func (r BindResponse) Body() BindResponseBody {
+	body := BindResponseBody{
+		SyslogDrainURL:  r.SyslogDrainURL,
+		RouteServiceURL: r.RouteServiceURL,
+		VolumeMounts:    r.VolumeMounts,
+		Endpoints:       r.Endpoints,
+	}
+
+	if r.Credentials != nil {
+		credentials := r.Credentials
+		body.Credentials = &credentials
+	}
+
+	return body
+}
+
+// BindResponseBody is the JSON representation of a service
+// binding that is written in response to a bind request.
+type BindResponseBody struct {
+	Credentials     *BindingCredentials `json:"credentials,omitempty"`
+	SyslogDrainURL  string              `json:"syslog_drain_url,omitempty"`
+	RouteServiceURL string              `json:"route_service_url,omitempty"`
+	VolumeMounts    []VolumeMount       `json:"volume_mounts,omitempty"`
+	Endpoints       []Endpoint          `json:"endpoints,omitempty"`
 }
 
 // BindingCredentials is an open set of key-value fields used
 // to indicate credential information for a service binding.
+// Values may themselves be nested sets of fields, since the
+// credentials are passed to the application unmodified.
 type BindingCredentials map[string]interface{}
+
+// NewReadWriteCredentials returns credentials for a service that
+// provides separate read and write access, such as a database
+// with a read-only replica. The given sets of credentials are
+// nested under the "read" and "write" keys. Either may be nil,
+// in which case its key is omitted.
+func NewReadWriteCredentials(read, write BindingCredentials) BindingCredentials {
+	credentials := BindingCredentials{}
+	if read != nil {
+		credentials["read"] = read
+	}
+	if write != nil {
+		credentials["write"] = write
+	}
+
+	return credentials
+}
+
+// VolumeMount describes a volume that should be mounted into
+// the containers of a bound application.
+type VolumeMount struct {
+	// Driver is the name of the volume driver plugin that
+	// manages the volume.
+	Driver string `json:"driver"`
+
+	// ContainerDir is the path in the application container
+	// at which the volume should be mounted.
+	ContainerDir string `json:"container_dir"`
+
+	// Mode is either "r" for a read-only mount or "rw" for a
+	// read-write mount.
+	Mode string `json:"mode"`
+
+	// DeviceType is the type of the device. Only "shared" is
+	// currently supported.
+	DeviceType string `json:"device_type"`
+
+	// Device identifies the volume to be mounted.
+	Device VolumeMountDevice `json:"device"`
+}
+
+// VolumeMountDevice identifies the volume to be mounted by the
+// volume driver.
+type VolumeMountDevice struct {
+	// VolumeID is the ID of the shared volume to mount.
+	VolumeID string `json:"volume_id"`
+
+	// MountConfig is an open set of configuration passed to
+	// the volume driver. This field is optional.
+	MountConfig map[string]interface{} `json:"mount_config,omitempty"`
+}
+
+// Endpoint describes a network endpoint that the bound
+// application will need to access.
+type Endpoint struct {
+	// Host is a hostname or IP address of the endpoint.
+	Host string `json:"host"`
+
+	// Ports is a list of ports or port ranges, such as "443"
+	// or "9000-9999".
+	Ports []string `json:"ports"`
+
+	// Protocol is one of "tcp", "udp" or "all". This field
+	// is optional.
+	Protocol string `json:"protocol,omitempty"`
+}
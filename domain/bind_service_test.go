@@ -0,0 +1,239 @@
+package domain_test
+
+import (
+	"encoding/json"
+
+	"github.com/pivotal-cf-experimental/envoy/domain"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BindRequest", func() {
+	Describe("Fingerprint", func() {
+		var request domain.BindRequest
+
+		BeforeEach(func() {
+			request = domain.BindRequest{
+				BindingID:  "binding-id",
+				InstanceID: "instance-id",
+				ServiceID:  "service-id",
+				PlanID:     "plan-id",
+				AppGUID:    "app-guid",
+			}
+		})
+
+		It("is the same for identical requests", func() {
+			other := request
+			other.Context = map[string]interface{}{"platform": "cloudfoundry"}
+
+			Expect(request.Fingerprint()).To(Equal(other.Fingerprint()))
+		})
+
+		It("differs when the parameters differ", func() {
+			other := request
+			other.AppGUID = "other-app-guid"
+
+			Expect(request.Fingerprint()).NotTo(Equal(other.Fingerprint()))
+		})
+
+		It("differs when only the bind parameters differ", func() {
+			request.Parameters = map[string]interface{}{"mount": "/var/vcap/data/a"}
+			other := request
+			other.Parameters = map[string]interface{}{"mount": "/var/vcap/data/b"}
+
+			Expect(request.Fingerprint()).NotTo(Equal(other.Fingerprint()))
+		})
+
+		It("differs when only the bind resource differs", func() {
+			request.BindResource = &domain.BindResource{Route: "https://a.example.com"}
+			other := request
+			other.BindResource = &domain.BindResource{Route: "https://b.example.com"}
+
+			Expect(request.Fingerprint()).NotTo(Equal(other.Fingerprint()))
+		})
+
+		It("does not depend on the order of the bind parameters", func() {
+			request.Parameters = map[string]interface{}{"a": 1.0, "b": map[string]interface{}{"c": "d", "e": "f"}}
+			other := request
+			other.Parameters = map[string]interface{}{"b": map[string]interface{}{"e": "f", "c": "d"}, "a": 1.0}
+
+			Expect(request.Fingerprint()).To(Equal(other.Fingerprint()))
+		})
+
+		It("treats empty bind parameters as missing", func() {
+			other := request
+			other.Parameters = map[string]interface{}{}
+
+			Expect(request.Fingerprint()).To(Equal(other.Fingerprint()))
+		})
+
+		It("is not confused by values that run together", func() {
+			first := domain.BindRequest{ServiceID: "ab", PlanID: "c"}
+			second := domain.BindRequest{ServiceID: "a", PlanID: "bc"}
+
+			Expect(first.Fingerprint()).NotTo(Equal(second.Fingerprint()))
+		})
+	})
+})
+
+var _ = Describe("BindResponseBody", func() {
+	It("can be correctly represented in JSON with all fields", func() {
+		response := domain.BindResponse{
+			Credentials: domain.BindingCredentials{
+				"username": "user",
+				"password": "secret",
+			},
+			SyslogDrainURL:  "syslog://logs.example.com",
+			RouteServiceURL: "https://route-service.example.com",
+			VolumeMounts: []domain.VolumeMount{
+				{
+					Driver:       "nfsdriver",
+					ContainerDir: "/var/vcap/data/volume",
+					Mode:         "rw",
+					DeviceType:   "shared",
+					Device: domain.VolumeMountDevice{
+						VolumeID: "volume-1",
+						MountConfig: map[string]interface{}{
+							"source": "nfs://nfs.example.com/export",
+						},
+					},
+				},
+			},
+			Endpoints: []domain.Endpoint{
+				{
+					Host:     "db.example.com",
+					Ports:    []string{"5432", "9000-9999"},
+					Protocol: "tcp",
+				},
+			},
+		}
+
+		document, err := json.Marshal(response.Body())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(document).To(MatchJSON(`{
+			"credentials": {
+				"username": "user",
+				"password": "secret"
+			},
+			"syslog_drain_url": "syslog://logs.example.com",
+			"route_service_url": "https://route-service.example.com",
+			"volume_mounts": [
+				{
+					"driver": "nfsdriver",
+					"container_dir": "/var/vcap/data/volume",
+					"mode": "rw",
+					"device_type": "shared",
+					"device": {
+						"volume_id": "volume-1",
+						"mount_config": {
+							"source": "nfs://nfs.example.com/export"
+						}
+					}
+				}
+			],
+			"endpoints": [
+				{
+					"host": "db.example.com",
+					"ports": ["5432", "9000-9999"],
+					"protocol": "tcp"
+				}
+			]
+		}`))
+	})
+
+	It("omits all of the optional fields when they are empty", func() {
+		document, err := json.Marshal(domain.BindResponse{}.Body())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(document).To(MatchJSON(`{}`))
+	})
+
+	It("omits the credentials when they are nil", func() {
+		document, err := json.Marshal(domain.BindResponse{Credentials: nil}.Body())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(document).To(MatchJSON(`{}`))
+	})
+
+	It("writes empty credentials as an empty object", func() {
+		document, err := json.Marshal(domain.BindResponse{Credentials: domain.BindingCredentials{}}.Body())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(document).To(MatchJSON(`{"credentials": {}}`))
+	})
+
+	It("writes nested read and write credentials", func() {
+		credentials := domain.NewReadWriteCredentials(
+			domain.BindingCredentials{"username": "reader", "password": "read-secret", "host": "replica.example.com"},
+			domain.BindingCredentials{"username": "writer", "password": "write-secret", "host": "primary.example.com"},
+		)
+
+		document, err := json.Marshal(domain.BindResponse{Credentials: credentials}.Body())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(document).To(MatchJSON(`{
+			"credentials": {
+				"read": {
+					"username": "reader",
+					"password": "read-secret",
+					"host": "replica.example.com"
+				},
+				"write": {
+					"username": "writer",
+					"password": "write-secret",
+					"host": "primary.example.com"
+				}
+			}
+		}`))
+	})
+
+	It("omits a missing set of read or write credentials", func() {
+		credentials := domain.NewReadWriteCredentials(domain.BindingCredentials{"uri": "postgres://replica"}, nil)
+
+		document, err := json.Marshal(domain.BindResponse{Credentials: credentials}.Body())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(document).To(MatchJSON(`{"credentials": {"read": {"uri": "postgres://replica"}}}`))
+	})
+})
+
+var _ = Describe("BindResponse", func() {
+	Describe("ProvideCredentials", func() {
+		It("leaves the credentials alone without a provider", func() {
+			response := domain.BindResponse{Credentials: domain.BindingCredentials{"user": "admin"}}
+
+			Expect(response.ProvideCredentials()).To(Succeed())
+			Expect(response.Credentials).To(Equal(domain.BindingCredentials{"user": "admin"}))
+		})
+
+		It("replaces the credentials with those from the provider", func() {
+			response := domain.BindResponse{
+				CredentialsProvider: func() (interface{}, error) {
+					return domain.BindingCredentials{"password": "generated"}, nil
+				},
+			}
+
+			Expect(response.ProvideCredentials()).To(Succeed())
+			Expect(response.Credentials).To(Equal(domain.BindingCredentials{"password": "generated"}))
+		})
+
+		It("converts credentials provided as a struct", func() {
+			response := domain.BindResponse{
+				CredentialsProvider: func() (interface{}, error) {
+					return struct {
+						Port int `json:"port"`
+					}{5432}, nil
+				},
+			}
+
+			Expect(response.ProvideCredentials()).To(Succeed())
+			Expect(response.Credentials).To(Equal(domain.BindingCredentials{"port": float64(5432)}))
+		})
+
+		It("returns an error for credentials that are not a JSON object", func() {
+			response := domain.BindResponse{
+				CredentialsProvider: func() (interface{}, error) {
+					return []string{"password"}, nil
+				},
+			}
+
+			Expect(response.ProvideCredentials()).To(MatchError("binding credentials must be a JSON object"))
+		})
+	})
+})
@@ -1,5 +1,11 @@
 package domain
 
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
 var (
 	_true         = true
 	_false        = false
@@ -15,6 +21,103 @@ type Catalog struct {
 	Services []Service `json:"services"`
 }
 
+// Validate returns an InvalidCatalogError if the catalog cannot be
+// served to CloudFoundry, such as when two services or two plans
+// share the same ID, or a plan declares a malformed schema.
+func (c Catalog) Validate() error {
+	serviceIDs := map[string]bool{}
+	planIDs := map[string]bool{}
+
+	for _, service := range c.Services {
+		if serviceIDs[service.ID] {
+			return InvalidCatalogError(fmt.Sprintf("duplicate service ID %q", service.ID))
+		}
+		serviceIDs[service.ID] = true
+
+		for _, plan := range service.Plans {
+			if planIDs[plan.ID] {
+				return InvalidCatalogError(fmt.Sprintf("duplicate plan ID %q", plan.ID))
+			}
+			planIDs[plan.ID] = true
+
+			if plan.Schemas != nil {
+				if err := plan.Schemas.Validate(); err != nil {
+					return InvalidCatalogError(fmt.Sprintf("plan %q: %s", plan.ID, err))
+				}
+			}
+
+			if plan.SyncOnly && plan.AsyncOnly {
+				return InvalidCatalogError(fmt.Sprintf("plan %q is declared both synchronous-only and asynchronous-only", plan.ID))
+			}
+		}
+	}
+
+	return nil
+}
+
+// ValidateSchemaSizes returns an InvalidCatalogError if any plan declares
+// a schema that is larger than the limit, in bytes, when written as JSON.
+func (c Catalog) ValidateSchemaSizes(limit int) error {
+	for _, service := range c.Services {
+		for _, plan := range service.Plans {
+			if plan.Schemas == nil {
+				continue
+			}
+
+			if err := plan.Schemas.ValidateSize(limit); err != nil {
+				return InvalidCatalogError(fmt.Sprintf("plan %q: %s", plan.ID, err))
+			}
+		}
+	}
+
+	return nil
+}
+
+// CatalogFromJSON reads a catalog authored as JSON, in the same format that
+// is served to CloudFoundry, and validates it. An InvalidCatalogError is
+// returned if the JSON is malformed or the catalog is not valid.
+func CatalogFromJSON(r io.Reader) (Catalog, error) {
+	var catalog Catalog
+	if err := json.NewDecoder(r).Decode(&catalog); err != nil {
+		return Catalog{}, InvalidCatalogError(fmt.Sprintf("malformed catalog JSON: %s", err))
+	}
+
+	if err := catalog.Validate(); err != nil {
+		return Catalog{}, err
+	}
+
+	return catalog, nil
+}
+
+// FindService returns the service with the given ID, and whether such a
+// service was found.
+func (c Catalog) FindService(serviceID string) (Service, bool) {
+	for _, service := range c.Services {
+		if service.ID == serviceID {
+			return service, true
+		}
+	}
+
+	return Service{}, false
+}
+
+// FindPlan returns the plan with the given ID belonging to the service
+// with the given ID, and whether such a plan was found.
+func (c Catalog) FindPlan(serviceID, planID string) (Plan, bool) {
+	service, ok := c.FindService(serviceID)
+	if !ok {
+		return Plan{}, false
+	}
+
+	for _, plan := range service.Plans {
+		if plan.ID == planID {
+			return plan, true
+		}
+	}
+
+	return Plan{}, false
+}
+
 // Service is the information for a single service provided by
 // the service broker.
 type Service struct {
@@ -57,6 +160,32 @@ type Service struct {
 	// DashboardClient contains the data necessary to activate the
 	// Dashboard SSO feature for this service. This field is optional.
 	DashboardClient *DashboardClient `json:"dashboard_client,omitempty"`
+
+	// PlanUpdateable indicates whether instances of this service can
+	// be updated to a different plan. This field is optional.
+	PlanUpdateable bool `json:"plan_updateable,omitempty"`
+
+	// AllowContextUpdates indicates whether the platform may send an
+	// update request that changes only the context of a service
+	// instance, such as when its space is renamed. This field is
+	// optional.
+	AllowContextUpdates bool `json:"allow_context_updates,omitempty"`
+}
+
+// HasUpdateablePlans reports whether the service, or any of its plans,
+// declares that instances can be updated to a different plan.
+func (s Service) HasUpdateablePlans() bool {
+	if s.PlanUpdateable {
+		return true
+	}
+
+	for _, plan := range s.Plans {
+		if plan.PlanUpdateable != nil && *plan.PlanUpdateable {
+			return true
+		}
+	}
+
+	return false
 }
 
 // ServiceMetadata is a collection of fields that provide extra metadata
@@ -81,6 +210,25 @@ type ServiceMetadata struct {
 
 	// SupportURL is a URL to support for the service.
 	SupportURL string `json:"supportUrl"`
+
+	// Shareable indicates whether instances of the service may be shared
+	// with other spaces. This field is optional.
+	Shareable *bool `json:"shareable,omitempty"`
+}
+
+// SetShareable sets whether instances of the service may be shared with
+// other spaces, creating the service metadata if it is not already set.
+func (s *Service) SetShareable(shareable bool) {
+	if s.Metadata == nil {
+		s.Metadata = &ServiceMetadata{}
+	}
+	s.Metadata.Shareable = &shareable
+}
+
+// IsShareable reports whether instances of the service may be shared with
+// other spaces.
+func (s Service) IsShareable() bool {
+	return s.Metadata != nil && s.Metadata.Shareable != nil && *s.Metadata.Shareable
 }
 
 // Plan is the information for a service plan provided by the service
@@ -107,6 +255,73 @@ type Plan struct {
 	// Metadata is a list of metadata for a service plan. This field is
 	// optional.
 	Metadata *PlanMetadata `json:"metadata,omitempty"`
+
+	// MaintenanceInfo describes the version of the plan's software. When
+	// present, provision requests that specify a different version are
+	// rejected. This field is optional.
+	MaintenanceInfo *MaintenanceInfo `json:"maintenance_info,omitempty"`
+
+	// PlanUpdateable overrides the PlanUpdateable field of the
+	// service for this plan. This field is optional.
+	PlanUpdateable *bool `json:"plan_updateable,omitempty"`
+
+	// Schemas describes the parameters accepted by the plan. Each
+	// schema must be a well-formed JSON Schema document. This field is
+	// optional.
+	Schemas *Schemas `json:"schemas,omitempty"`
+
+	// SyncOnly indicates that the broker only provisions, updates and
+	// deprovisions instances of this plan synchronously. Requests for the
+	// plan are passed to the broker with AcceptsIncomplete set to false,
+	// even when the client accepts incomplete operations, and are always
+	// answered with a synchronous response. This field is not part of the
+	// catalog served to clients.
+	SyncOnly bool `json:"-"`
+
+	// AsyncOnly indicates that the broker only provisions, updates and
+	// deprovisions instances of this plan asynchronously. Requests for
+	// the plan that do not accept incomplete operations are rejected with
+	// a 422 AsyncRequired before they reach the broker. A plan cannot be
+	// both SyncOnly and AsyncOnly. This field is not part of the catalog
+	// served to clients.
+	AsyncOnly bool `json:"-"`
+}
+
+// EffectiveUpdateable reports whether instances of the plan can be updated
+// to a different plan. Plans that do not set PlanUpdateable inherit it from
+// the service they belong to.
+func (p Plan) EffectiveUpdateable(service Service) bool {
+	if p.PlanUpdateable != nil {
+		return *p.PlanUpdateable
+	}
+
+	return service.PlanUpdateable
+}
+
+// IsSyncOnly reports whether the plan with the given ID belonging to the
+// service with the given ID is declared synchronous-only.
+func (c Catalog) IsSyncOnly(serviceID, planID string) bool {
+	plan, ok := c.FindPlan(serviceID, planID)
+	return ok && plan.SyncOnly
+}
+
+// IsAsyncOnly reports whether the plan with the given ID belonging to the
+// service with the given ID is declared asynchronous-only.
+func (c Catalog) IsAsyncOnly(serviceID, planID string) bool {
+	plan, ok := c.FindPlan(serviceID, planID)
+	return ok && plan.AsyncOnly
+}
+
+// MaintenanceInfo describes the version of the software that a service
+// plan provides.
+type MaintenanceInfo struct {
+	// Version is a semantic version string describing the software
+	// version of the plan.
+	Version string `json:"version,omitempty"`
+
+	// Description is a human-readable summary of the changes in this
+	// version. This field is optional.
+	Description string `json:"description,omitempty"`
 }
 
 // PlanMetadata is a collection of fields that provide extra metadata
@@ -2,6 +2,7 @@ package domain_test
 
 import (
 	"encoding/json"
+	"strings"
 
 	"github.com/pivotal-cf-experimental/envoy/domain"
 
@@ -181,4 +182,372 @@ var _ = Describe("Catalog", func() {
 			`)))
 		})
 	})
+
+	Context("service tags", func() {
+		It("serializes the tags in order", func() {
+			service := domain.Service{
+				ID:          "test-service",
+				Name:        "my-test",
+				Description: "Testing the catalog",
+				Tags:        []string{"mysql", "relational"},
+				Plans:       []domain.Plan{},
+			}
+
+			document, err := json.Marshal(service)
+			Expect(err).NotTo(HaveOccurred())
+
+			var representation struct {
+				Tags []string `json:"tags"`
+			}
+			Expect(json.Unmarshal(document, &representation)).To(Succeed())
+			Expect(representation.Tags).To(Equal([]string{"mysql", "relational"}))
+		})
+
+		It("omits the tags key when the service is untagged", func() {
+			service := domain.Service{
+				ID:          "test-service",
+				Name:        "my-test",
+				Description: "Testing the catalog",
+				Plans:       []domain.Plan{},
+			}
+
+			document, err := json.Marshal(service)
+			Expect(err).NotTo(HaveOccurred())
+
+			var representation map[string]interface{}
+			Expect(json.Unmarshal(document, &representation)).To(Succeed())
+			Expect(representation).NotTo(HaveKey("tags"))
+		})
+	})
+
+	Describe("Validate", func() {
+		It("accepts a catalog with unique service and plan IDs", func() {
+			catalog = domain.Catalog{
+				Services: []domain.Service{
+					{ID: "service-1", Plans: []domain.Plan{{ID: "plan-1"}}},
+					{ID: "service-2", Plans: []domain.Plan{{ID: "plan-2"}}},
+				},
+			}
+
+			Expect(catalog.Validate()).To(Succeed())
+		})
+
+		It("rejects a catalog with duplicate service IDs", func() {
+			catalog = domain.Catalog{
+				Services: []domain.Service{
+					{ID: "service-1"},
+					{ID: "service-1"},
+				},
+			}
+
+			Expect(catalog.Validate()).To(MatchError(domain.InvalidCatalogError(`duplicate service ID "service-1"`)))
+		})
+
+		It("rejects a catalog with a plan that has a malformed schema", func() {
+			catalog := domain.Catalog{
+				Services: []domain.Service{
+					{
+						ID: "service-1",
+						Plans: []domain.Plan{
+							{
+								ID: "plan-1",
+								Schemas: &domain.Schemas{
+									ServiceInstance: &domain.ServiceInstanceSchema{
+										Create: &domain.InputParametersSchema{
+											Parameters: map[string]interface{}{"type": 42},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			}
+
+			Expect(catalog.Validate()).To(MatchError(domain.InvalidCatalogError(
+				`plan "plan-1": invalid schema: service_instance.create.parameters.type must be a string or an array of strings`)))
+		})
+
+		It("rejects a catalog with duplicate plan IDs across services", func() {
+			catalog = domain.Catalog{
+				Services: []domain.Service{
+					{ID: "service-1", Plans: []domain.Plan{{ID: "plan-1"}}},
+					{ID: "service-2", Plans: []domain.Plan{{ID: "plan-1"}}},
+				},
+			}
+
+			Expect(catalog.Validate()).To(MatchError(domain.InvalidCatalogError(`duplicate plan ID "plan-1"`)))
+		})
+
+		It("rejects a plan declared both synchronous-only and asynchronous-only", func() {
+			catalog = domain.Catalog{
+				Services: []domain.Service{
+					{ID: "service-1", Plans: []domain.Plan{{ID: "plan-1", SyncOnly: true, AsyncOnly: true}}},
+				},
+			}
+
+			Expect(catalog.Validate()).To(MatchError(domain.InvalidCatalogError(`plan "plan-1" is declared both synchronous-only and asynchronous-only`)))
+		})
+	})
+
+	Describe("ValidateSchemaSizes", func() {
+		var catalog domain.Catalog
+
+		BeforeEach(func() {
+			catalog = domain.Catalog{
+				Services: []domain.Service{
+					{
+						ID: "service-1",
+						Plans: []domain.Plan{
+							{ID: "plan-without-schemas"},
+							{
+								ID: "plan-1",
+								Schemas: &domain.Schemas{
+									ServiceBinding: &domain.ServiceBindingSchema{
+										Create: &domain.InputParametersSchema{
+											Parameters: map[string]interface{}{"type": "object"},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			}
+		})
+
+		It("accepts schemas within the limit", func() {
+			Expect(catalog.ValidateSchemaSizes(17)).To(Succeed())
+		})
+
+		It("rejects a schema over the limit", func() {
+			Expect(catalog.ValidateSchemaSizes(16)).To(MatchError(domain.InvalidCatalogError(
+				`plan "plan-1": service_binding.create.parameters: schema is 17 bytes, more than the limit of 16 bytes`)))
+		})
+	})
+
+	Describe("CatalogFromJSON", func() {
+		It("parses a catalog authored as JSON", func() {
+			catalog, err := domain.CatalogFromJSON(strings.NewReader(`{
+				"services": [
+					{
+						"id": "service-1",
+						"name": "first",
+						"description": "The first service",
+						"bindable": true,
+						"tags": ["fast"],
+						"plans": [
+							{
+								"id": "plan-1",
+								"name": "free",
+								"description": "A free plan",
+								"free": true
+							}
+						]
+					}
+				]
+			}`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(catalog).To(Equal(domain.Catalog{
+				Services: []domain.Service{
+					{
+						ID:          "service-1",
+						Name:        "first",
+						Description: "The first service",
+						Bindable:    true,
+						Tags:        []string{"fast"},
+						Plans: []domain.Plan{
+							{
+								ID:          "plan-1",
+								Name:        "free",
+								Description: "A free plan",
+								Free:        domain.FreeTrue,
+							},
+						},
+					},
+				},
+			}))
+		})
+
+		It("returns an error when the JSON is malformed", func() {
+			_, err := domain.CatalogFromJSON(strings.NewReader(`{"services": [`))
+			Expect(err).To(BeAssignableToTypeOf(domain.InvalidCatalogError("")))
+			Expect(err.Error()).To(HavePrefix("malformed catalog JSON"))
+		})
+
+		It("returns an error when the catalog is not valid", func() {
+			_, err := domain.CatalogFromJSON(strings.NewReader(`{
+				"services": [
+					{"id": "service-1", "plans": []},
+					{"id": "service-1", "plans": []}
+				]
+			}`))
+			Expect(err).To(MatchError(`duplicate service ID "service-1"`))
+		})
+	})
+
+	Context("context updates", func() {
+		It("serializes allow_context_updates when it is set", func() {
+			service := domain.Service{
+				ID:                  "test-service",
+				Name:                "my-test",
+				Plans:               []domain.Plan{},
+				AllowContextUpdates: true,
+			}
+
+			Expect(json.Marshal(service)).To(MatchJSON(`{
+				"id": "test-service",
+				"name": "my-test",
+				"description": "",
+				"bindable": false,
+				"plans": [],
+				"allow_context_updates": true
+			}`))
+		})
+
+		It("omits allow_context_updates when it is not set", func() {
+			document, err := json.Marshal(domain.Service{ID: "test-service"})
+			Expect(err).NotTo(HaveOccurred())
+
+			var representation map[string]interface{}
+			Expect(json.Unmarshal(document, &representation)).To(Succeed())
+			Expect(representation).NotTo(HaveKey("allow_context_updates"))
+		})
+	})
+
+	Describe("HasUpdateablePlans", func() {
+		It("is true when the service is plan updateable", func() {
+			service := domain.Service{PlanUpdateable: true}
+			Expect(service.HasUpdateablePlans()).To(BeTrue())
+		})
+
+		It("is true when one of the plans is plan updateable", func() {
+			updateable := true
+			service := domain.Service{Plans: []domain.Plan{{}, {PlanUpdateable: &updateable}}}
+			Expect(service.HasUpdateablePlans()).To(BeTrue())
+		})
+
+		It("is false when neither the service nor its plans are plan updateable", func() {
+			updateable := false
+			service := domain.Service{Plans: []domain.Plan{{PlanUpdateable: &updateable}}}
+			Expect(service.HasUpdateablePlans()).To(BeFalse())
+		})
+	})
+
+	Describe("EffectiveUpdateable", func() {
+		It("inherits plan_updateable from the service when the plan does not set it", func() {
+			Expect(domain.Plan{}.EffectiveUpdateable(domain.Service{PlanUpdateable: true})).To(BeTrue())
+			Expect(domain.Plan{}.EffectiveUpdateable(domain.Service{})).To(BeFalse())
+		})
+
+		It("uses the plan's own plan_updateable when it is set", func() {
+			updateable, notUpdateable := true, false
+			Expect(domain.Plan{PlanUpdateable: &notUpdateable}.EffectiveUpdateable(domain.Service{PlanUpdateable: true})).To(BeFalse())
+			Expect(domain.Plan{PlanUpdateable: &updateable}.EffectiveUpdateable(domain.Service{})).To(BeTrue())
+		})
+	})
+
+	Describe("SetShareable", func() {
+		It("marks the service as shareable in its metadata", func() {
+			service := domain.Service{ID: "service-1"}
+			Expect(service.IsShareable()).To(BeFalse())
+
+			service.SetShareable(true)
+			Expect(service.IsShareable()).To(BeTrue())
+
+			document, err := json.Marshal(service.Metadata)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(document).To(MatchJSON(`{
+				"displayName": "",
+				"imageUrl": "",
+				"longDescription": "",
+				"providerDisplayName": "",
+				"documentationUrl": "",
+				"supportUrl": "",
+				"shareable": true
+			}`))
+		})
+	})
+
+	Describe("FindPlan", func() {
+		BeforeEach(func() {
+			catalog = domain.Catalog{
+				Services: []domain.Service{
+					{ID: "service-1", Plans: []domain.Plan{{ID: "plan-1", Name: "first"}}},
+					{ID: "service-2", Plans: []domain.Plan{{ID: "plan-2", Name: "second"}}},
+				},
+			}
+		})
+
+		It("finds a plan belonging to the service", func() {
+			plan, ok := catalog.FindPlan("service-2", "plan-2")
+			Expect(ok).To(BeTrue())
+			Expect(plan.Name).To(Equal("second"))
+		})
+
+		It("does not find a plan belonging to a different service", func() {
+			_, ok := catalog.FindPlan("service-1", "plan-2")
+			Expect(ok).To(BeFalse())
+		})
+
+		It("finds a service by ID", func() {
+			service, ok := catalog.FindService("service-2")
+			Expect(ok).To(BeTrue())
+			Expect(service.Plans[0].Name).To(Equal("second"))
+
+			_, ok = catalog.FindService("service-3")
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Describe("IsSyncOnly", func() {
+		catalog := domain.Catalog{
+			Services: []domain.Service{
+				{
+					ID: "service-1",
+					Plans: []domain.Plan{
+						{ID: "sync-plan", SyncOnly: true},
+						{ID: "async-plan"},
+					},
+				},
+			},
+		}
+
+		It("is true for a plan declared synchronous-only", func() {
+			Expect(catalog.IsSyncOnly("service-1", "sync-plan")).To(BeTrue())
+		})
+
+		It("is false for other plans", func() {
+			Expect(catalog.IsSyncOnly("service-1", "async-plan")).To(BeFalse())
+			Expect(catalog.IsSyncOnly("service-1", "unknown-plan")).To(BeFalse())
+		})
+
+		It("is not included in the catalog JSON", func() {
+			Expect(json.Marshal(catalog.Services[0].Plans[0])).To(MatchJSON(`{"id": "sync-plan", "name": "", "description": ""}`))
+		})
+	})
+
+	It("serializes plan maintenance info", func() {
+		plan := domain.Plan{
+			ID:          "plan-1",
+			Name:        "first",
+			Description: "The first plan",
+			MaintenanceInfo: &domain.MaintenanceInfo{
+				Version:     "1.2.3",
+				Description: "Patches a security vulnerability",
+			},
+		}
+
+		document, err := json.Marshal(plan)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(document).To(MatchJSON(`{
+			"id": "plan-1",
+			"name": "first",
+			"description": "The first plan",
+			"maintenance_info": {
+				"version": "1.2.3",
+				"description": "Patches a security vulnerability"
+			}
+		}`))
+	})
 })
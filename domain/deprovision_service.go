@@ -16,4 +16,24 @@ type DeprovisionRequest struct {
 	// service catalog. This plan was specified when the
 	// service instance was provisioned.
 	PlanID string
+
+	// AcceptsIncomplete indicates that the client is willing to
+	// accept an asynchronous response to this deprovision request.
+	// When it is false, a deprovisioner that can only deprovision
+	// asynchronously should return an AsyncRequiredError.
+	AcceptsIncomplete bool
+}
+
+// DeprovisionResponse encapsulates the response information for a
+// deprovision request.
+type DeprovisionResponse struct {
+	// IsAsync indicates that the deprovision operation will be
+	// completed asynchronously. This may only be set when the
+	// request accepts incomplete responses.
+	IsAsync bool
+
+	// OperationData is an opaque value identifying the deprovision
+	// operation. It is returned to the client so that it can be
+	// provided when polling for the state of the operation.
+	OperationData string
 }
@@ -1,10 +1,11 @@
 package domain
 
-var ()
+import "time"
 
 // ServiceInstanceAlreadyExistsError is an error type used to
-//indicate that this service instance has already been
-// provisioned.
+// indicate that this service instance has already been
+// provisioned. When the message is not empty, it is included
+// as the description in the body of the 409 response.
 type ServiceInstanceAlreadyExistsError string
 
 // Error returns a string representation of the error message.
@@ -13,8 +14,9 @@ func (e ServiceInstanceAlreadyExistsError) Error() string {
 }
 
 // ServiceInstanceNotFoundError is an error type used to indicate
-// that the service instance requested for deprovisioning cannot
-// be found.
+// that the service instance requested cannot be found. When
+// fetching a service instance, this indicates that the instance
+// never existed.
 type ServiceInstanceNotFoundError string
 
 // Error returns a string representation of the error message.
@@ -22,6 +24,16 @@ func (e ServiceInstanceNotFoundError) Error() string {
 	return string(e)
 }
 
+// ServiceInstanceGoneError is an error type used to indicate
+// that the service instance requested was known to the broker
+// but has since been deprovisioned.
+type ServiceInstanceGoneError string
+
+// Error returns a string representation of the error message.
+func (e ServiceInstanceGoneError) Error() string {
+	return string(e)
+}
+
 // ServiceBindingAlreadyExistsError is an error type used to
 // indicate that this service binding already exists.
 type ServiceBindingAlreadyExistsError string
@@ -40,3 +52,91 @@ type ServiceBindingNotFoundError string
 func (s ServiceBindingNotFoundError) Error() string {
 	return "The service binding was not found."
 }
+
+// AsyncRequiredError is an error type used to indicate that the
+// requested operation can only be completed asynchronously, but
+// the request did not indicate that it accepts an incomplete
+// response.
+type AsyncRequiredError string
+
+// Error returns a string representation of the error message.
+func (e AsyncRequiredError) Error() string {
+	return string(e)
+}
+
+// InvalidCatalogError is an error type used to indicate that the
+// catalog provided by the service broker is not valid.
+type InvalidCatalogError string
+
+// Error returns a string representation of the error message.
+func (e InvalidCatalogError) Error() string {
+	return string(e)
+}
+
+// MaintenanceInfoConflictError is an error type used to indicate
+// that the maintenance_info provided in a request does not match
+// the maintenance_info for the plan in the catalog.
+type MaintenanceInfoConflictError string
+
+// Error returns a string representation of the error message.
+func (e MaintenanceInfoConflictError) Error() string {
+	return string(e)
+}
+
+// InvalidOperationError is an error type used to indicate that
+// the operation data provided by a client could not be decoded.
+type InvalidOperationError string
+
+// Error returns a string representation of the error message.
+func (e InvalidOperationError) Error() string {
+	return string(e)
+}
+
+// UnknownPlanError is an error type used to indicate that the
+// service and plan requested are not in the catalog.
+type UnknownPlanError string
+
+// Error returns a string representation of the error message.
+func (e UnknownPlanError) Error() string {
+	return string(e)
+}
+
+// ServiceUnavailableError is an error type used to indicate that
+// the backend of the service broker is temporarily unavailable,
+// so that the client should retry the request later rather than
+// treating the operation as failed.
+type ServiceUnavailableError struct {
+	// Message describes why the service is unavailable.
+	Message string
+
+	// RetryAfter is how long the client should wait before
+	// retrying. It is sent in the Retry-After header, rounded up
+	// to whole seconds. This field is optional.
+	RetryAfter time.Duration
+}
+
+// Error returns a string representation of the error message.
+func (e ServiceUnavailableError) Error() string {
+	return e.Message
+}
+
+// OperationNotFoundError is an error type used to indicate that
+// there is no operation recorded for a service instance, or that
+// the operation being polled is not known to the broker, such as
+// after a restart that lost its state.
+type OperationNotFoundError string
+
+// Error returns a string representation of the error message.
+func (e OperationNotFoundError) Error() string {
+	return string(e)
+}
+
+// OperationInProgressError is an error type used to indicate that
+// a new operation cannot be started on a service instance because
+// an earlier operation is still in progress.
+type OperationInProgressError string
+
+// Error returns a string representation of the error message.
+func (e OperationInProgressError) Error() string {
+	return string(e)
+}
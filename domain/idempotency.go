@@ -0,0 +1,15 @@
+package domain
+
+// IdempotentResponse is a response to a mutating request that was made
+// with an Idempotency-Key header. It is replayed to the client when the
+// request is retried with the same key.
+type IdempotentResponse struct {
+	// Status is the HTTP status code of the response.
+	Status int
+
+	// Header holds the headers of the response.
+	Header map[string][]string
+
+	// Body is the body of the response.
+	Body []byte
+}
@@ -0,0 +1,55 @@
+package domain
+
+import "time"
+
+// ServiceInstanceDetailsRequest encapsulates the request information
+// for a request to fetch a service instance.
+type ServiceInstanceDetailsRequest struct {
+	// InstanceID is the ID value for the service instance
+	// to be fetched.
+	InstanceID string
+}
+
+// ServiceInstanceDetails encapsulates the response payload information
+// for a request to fetch a service instance.
+type ServiceInstanceDetails struct {
+	// ServiceID is the ID value of the service provided in
+	// the service catalog that this instance belongs to.
+	ServiceID string `json:"service_id,omitempty"`
+
+	// PlanID is the ID value of the plan provided in the
+	// service catalog that this instance is currently using.
+	// After an update changes the plan, this must be the new
+	// plan rather than the plan the instance was provisioned
+	// with.
+	PlanID string `json:"plan_id,omitempty"`
+
+	// DashboardURL is the URL of a web-based management user
+	// interface for the service instance.
+	DashboardURL string `json:"dashboard_url,omitempty"`
+
+	// Context is the contextual information that was provided when
+	// the service instance was provisioned. Returning it can help
+	// when debugging. This field is optional.
+	Context map[string]interface{} `json:"context,omitempty"`
+
+	// LastOperation describes the most recent operation on the
+	// service instance, such as for display on a dashboard. This
+	// field is optional.
+	LastOperation *InstanceLastOperation `json:"last_operation,omitempty"`
+}
+
+// InstanceLastOperation describes the most recent operation on a
+// service instance, as returned when the instance is fetched.
+type InstanceLastOperation struct {
+	// State is the state of the operation.
+	State LastOperationState `json:"state"`
+
+	// Description is a message for the user describing the
+	// operation. This field is optional.
+	Description string `json:"description,omitempty"`
+
+	// UpdatedAt is the time at which the state of the operation
+	// last changed. It is written in RFC 3339 format.
+	UpdatedAt time.Time `json:"updated_at"`
+}
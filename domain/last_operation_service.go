@@ -0,0 +1,64 @@
+package domain
+
+// LastOperationState is the state of an asynchronous operation on a
+// service instance.
+type LastOperationState string
+
+const (
+	// LastOperationInProgress indicates that the operation has not yet
+	// completed, and the client should continue polling.
+	LastOperationInProgress LastOperationState = "in progress"
+
+	// LastOperationSucceeded indicates that the operation completed
+	// successfully.
+	LastOperationSucceeded LastOperationState = "succeeded"
+
+	// LastOperationFailed indicates that the operation completed
+	// unsuccessfully.
+	LastOperationFailed LastOperationState = "failed"
+)
+
+// LastOperationRequest encapsulates the request information for a
+// request to poll the state of an asynchronous operation.
+type LastOperationRequest struct {
+	// InstanceID is the ID value for the service instance that
+	// the operation is being performed on.
+	InstanceID string
+
+	// ServiceID is the ID value of the service provided in the
+	// service catalog. This field is optional.
+	ServiceID string
+
+	// PlanID is the ID value of the plan provided in the service
+	// catalog. This field is optional.
+	PlanID string
+
+	// OperationData is the opaque value that was returned by the
+	// broker when the operation was started. This field is optional.
+	OperationData string
+}
+
+// LastOperationResponse encapsulates the response payload information
+// for a request to poll the state of an asynchronous operation.
+type LastOperationResponse struct {
+	// State is the current state of the operation.
+	State LastOperationState `json:"state"`
+
+	// Description is a message for the user describing the operation.
+	// It is returned to the client unmodified, so it may be formatted
+	// to report progress, such as "provisioning: 40% complete". This
+	// field is optional.
+	Description string `json:"description,omitempty"`
+
+	// OperationData is an opaque value that is returned to the client
+	// unmodified. Echoing the original operation on a failed delete
+	// allows the broker to correlate the client's retry with it. This
+	// field is optional.
+	OperationData string `json:"operation,omitempty"`
+
+	// InstanceUsable tells the client whether the service instance can
+	// still be used after a failed deprovision. It should only be set
+	// when the State of a delete operation is LastOperationFailed. This
+	// field is optional.
+	InstanceUsable *bool `json:"instance_usable,omitempty"`
+}
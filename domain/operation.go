@@ -0,0 +1,60 @@
+package domain
+
+import (
+	"encoding/base64"
+	"encoding/json"
+)
+
+// OperationType describes the kind of change that an asynchronous
+// operation makes to a service instance.
+type OperationType string
+
+const (
+	// OperationTypeCreate is used for provision operations.
+	OperationTypeCreate OperationType = "create"
+
+	// OperationTypeUpdate is used for update operations.
+	OperationTypeUpdate OperationType = "update"
+
+	// OperationTypeDelete is used for deprovision operations.
+	OperationTypeDelete OperationType = "delete"
+)
+
+// Operation is a typed helper for the opaque operation data returned
+// in asynchronous responses. It allows a broker to distinguish, for
+// example, a create operation from a later update operation on the
+// same service instance when the client polls for its state.
+type Operation struct {
+	// Type is the kind of change made by this operation.
+	Type OperationType `json:"type"`
+
+	// ID is a broker-defined identifier for this operation.
+	ID string `json:"id"`
+}
+
+// Encode returns a URL-safe string representing the operation that
+// can be returned to the client as operation data.
+func (o Operation) Encode() string {
+	document, err := json.Marshal(o)
+	if err != nil {
+		panic(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(document)
+}
+
+// DecodeOperation parses operation data that was produced by
+// Operation.Encode.
+func DecodeOperation(data string) (Operation, error) {
+	document, err := base64.RawURLEncoding.DecodeString(data)
+	if err != nil {
+		return Operation{}, InvalidOperationError("operation data is not a valid encoded operation")
+	}
+
+	var operation Operation
+	if err := json.Unmarshal(document, &operation); err != nil {
+		return Operation{}, InvalidOperationError("operation data is not a valid encoded operation")
+	}
+
+	return operation, nil
+}
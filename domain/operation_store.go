@@ -0,0 +1,141 @@
+package domain
+
+import (
+	"fmt"
+	"sync"
+)
+
+// OperationRecord is the state of an asynchronous operation on a service
+// instance, as tracked by an OperationStore.
+type OperationRecord struct {
+	// ID is the operation data that was returned to the client when the
+	// operation was started.
+	ID string
+
+	// Type is the kind of change made by the operation. This field is
+	// optional.
+	Type OperationType
+
+	// State is the current state of the operation.
+	State LastOperationState
+
+	// Description is a message for the user describing the operation.
+	// This field is optional.
+	Description string
+
+	// InstanceUsable is whether the service instance can still be used
+	// after a failed delete operation. This field is optional.
+	InstanceUsable *bool
+}
+
+// LastOperationResponse returns the response to a request to poll the
+// state of the operation.
+func (r OperationRecord) LastOperationResponse() LastOperationResponse {
+	return LastOperationResponse{
+		State:          r.State,
+		Description:    r.Description,
+		InstanceUsable: r.InstanceUsable,
+	}
+}
+
+// OperationStore defines the interface for tracking the last asynchronous
+// operation on each service instance, so that a broker can answer
+// requests to poll the state of its operations.
+type OperationStore interface {
+	// Create records a new operation on the service instance, replacing
+	// any completed operation. An OperationInProgressError is returned
+	// if an earlier operation on the instance is still in progress.
+	Create(instanceID string, record OperationRecord) error
+
+	// Get returns the last operation on the service instance. An
+	// OperationNotFoundError is returned if there is none.
+	Get(instanceID string) (OperationRecord, error)
+
+	// Update replaces the last operation on the service instance, such
+	// as when it completes. An OperationNotFoundError is returned if
+	// there is none.
+	Update(instanceID string, record OperationRecord) error
+
+	// Delete forgets the operations on the service instance, such as
+	// when the instance has been deprovisioned.
+	Delete(instanceID string) error
+}
+
+// MemoryOperationStore is an OperationStore that keeps operations in
+// memory. Operations are lost when the broker restarts. It is safe for
+// concurrent use.
+type MemoryOperationStore struct {
+	mutex      sync.Mutex
+	operations map[string]OperationRecord
+}
+
+// NewMemoryOperationStore returns an empty MemoryOperationStore.
+func NewMemoryOperationStore() *MemoryOperationStore {
+	return &MemoryOperationStore{
+		operations: map[string]OperationRecord{},
+	}
+}
+
+// Create records a new operation on the service instance.
+func (s *MemoryOperationStore) Create(instanceID string, record OperationRecord) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if existing, ok := s.operations[instanceID]; ok && existing.State == LastOperationInProgress {
+		return OperationInProgressError(fmt.Sprintf("operation %q on service instance %q is still in progress", existing.ID, instanceID))
+	}
+
+	s.operations[instanceID] = record
+	return nil
+}
+
+// Get returns the last operation on the service instance.
+func (s *MemoryOperationStore) Get(instanceID string) (OperationRecord, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	record, ok := s.operations[instanceID]
+	if !ok {
+		return OperationRecord{}, OperationNotFoundError(fmt.Sprintf("no operation on service instance %q", instanceID))
+	}
+
+	return record, nil
+}
+
+// Update replaces the last operation on the service instance.
+func (s *MemoryOperationStore) Update(instanceID string, record OperationRecord) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.operations[instanceID]; !ok {
+		return OperationNotFoundError(fmt.Sprintf("no operation on service instance %q", instanceID))
+	}
+
+	s.operations[instanceID] = record
+	return nil
+}
+
+// InProgress returns the number of service instances whose last
+// operation is still in progress.
+func (s *MemoryOperationStore) InProgress() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	count := 0
+	for _, record := range s.operations {
+		if record.State == LastOperationInProgress {
+			count++
+		}
+	}
+
+	return count
+}
+
+// Delete forgets the operations on the service instance.
+func (s *MemoryOperationStore) Delete(instanceID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.operations, instanceID)
+	return nil
+}
@@ -0,0 +1,114 @@
+package domain_test
+
+import (
+	"encoding/json"
+
+	"github.com/pivotal-cf-experimental/envoy/domain"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MemoryOperationStore", func() {
+	var store *domain.MemoryOperationStore
+
+	BeforeEach(func() {
+		store = domain.NewMemoryOperationStore()
+	})
+
+	It("tracks an operation from creation until it completes", func() {
+		err := store.Create("instance-id", domain.OperationRecord{
+			ID:    "create-1",
+			Type:  domain.OperationTypeCreate,
+			State: domain.LastOperationInProgress,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		record, err := store.Get("instance-id")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(record.State).To(Equal(domain.LastOperationInProgress))
+
+		record.State = domain.LastOperationSucceeded
+		record.Description = "created"
+		Expect(store.Update("instance-id", record)).To(Succeed())
+
+		record, err = store.Get("instance-id")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(record).To(Equal(domain.OperationRecord{
+			ID:          "create-1",
+			Type:        domain.OperationTypeCreate,
+			State:       domain.LastOperationSucceeded,
+			Description: "created",
+		}))
+		Expect(record.LastOperationResponse()).To(Equal(domain.LastOperationResponse{
+			State:       domain.LastOperationSucceeded,
+			Description: "created",
+		}))
+	})
+
+	It("reports whether the instance is usable after a failed delete", func() {
+		usable := false
+		record := domain.OperationRecord{
+			ID:             "delete-1",
+			Type:           domain.OperationTypeDelete,
+			State:          domain.LastOperationFailed,
+			InstanceUsable: &usable,
+		}
+
+		Expect(json.Marshal(record.LastOperationResponse())).To(MatchJSON(`{
+			"state": "failed",
+			"instance_usable": false
+		}`))
+	})
+
+	It("keeps the operations of each instance separate", func() {
+		Expect(store.Create("instance-1", domain.OperationRecord{ID: "op-1"})).To(Succeed())
+		Expect(store.Create("instance-2", domain.OperationRecord{ID: "op-2"})).To(Succeed())
+
+		record, err := store.Get("instance-1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(record.ID).To(Equal("op-1"))
+	})
+
+	It("refuses to create an operation while another is in progress", func() {
+		Expect(store.Create("instance-id", domain.OperationRecord{ID: "create-1", State: domain.LastOperationInProgress})).To(Succeed())
+
+		err := store.Create("instance-id", domain.OperationRecord{ID: "update-1", State: domain.LastOperationInProgress})
+		Expect(err).To(MatchError(domain.OperationInProgressError(`operation "create-1" on service instance "instance-id" is still in progress`)))
+	})
+
+	It("replaces a completed operation with a new one", func() {
+		Expect(store.Create("instance-id", domain.OperationRecord{ID: "create-1", State: domain.LastOperationFailed})).To(Succeed())
+		Expect(store.Create("instance-id", domain.OperationRecord{ID: "create-2", State: domain.LastOperationInProgress})).To(Succeed())
+
+		record, err := store.Get("instance-id")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(record.ID).To(Equal("create-2"))
+	})
+
+	It("returns an error for an instance without operations", func() {
+		_, err := store.Get("instance-id")
+		Expect(err).To(MatchError(domain.OperationNotFoundError(`no operation on service instance "instance-id"`)))
+
+		err = store.Update("instance-id", domain.OperationRecord{ID: "op"})
+		Expect(err).To(BeAssignableToTypeOf(domain.OperationNotFoundError("")))
+	})
+
+	It("counts the instances with an operation in progress", func() {
+		Expect(store.Create("instance-1", domain.OperationRecord{ID: "op-1", State: domain.LastOperationInProgress})).To(Succeed())
+		Expect(store.Create("instance-2", domain.OperationRecord{ID: "op-2", State: domain.LastOperationInProgress})).To(Succeed())
+		Expect(store.Create("instance-3", domain.OperationRecord{ID: "op-3", State: domain.LastOperationSucceeded})).To(Succeed())
+		Expect(store.InProgress()).To(Equal(2))
+
+		Expect(store.Update("instance-1", domain.OperationRecord{ID: "op-1", State: domain.LastOperationFailed})).To(Succeed())
+		Expect(store.InProgress()).To(Equal(1))
+	})
+
+	It("forgets the operations of a deleted instance", func() {
+		Expect(store.Create("instance-id", domain.OperationRecord{ID: "delete-1"})).To(Succeed())
+		Expect(store.Delete("instance-id")).To(Succeed())
+
+		_, err := store.Get("instance-id")
+		Expect(err).To(BeAssignableToTypeOf(domain.OperationNotFoundError("")))
+	})
+})
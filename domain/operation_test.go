@@ -0,0 +1,55 @@
+package domain_test
+
+import (
+	"net/url"
+
+	"github.com/pivotal-cf-experimental/envoy/domain"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Operation", func() {
+	It("round-trips a create operation", func() {
+		operation := domain.Operation{
+			Type: domain.OperationTypeCreate,
+			ID:   "task-1",
+		}
+
+		decoded, err := domain.DecodeOperation(operation.Encode())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(decoded).To(Equal(operation))
+	})
+
+	It("round-trips an update operation", func() {
+		operation := domain.Operation{
+			Type: domain.OperationTypeUpdate,
+			ID:   "task/2?with=special&characters",
+		}
+
+		decoded, err := domain.DecodeOperation(operation.Encode())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(decoded).To(Equal(operation))
+	})
+
+	It("distinguishes operations of different types with the same ID", func() {
+		create := domain.Operation{Type: domain.OperationTypeCreate, ID: "task-1"}
+		update := domain.Operation{Type: domain.OperationTypeUpdate, ID: "task-1"}
+
+		Expect(create.Encode()).NotTo(Equal(update.Encode()))
+	})
+
+	It("encodes to a URL-safe string", func() {
+		encoded := domain.Operation{
+			Type: domain.OperationTypeUpdate,
+			ID:   "task/2?with=special&characters",
+		}.Encode()
+
+		Expect(url.QueryEscape(encoded)).To(Equal(encoded))
+	})
+
+	It("returns an error when decoding malformed operation data", func() {
+		_, err := domain.DecodeOperation("not an operation!")
+		Expect(err).To(BeAssignableToTypeOf(domain.InvalidOperationError("")))
+	})
+})
@@ -22,6 +22,26 @@ type ProvisionRequest struct {
 	// SpaceGUID is GUID value of the space into which this service
 	// instance will be provisioned.
 	SpaceGUID string
+
+	// AcceptsIncomplete indicates that the client is willing to
+	// accept an asynchronous response to this provision request.
+	// When it is false, a provisioner that can only provision
+	// asynchronously should return an AsyncRequiredError.
+	AcceptsIncomplete bool
+
+	// MaintenanceInfo is the version of the plan that the client
+	// expects to be provisioned. This field is optional.
+	MaintenanceInfo *MaintenanceInfo
+
+	// Context is platform specific contextual information about the
+	// service instance, such as the names of its organization and
+	// space. This field is optional.
+	Context map[string]interface{}
+
+	// Parameters is the set of configuration parameters for the
+	// service instance provided by the client. This field is
+	// optional.
+	Parameters map[string]interface{}
 }
 
 // ProvisionResponse encapsulates the response payload information
@@ -30,4 +50,14 @@ type ProvisionResponse struct {
 	// DashboardURL is the URL of a web-based management user
 	// interface for the service instance.
 	DashboardURL string
+
+	// IsAsync indicates that the provision operation will be
+	// completed asynchronously. This may only be set when the
+	// request accepts incomplete responses.
+	IsAsync bool
+
+	// OperationData is an opaque value identifying the provision
+	// operation. It is returned to the client so that it can be
+	// provided when polling for the state of the operation.
+	OperationData string
 }
@@ -0,0 +1,26 @@
+package domain
+
+import "time"
+
+// RecordedExchange is a request to the broker and the response to it,
+// captured for troubleshooting. Secrets in the bodies are redacted before
+// they are recorded.
+type RecordedExchange struct {
+	// Time is when the request was received.
+	Time time.Time
+
+	// Method is the HTTP method of the request.
+	Method string
+
+	// Path is the URL path of the request.
+	Path string
+
+	// Status is the HTTP status code of the response.
+	Status int
+
+	// RequestBody is the redacted body of the request.
+	RequestBody string
+
+	// ResponseBody is the redacted body of the response.
+	ResponseBody string
+}
@@ -0,0 +1,351 @@
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// Schemas describes the configuration parameters that a service plan
+// accepts when service instances and bindings are created or updated.
+type Schemas struct {
+	// ServiceInstance holds the schemas for service instance requests.
+	// This field is optional.
+	ServiceInstance *ServiceInstanceSchema `json:"service_instance,omitempty"`
+
+	// ServiceBinding holds the schemas for service binding requests.
+	// This field is optional.
+	ServiceBinding *ServiceBindingSchema `json:"service_binding,omitempty"`
+}
+
+// ServiceInstanceSchema holds the schemas for the parameters of requests
+// to provision and update service instances.
+type ServiceInstanceSchema struct {
+	// Create is the schema for provision requests. This field is
+	// optional.
+	Create *InputParametersSchema `json:"create,omitempty"`
+
+	// Update is the schema for update requests. This field is optional.
+	Update *InputParametersSchema `json:"update,omitempty"`
+}
+
+// ServiceBindingSchema holds the schemas for the parameters of requests
+// to create service bindings.
+type ServiceBindingSchema struct {
+	// Create is the schema for bind requests. This field is optional.
+	Create *InputParametersSchema `json:"create,omitempty"`
+}
+
+// InputParametersSchema holds the JSON Schema for the parameters field of
+// a request.
+type InputParametersSchema struct {
+	// Parameters is a JSON Schema document describing the parameters.
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+}
+
+// Validate returns an InvalidCatalogError if any of the schemas is not a
+// well-formed JSON Schema document. It checks the structure of the
+// schemas, such as that each keyword has a value of the right type; it
+// does not check that the schemas describe the parameters that the broker
+// expects.
+func (s Schemas) Validate() error {
+	for _, input := range s.inputs() {
+		if err := validateSchema(input.path+".parameters", input.schema.Parameters); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ValidateSize returns an InvalidCatalogError if any of the schemas is
+// larger than the limit when written as JSON, since the platform rejects
+// a catalog with oversized schemas.
+func (s Schemas) ValidateSize(limit int) error {
+	for _, input := range s.inputs() {
+		data, err := json.Marshal(input.schema.Parameters)
+		if err != nil {
+			return InvalidCatalogError(fmt.Sprintf("%s.parameters: %s", input.path, err))
+		}
+
+		if len(data) > limit {
+			return InvalidCatalogError(fmt.Sprintf("%s.parameters: schema is %d bytes, more than the limit of %d bytes", input.path, len(data), limit))
+		}
+	}
+
+	return nil
+}
+
+type namedSchema struct {
+	path   string
+	schema *InputParametersSchema
+}
+
+// inputs returns the schemas that are set, along with their paths.
+func (s Schemas) inputs() []namedSchema {
+	var create, update, bind *InputParametersSchema
+	if s.ServiceInstance != nil {
+		create, update = s.ServiceInstance.Create, s.ServiceInstance.Update
+	}
+	if s.ServiceBinding != nil {
+		bind = s.ServiceBinding.Create
+	}
+
+	var inputs []namedSchema
+	for _, input := range []namedSchema{
+		{"service_instance.create", create},
+		{"service_instance.update", update},
+		{"service_binding.create", bind},
+	} {
+		if input.schema != nil && input.schema.Parameters != nil {
+			inputs = append(inputs, input)
+		}
+	}
+
+	return inputs
+}
+
+// InstanceCreate returns the schema for provision requests, or nil when
+// there is none. It may be called on nil Schemas.
+func (s *Schemas) InstanceCreate() *InputParametersSchema {
+	if s == nil || s.ServiceInstance == nil {
+		return nil
+	}
+
+	return s.ServiceInstance.Create
+}
+
+// InstanceUpdate returns the schema for update requests, or nil when
+// there is none. It may be called on nil Schemas.
+func (s *Schemas) InstanceUpdate() *InputParametersSchema {
+	if s == nil || s.ServiceInstance == nil {
+		return nil
+	}
+
+	return s.ServiceInstance.Update
+}
+
+// BindingCreate returns the schema for bind requests, or nil when there
+// is none. It may be called on nil Schemas.
+func (s *Schemas) BindingCreate() *InputParametersSchema {
+	if s == nil || s.ServiceBinding == nil {
+		return nil
+	}
+
+	return s.ServiceBinding.Create
+}
+
+// UnrecognizedParameters returns, in order, the keys of the given
+// parameters that are not declared in the properties of the schema. When
+// the schema does not declare any properties, none are reported, since
+// the parameters it accepts are unknown. It may be called on a nil schema.
+func (s *InputParametersSchema) UnrecognizedParameters(parameters map[string]interface{}) []string {
+	if s == nil {
+		return nil
+	}
+
+	properties, ok := s.Parameters["properties"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	var unrecognized []string
+	for _, key := range sortedKeys(parameters) {
+		if _, ok := properties[key]; !ok {
+			unrecognized = append(unrecognized, key)
+		}
+	}
+
+	return unrecognized
+}
+
+var schemaTypes = map[string]bool{
+	"array":   true,
+	"boolean": true,
+	"integer": true,
+	"null":    true,
+	"number":  true,
+	"object":  true,
+	"string":  true,
+}
+
+func validateSchema(path string, value interface{}) error {
+	if _, ok := value.(bool); ok {
+		return nil
+	}
+
+	schema, ok := value.(map[string]interface{})
+	if !ok {
+		return invalidSchema(path, "must be an object")
+	}
+
+	for _, keyword := range sortedKeys(schema) {
+		value := schema[keyword]
+		keywordPath := path + "." + keyword
+
+		var err error
+		switch keyword {
+		case "$schema", "$id", "$ref", "id", "title", "description":
+			if _, ok := value.(string); !ok {
+				err = invalidSchema(keywordPath, "must be a string")
+			}
+		case "type":
+			err = validateSchemaType(keywordPath, value)
+		case "properties", "patternProperties", "definitions", "$defs", "dependentSchemas":
+			err = validateSchemaMap(keywordPath, value)
+		case "additionalProperties", "additionalItems", "not", "contains", "propertyNames", "if", "then", "else":
+			err = validateSchema(keywordPath, value)
+		case "items":
+			if items, ok := value.([]interface{}); ok {
+				err = validateSchemaList(keywordPath, items)
+			} else {
+				err = validateSchema(keywordPath, value)
+			}
+		case "allOf", "anyOf", "oneOf":
+			items, ok := value.([]interface{})
+			if !ok || len(items) == 0 {
+				err = invalidSchema(keywordPath, "must be a non-empty array")
+			} else {
+				err = validateSchemaList(keywordPath, items)
+			}
+		case "required":
+			err = validateStringList(keywordPath, value)
+		case "enum":
+			if _, ok := value.([]interface{}); !ok {
+				err = invalidSchema(keywordPath, "must be an array")
+			}
+		case "minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum":
+			if _, ok := value.(bool); ok && (keyword == "exclusiveMinimum" || keyword == "exclusiveMaximum") {
+				break
+			}
+			if _, ok := schemaNumber(value); !ok {
+				err = invalidSchema(keywordPath, "must be a number")
+			}
+		case "multipleOf":
+			if n, ok := schemaNumber(value); !ok || n <= 0 {
+				err = invalidSchema(keywordPath, "must be a number greater than 0")
+			}
+		case "minLength", "maxLength", "minItems", "maxItems", "minProperties", "maxProperties":
+			if n, ok := schemaNumber(value); !ok || n < 0 || n != float64(int64(n)) {
+				err = invalidSchema(keywordPath, "must be a non-negative integer")
+			}
+		case "pattern":
+			pattern, ok := value.(string)
+			if !ok {
+				err = invalidSchema(keywordPath, "must be a string")
+			} else if _, compileErr := regexp.Compile(pattern); compileErr != nil {
+				err = invalidSchema(keywordPath, fmt.Sprintf("is not a valid regular expression: %s", compileErr))
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateSchemaType(path string, value interface{}) error {
+	switch t := value.(type) {
+	case string:
+		if !schemaTypes[t] {
+			return invalidSchema(path, fmt.Sprintf("%q is not a valid type", t))
+		}
+	case []interface{}:
+		if len(t) == 0 {
+			return invalidSchema(path, "must not be empty")
+		}
+
+		for _, item := range t {
+			name, ok := item.(string)
+			if !ok || !schemaTypes[name] {
+				return invalidSchema(path, fmt.Sprintf("%v is not a valid type", item))
+			}
+		}
+	default:
+		return invalidSchema(path, "must be a string or an array of strings")
+	}
+
+	return nil
+}
+
+func validateSchemaMap(path string, value interface{}) error {
+	schemas, ok := value.(map[string]interface{})
+	if !ok {
+		return invalidSchema(path, "must be an object")
+	}
+
+	for _, name := range sortedKeys(schemas) {
+		if err := validateSchema(path+"."+name, schemas[name]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateSchemaList(path string, schemas []interface{}) error {
+	for i, schema := range schemas {
+		if err := validateSchema(fmt.Sprintf("%s[%d]", path, i), schema); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateStringList(path string, value interface{}) error {
+	items, ok := value.([]interface{})
+	if !ok {
+		if _, ok := value.([]string); ok {
+			return nil
+		}
+		return invalidSchema(path, "must be an array of strings")
+	}
+
+	for _, item := range items {
+		if _, ok := item.(string); !ok {
+			return invalidSchema(path, "must be an array of strings")
+		}
+	}
+
+	return nil
+}
+
+// schemaNumber returns the value of a numeric keyword, which is a float64
+// when the schema was decoded from JSON, but may be any numeric type when
+// the schema was written in Go.
+func schemaNumber(value interface{}) (float64, bool) {
+	switch n := value.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	}
+
+	return 0, false
+}
+
+func invalidSchema(path, reason string) error {
+	return InvalidCatalogError(fmt.Sprintf("invalid schema: %s %s", path, reason))
+}
+
+// sortedKeys returns the keys of a schema in order, so that the same
+// error is reported for a schema with several problems each time.
+func sortedKeys(m map[string]interface{}) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,216 @@
+package domain_test
+
+import (
+	"encoding/json"
+
+	"github.com/pivotal-cf-experimental/envoy/domain"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Schemas", func() {
+	schemasFromJSON := func(document string) domain.Schemas {
+		var schemas domain.Schemas
+		if err := json.Unmarshal([]byte(document), &schemas); err != nil {
+			panic(err)
+		}
+
+		return schemas
+	}
+
+	It("serializes the schemas in the format of the catalog", func() {
+		schemas := domain.Schemas{
+			ServiceInstance: &domain.ServiceInstanceSchema{
+				Create: &domain.InputParametersSchema{
+					Parameters: map[string]interface{}{"type": "object"},
+				},
+			},
+		}
+
+		Expect(json.Marshal(schemas)).To(MatchJSON(`{
+			"service_instance": {
+				"create": {
+					"parameters": {"type": "object"}
+				}
+			}
+		}`))
+	})
+
+	Describe("Validate", func() {
+		It("accepts well-formed schemas", func() {
+			schemas := schemasFromJSON(`{
+				"service_instance": {
+					"create": {
+						"parameters": {
+							"$schema": "http://json-schema.org/draft-04/schema#",
+							"type": "object",
+							"properties": {
+								"size": {"type": "integer", "minimum": 1, "maximum": 10},
+								"name": {"type": ["string", "null"], "pattern": "^[a-z]+$", "maxLength": 32},
+								"tags": {"type": "array", "items": {"type": "string"}},
+								"tier": {"enum": ["small", "large"]}
+							},
+							"required": ["size"],
+							"additionalProperties": false
+						}
+					}
+				},
+				"service_binding": {
+					"create": {
+						"parameters": {"anyOf": [{"type": "object"}, {"type": "null"}]}
+					}
+				}
+			}`)
+
+			Expect(schemas.Validate()).To(Succeed())
+		})
+
+		It("accepts schemas without parameters", func() {
+			schemas := domain.Schemas{
+				ServiceInstance: &domain.ServiceInstanceSchema{
+					Update: &domain.InputParametersSchema{},
+				},
+			}
+
+			Expect(schemas.Validate()).To(Succeed())
+		})
+
+		It("accepts schemas written in Go with integer keywords", func() {
+			schemas := domain.Schemas{
+				ServiceBinding: &domain.ServiceBindingSchema{
+					Create: &domain.InputParametersSchema{
+						Parameters: map[string]interface{}{
+							"type":      "string",
+							"minLength": 2,
+						},
+					},
+				},
+			}
+
+			Expect(schemas.Validate()).To(Succeed())
+		})
+
+		It("rejects an unknown type", func() {
+			schemas := schemasFromJSON(`{
+				"service_instance": {
+					"create": {
+						"parameters": {"type": "object", "properties": {"size": {"type": "int"}}}
+					}
+				}
+			}`)
+
+			Expect(schemas.Validate()).To(MatchError(domain.InvalidCatalogError(
+				`invalid schema: service_instance.create.parameters.properties.size.type "int" is not a valid type`)))
+		})
+
+		It("rejects a sub-schema that is not an object", func() {
+			schemas := schemasFromJSON(`{
+				"service_instance": {
+					"update": {
+						"parameters": {"properties": {"size": "integer"}}
+					}
+				}
+			}`)
+
+			Expect(schemas.Validate()).To(MatchError(domain.InvalidCatalogError(
+				`invalid schema: service_instance.update.parameters.properties.size must be an object`)))
+		})
+
+		It("rejects required fields that are not strings", func() {
+			schemas := schemasFromJSON(`{
+				"service_binding": {
+					"create": {
+						"parameters": {"required": "size"}
+					}
+				}
+			}`)
+
+			Expect(schemas.Validate()).To(MatchError(domain.InvalidCatalogError(
+				`invalid schema: service_binding.create.parameters.required must be an array of strings`)))
+		})
+
+		It("rejects a pattern that is not a valid regular expression", func() {
+			schemas := schemasFromJSON(`{
+				"service_instance": {
+					"create": {
+						"parameters": {"pattern": "[a-z"}
+					}
+				}
+			}`)
+
+			Expect(schemas.Validate()).To(MatchError(ContainSubstring(
+				"invalid schema: service_instance.create.parameters.pattern is not a valid regular expression")))
+		})
+
+		It("rejects a negative length", func() {
+			schemas := schemasFromJSON(`{
+				"service_instance": {
+					"create": {
+						"parameters": {"items": [{"type": "string", "minLength": -1}]}
+					}
+				}
+			}`)
+
+			Expect(schemas.Validate()).To(MatchError(domain.InvalidCatalogError(
+				`invalid schema: service_instance.create.parameters.items[0].minLength must be a non-negative integer`)))
+		})
+	})
+
+	Describe("UnrecognizedParameters", func() {
+		var schemas domain.Schemas
+
+		BeforeEach(func() {
+			schemas = schemasFromJSON(`{
+				"service_instance": {
+					"create": {
+						"parameters": {
+							"type": "object",
+							"properties": {
+								"size": {"type": "string"},
+								"region": {"type": "string"}
+							}
+						}
+					}
+				}
+			}`)
+		})
+
+		It("returns the keys that are not declared properties, in order", func() {
+			Expect(schemas.InstanceCreate().UnrecognizedParameters(map[string]interface{}{
+				"size":   "large",
+				"zize":   "large",
+				"regoin": "eu",
+			})).To(Equal([]string{"regoin", "zize"}))
+		})
+
+		It("returns nothing when every key is declared", func() {
+			Expect(schemas.InstanceCreate().UnrecognizedParameters(map[string]interface{}{
+				"size": "large",
+			})).To(BeEmpty())
+		})
+
+		It("returns nothing when there is no schema", func() {
+			Expect(schemas.InstanceUpdate().UnrecognizedParameters(map[string]interface{}{
+				"zize": "large",
+			})).To(BeEmpty())
+
+			var none *domain.Schemas
+			Expect(none.BindingCreate().UnrecognizedParameters(map[string]interface{}{
+				"zize": "large",
+			})).To(BeEmpty())
+		})
+
+		It("returns nothing when the schema does not declare properties", func() {
+			schemas = schemasFromJSON(`{
+				"service_instance": {
+					"create": {"parameters": {"type": "object"}}
+				}
+			}`)
+
+			Expect(schemas.InstanceCreate().UnrecognizedParameters(map[string]interface{}{
+				"zize": "large",
+			})).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,70 @@
+package domain
+
+// UpdateRequest encapsulates the request payload information
+// for an update request.
+type UpdateRequest struct {
+	// InstanceID is the ID value for the service instance
+	// to be updated in this update request.
+	InstanceID string
+
+	// ServiceID is the ID value of the service provided in
+	// the service catalog.
+	ServiceID string
+
+	// PlanID is the ID value of the plan that the service
+	// instance should be updated to. This field is optional,
+	// and is empty when the plan is not being changed.
+	PlanID string
+
+	// PreviousPlanID is the ID value of the plan that the
+	// service instance was using before this update. This
+	// field is optional.
+	PreviousPlanID string
+
+	// AcceptsIncomplete indicates that the client is willing to
+	// accept an asynchronous response to this update request.
+	// When it is false, an updater that can only update
+	// asynchronously should return an AsyncRequiredError.
+	AcceptsIncomplete bool
+
+	// Context is platform specific contextual information about the
+	// service instance, such as a new name for its space. This field
+	// is optional.
+	Context map[string]interface{}
+
+	// Parameters is the set of configuration parameters to change
+	// for the service instance. This field is optional.
+	Parameters map[string]interface{}
+
+	// MaintenanceInfo is the version of the plan that the service
+	// instance should be upgraded to, such as when the platform
+	// upgrades instances after a new version of the plan is
+	// released. This field is optional.
+	MaintenanceInfo *MaintenanceInfo
+}
+
+// IsContextOnly reports whether the update request changes only the
+// context of the service instance, and not its plan, parameters or
+// maintenance_info.
+func (r UpdateRequest) IsContextOnly() bool {
+	planChanged := r.PlanID != "" && r.PlanID != r.PreviousPlanID
+	return len(r.Context) > 0 && !planChanged && len(r.Parameters) == 0 && r.MaintenanceInfo == nil
+}
+
+// UpdateResponse encapsulates the response payload information
+// for an update request.
+type UpdateResponse struct {
+	// DashboardURL is the URL of a web-based management user
+	// interface for the service instance. This field is optional.
+	DashboardURL string
+
+	// IsAsync indicates that the update operation will be
+	// completed asynchronously. This may only be set when the
+	// request accepts incomplete responses.
+	IsAsync bool
+
+	// OperationData is an opaque value identifying the update
+	// operation. It is returned to the client so that it can be
+	// provided when polling for the state of the operation.
+	OperationData string
+}
@@ -0,0 +1,69 @@
+package envoy
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pivotal-cf-experimental/envoy/domain"
+)
+
+// IdempotencyStore defines the interface for storing the responses to
+// mutating requests made with an Idempotency-Key header, so that retries
+// of those requests can be answered without calling the broker again.
+type IdempotencyStore interface {
+	Get(key string) (domain.IdempotentResponse, bool)
+	Put(key string, response domain.IdempotentResponse)
+}
+
+// MemoryIdempotencyStore is an IdempotencyStore that keeps responses in
+// memory. Responses are lost when the broker restarts. It is safe for
+// concurrent use.
+type MemoryIdempotencyStore struct {
+	mutex     sync.Mutex
+	ttl       time.Duration
+	responses map[string]storedResponse
+}
+
+type storedResponse struct {
+	response domain.IdempotentResponse
+	storedAt time.Time
+}
+
+// NewMemoryIdempotencyStore returns an empty MemoryIdempotencyStore that
+// keeps each response for the given amount of time. When the ttl is zero,
+// responses are kept until the broker restarts.
+func NewMemoryIdempotencyStore(ttl time.Duration) *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		ttl:       ttl,
+		responses: map[string]storedResponse{},
+	}
+}
+
+// Get returns the response stored for the key, and whether one was found.
+func (s *MemoryIdempotencyStore) Get(key string) (domain.IdempotentResponse, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stored, ok := s.responses[key]
+	if !ok {
+		return domain.IdempotentResponse{}, false
+	}
+
+	if s.ttl > 0 && time.Since(stored.storedAt) > s.ttl {
+		delete(s.responses, key)
+		return domain.IdempotentResponse{}, false
+	}
+
+	return stored.response, true
+}
+
+// Put stores the response for the key, replacing any earlier response.
+func (s *MemoryIdempotencyStore) Put(key string, response domain.IdempotentResponse) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.responses[key] = storedResponse{
+		response: response,
+		storedAt: time.Now(),
+	}
+}
@@ -0,0 +1,41 @@
+package envoy_test
+
+import (
+	"time"
+
+	"github.com/pivotal-cf-experimental/envoy"
+	"github.com/pivotal-cf-experimental/envoy/domain"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MemoryIdempotencyStore", func() {
+	response := domain.IdempotentResponse{
+		Status: 201,
+		Header: map[string][]string{"Content-Type": {"application/json"}},
+		Body:   []byte(`{}`),
+	}
+
+	It("returns the response stored for a key", func() {
+		store := envoy.NewMemoryIdempotencyStore(0)
+		store.Put("key-1", response)
+
+		stored, ok := store.Get("key-1")
+		Expect(ok).To(BeTrue())
+		Expect(stored).To(Equal(response))
+
+		_, ok = store.Get("key-2")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("forgets responses once they expire", func() {
+		store := envoy.NewMemoryIdempotencyStore(10 * time.Millisecond)
+		store.Put("key-1", response)
+
+		Eventually(func() bool {
+			_, ok := store.Get("key-1")
+			return ok
+		}).Should(BeFalse())
+	})
+})
@@ -1,11 +1,12 @@
 package handlers
 
 import (
-	"encoding/json"
+	"bytes"
 	"errors"
-	"io/ioutil"
+	"fmt"
 	"net/http"
 	"regexp"
+	"time"
 
 	"github.com/pivotal-cf-experimental/envoy/domain"
 )
@@ -14,8 +15,20 @@ type binder interface {
 	Bind(domain.BindRequest) (domain.BindResponse, error)
 }
 
+type credentialTransformer interface {
+	TransformCredentials(domain.BindingCredentials) (domain.BindingCredentials, error)
+}
+
 type BindHandler struct {
 	binder
+	BodyReadTimeout            time.Duration
+	Logger                     Logger
+	Cataloger                  cataloger
+	StripUndeclaredSyslogDrain bool
+	CredentialTransformer      credentialTransformer
+	WarnUnrecognizedParameters bool
+	Signer                     operationSigner
+	WarnSameIDs                bool
 }
 
 func NewBindHandler(binder binder) BindHandler {
@@ -25,48 +38,184 @@ func NewBindHandler(binder binder) BindHandler {
 }
 
 func (handler BindHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	request, err := handler.Parse(req)
+	// Binding credentials are secrets, so intermediaries must never cache them.
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	request, err := handler.Parse(withBodyInterrupter(w, req))
 	if err != nil {
-		respond(w, http.StatusBadRequest, Failure{err.Error()})
+		switch err {
+		case errBodyReadTimeout:
+			respond(w, http.StatusRequestTimeout, Failure{Description: err.Error()})
+		case errUnsupportedCharset:
+			respond(w, http.StatusUnsupportedMediaType, Failure{Description: err.Error()})
+		default:
+			respond(w, http.StatusBadRequest, Failure{Description: err.Error()})
+		}
+		return
+	}
+
+	if request.RequestsVolumeMount() && !handler.serviceRequires(request.ServiceID, "volume_mount", true) {
+		respond(w, http.StatusUnprocessableEntity, Failure{
+			Description: fmt.Sprintf("service %q does not support volume mounts", request.ServiceID),
+		})
 		return
 	}
 
+	if handler.WarnUnrecognizedParameters && handler.Cataloger != nil {
+		if plan, ok := handler.Cataloger.Catalog().FindPlan(request.ServiceID, request.PlanID); ok {
+			warnUnrecognizedParameters(w, plan.Schemas.BindingCreate(), request.Parameters)
+		}
+	}
+
+	if handler.WarnSameIDs {
+		warnSameIDs(w, request.InstanceID, request.BindingID)
+	}
+
 	response, err := handler.binder.Bind(request)
 	if err != nil {
-		switch err.(type) {
+		switch e := err.(type) {
 		case domain.ServiceBindingAlreadyExistsError:
 			respond(w, http.StatusConflict, EmptyJSON)
-		default:
-			respond(w, http.StatusInternalServerError, Failure{
+		case domain.AsyncRequiredError:
+			respond(w, http.StatusUnprocessableEntity, Failure{
+				Error:       "AsyncRequired",
 				Description: err.Error(),
 			})
+		case domain.ServiceUnavailableError:
+			respondUnavailable(w, e)
+		default:
+			respondWithInternalError(w, handler.Logger, err)
+		}
+		return
+	}
+
+	if response.IsAsync {
+		respond(w, http.StatusAccepted, struct {
+			Operation string `json:"operation,omitempty"`
+		}{signOperation(handler.Signer, response.OperationData)})
+		return
+	}
+
+	if response.SyslogDrainURL != "" && handler.StripUndeclaredSyslogDrain && !handler.serviceRequires(request.ServiceID, "syslog_drain", false) {
+		if handler.Logger != nil {
+			handler.Logger.Info("bind.syslog-drain-stripped", map[string]interface{}{
+				"service_id": request.ServiceID,
+				"binding_id": request.BindingID,
+			})
 		}
+		response.SyslogDrainURL = ""
+	}
+
+	if err := response.ProvideCredentials(); err != nil {
+		respondWithInternalError(w, handler.Logger, err)
 		return
 	}
 
-	respond(w, http.StatusCreated, struct {
-		Credentials    domain.BindingCredentials `json:"credentials,omitempty"`
-		SyslogDrainURL string                    `json:"syslog_drain_url,omitempty"`
-	}{
-		Credentials:    response.Credentials,
-		SyslogDrainURL: response.SyslogDrainURL,
-	})
+	// Endpoints describe what the bound application needs to reach, so
+	// they are meaningless for an app-less service key.
+	if request.AppGUID == "" {
+		response.Endpoints = nil
+	}
+
+	if handler.CredentialTransformer != nil && response.Credentials != nil {
+		response.Credentials, err = handler.CredentialTransformer.TransformCredentials(response.Credentials)
+		if err != nil {
+			respondWithInternalError(w, handler.Logger, err)
+			return
+		}
+	}
+
+	if response.Credentials != nil {
+		if err := validateCredentials(response.Credentials); err != nil {
+			respondWithInternalError(w, handler.Logger, err)
+			return
+		}
+	}
+
+	if err := validateVolumeMounts(response.VolumeMounts); err != nil {
+		respondWithInternalError(w, handler.Logger, err)
+		return
+	}
+
+	if response.AlreadyExists {
+		respond(w, http.StatusOK, response.Body())
+		return
+	}
+
+	respond(w, http.StatusCreated, response.Body())
 }
 
-func (handler BindHandler) Parse(req *http.Request) (domain.BindRequest, error) {
-	body, err := ioutil.ReadAll(req.Body)
+// validateCredentials checks that the credentials will be written as a JSON
+// object, since the platform rejects a binding with any other credentials.
+// This catches values that cannot be marshaled, and replacement marshalers
+// that write the credentials in another shape, such as an array.
+func validateCredentials(credentials domain.BindingCredentials) error {
+	body, err := jsonMarshaler.Marshal(credentials)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("binding credentials cannot be written as JSON: %s", err)
 	}
 
+	if body = bytes.TrimSpace(body); len(body) == 0 || body[0] != '{' {
+		return errors.New("binding credentials must be a JSON object")
+	}
+
+	return nil
+}
+
+// validateVolumeMounts checks that each volume mount has the fields that
+// the platform needs to mount it, so that an incomplete mount is reported
+// as a broker error rather than the platform rejecting the binding.
+func validateVolumeMounts(mounts []domain.VolumeMount) error {
+	for i, mount := range mounts {
+		switch {
+		case mount.Driver == "":
+			return fmt.Errorf("volume mount %d is missing a driver", i)
+		case mount.ContainerDir == "":
+			return fmt.Errorf("volume mount %d is missing a container_dir", i)
+		case mount.Device.VolumeID == "":
+			return fmt.Errorf("volume mount %d is missing a device.volume_id", i)
+		}
+	}
+
+	return nil
+}
+
+// serviceRequires reports whether the service declares the given
+// requirement, such as syslog_drain or volume_mount, in the catalog.
+// CloudFoundry rejects a syslog_drain_url or volume_mounts for services
+// that do not. When the service is not in the catalog, unknown is
+// returned.
+func (handler BindHandler) serviceRequires(serviceID, requirement string, unknown bool) bool {
+	if handler.Cataloger == nil {
+		return unknown
+	}
+
+	service, ok := handler.Cataloger.Catalog().FindService(serviceID)
+	if !ok {
+		return unknown
+	}
+
+	for _, required := range service.Requires {
+		if required == requirement {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (handler BindHandler) Parse(req *http.Request) (domain.BindRequest, error) {
 	var params struct {
-		ServiceID string `json:"service_id"`
-		PlanID    string `json:"plan_id"`
-		AppGUID   string `json:"app_guid"`
+		ServiceID    string                 `json:"service_id"`
+		PlanID       string                 `json:"plan_id"`
+		AppGUID      string                 `json:"app_guid"`
+		BindResource *domain.BindResource   `json:"bind_resource"`
+		Context      map[string]interface{} `json:"context"`
+		Parameters   map[string]interface{} `json:"parameters"`
 	}
-	err = json.Unmarshal(body, &params)
-	if err != nil {
-		return domain.BindRequest{}, errors.New("request body must be a JSON object")
+	if err := decodeBody(req, handler.BodyReadTimeout, &params); err != nil {
+		return domain.BindRequest{}, err
 	}
 
 	expression := regexp.MustCompile(`^/v2/service_instances/(.*)/service_bindings/(.*)$`)
@@ -78,11 +227,24 @@ func (handler BindHandler) Parse(req *http.Request) (domain.BindRequest, error)
 		return domain.BindRequest{}, errors.New("missing required field")
 	}
 
+	appGUID := params.AppGUID
+	if params.BindResource != nil && params.BindResource.AppGUID != "" {
+		if appGUID == "" {
+			appGUID = params.BindResource.AppGUID
+		} else if appGUID != params.BindResource.AppGUID {
+			return domain.BindRequest{}, fmt.Errorf("app_guid %q does not match bind_resource.app_guid %q", appGUID, params.BindResource.AppGUID)
+		}
+	}
+
 	return domain.BindRequest{
-		BindingID:  bindingID,
-		InstanceID: instanceID,
-		ServiceID:  params.ServiceID,
-		PlanID:     params.PlanID,
-		AppGUID:    params.AppGUID,
+		BindingID:         bindingID,
+		InstanceID:        instanceID,
+		ServiceID:         params.ServiceID,
+		PlanID:            params.PlanID,
+		AppGUID:           appGUID,
+		BindResource:      params.BindResource,
+		Context:           params.Context,
+		Parameters:        params.Parameters,
+		AcceptsIncomplete: req.URL.Query().Get("accepts_incomplete") == "true",
 	}, nil
 }
@@ -2,11 +2,15 @@ package handlers_test
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"time"
 
 	"github.com/pivotal-cf-experimental/envoy/domain"
 	"github.com/pivotal-cf-experimental/envoy/internal/handlers"
@@ -21,6 +25,12 @@ type Binder struct {
 	Credentials    domain.BindingCredentials
 	Error          error
 	SyslogDrainURL string
+	Endpoints      []domain.Endpoint
+	VolumeMounts   []domain.VolumeMount
+	Fingerprints   map[string]string
+	IsAsync        bool
+	OperationData  string
+	Provider       func() (interface{}, error)
 }
 
 func NewBinder() *Binder {
@@ -31,10 +41,81 @@ func (b *Binder) Bind(binding domain.BindRequest) (domain.BindResponse, error) {
 	b.WasCalledWith = binding
 	b.WasCalled = true
 
-	return domain.BindResponse{
+	response := domain.BindResponse{
 		Credentials:    b.Credentials,
 		SyslogDrainURL: b.SyslogDrainURL,
-	}, b.Error
+		Endpoints:      b.Endpoints,
+		VolumeMounts:   b.VolumeMounts,
+		IsAsync:        b.IsAsync,
+		OperationData:  b.OperationData,
+	}
+	response.CredentialsProvider = b.Provider
+
+	if b.IsAsync && !binding.AcceptsIncomplete {
+		return domain.BindResponse{}, domain.AsyncRequiredError("this binding can only be created asynchronously")
+	}
+
+	if b.Fingerprints != nil {
+		fingerprint, ok := b.Fingerprints[binding.BindingID]
+		if ok && fingerprint != binding.Fingerprint() {
+			return domain.BindResponse{}, domain.ServiceBindingAlreadyExistsError("already exists")
+		}
+		response.AlreadyExists = ok
+		b.Fingerprints[binding.BindingID] = binding.Fingerprint()
+	}
+
+	return response, b.Error
+}
+
+// ArrayCredentialsMarshaler writes binding credentials as an array of
+// their keys, as a misbehaving JSON library might.
+type ArrayCredentialsMarshaler struct{}
+
+func (ArrayCredentialsMarshaler) Marshal(v interface{}) ([]byte, error) {
+	if credentials, ok := v.(domain.BindingCredentials); ok {
+		var keys []string
+		for key := range credentials {
+			keys = append(keys, key)
+		}
+		return json.Marshal(keys)
+	}
+
+	return json.Marshal(v)
+}
+
+type Base64Transformer struct {
+	Error error
+}
+
+func (t Base64Transformer) TransformCredentials(credentials domain.BindingCredentials) (domain.BindingCredentials, error) {
+	transformed := domain.BindingCredentials{}
+	for key, value := range credentials {
+		transformed[key] = base64.StdEncoding.EncodeToString([]byte(fmt.Sprint(value)))
+	}
+
+	return transformed, t.Error
+}
+
+type LogEntry struct {
+	Message string
+	Data    map[string]interface{}
+}
+
+type Logger struct {
+	Infos  []LogEntry
+	Errors []LogEntry
+}
+
+func NewLogger() *Logger {
+	return &Logger{}
+}
+
+func (l *Logger) Info(message string, data map[string]interface{}) {
+	l.Infos = append(l.Infos, LogEntry{message, data})
+}
+
+func (l *Logger) Error(message string, data map[string]interface{}) {
+	l.Errors = append(l.Errors, LogEntry{message, data})
 }
 
 var _ = Describe("BindHandler", func() {
@@ -96,6 +177,28 @@ var _ = Describe("BindHandler", func() {
 		Expect(writer.Body.String()).To(MatchJSON("{}"))
 	})
 
+	It("prevents the response from being cached", func() {
+		writer := httptest.NewRecorder()
+		reqBody, err := json.Marshal(map[string]string{
+			"service_id": "service-id",
+			"plan_id":    "plan-id",
+			"app_guid":   "app-guid",
+		})
+		if err != nil {
+			panic(err)
+		}
+
+		request, err := http.NewRequest("PUT", "/v2/service_instances/service-instance-id/service_bindings/service-binding-id", bytes.NewBuffer(reqBody))
+		if err != nil {
+			panic(err)
+		}
+
+		handler.ServeHTTP(writer, request)
+
+		Expect(writer.Header().Get("Cache-Control")).To(Equal("no-store"))
+		Expect(writer.Header().Get("Pragma")).To(Equal("no-cache"))
+	})
+
 	Context("when binding credentials are provided", func() {
 		BeforeEach(func() {
 			binder.Credentials = domain.BindingCredentials{
@@ -141,6 +244,171 @@ var _ = Describe("BindHandler", func() {
 		})
 	})
 
+	Context("when the service instance is shared with another space", func() {
+		It("accepts a bind request from a space other than the one it was provisioned in", func() {
+			service := domain.Service{ID: "service-id"}
+			service.SetShareable(true)
+			handler.Cataloger = StaticCataloger{domain.Catalog{
+				Services: []domain.Service{service},
+			}}
+
+			writer := httptest.NewRecorder()
+			reqBody, err := json.Marshal(map[string]interface{}{
+				"service_id": "service-id",
+				"plan_id":    "plan-id",
+				"app_guid":   "app-guid",
+				"context": map[string]interface{}{
+					"platform":   "cloudfoundry",
+					"space_guid": "other-space-guid",
+				},
+			})
+			if err != nil {
+				panic(err)
+			}
+
+			request, err := http.NewRequest("PUT", "/v2/service_instances/service-instance-id/service_bindings/service-binding-id", bytes.NewBuffer(reqBody))
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusCreated))
+			Expect(binder.WasCalledWith.Context).To(HaveKeyWithValue("space_guid", "other-space-guid"))
+		})
+	})
+
+	Context("when the request body includes a bind_resource", func() {
+		bindWith := func(params map[string]interface{}) *httptest.ResponseRecorder {
+			params["service_id"] = "service-id"
+			params["plan_id"] = "plan-id"
+			reqBody, err := json.Marshal(params)
+			if err != nil {
+				panic(err)
+			}
+
+			request, err := http.NewRequest("PUT", "/v2/service_instances/service-instance-id/service_bindings/service-binding-id", bytes.NewBuffer(reqBody))
+			if err != nil {
+				panic(err)
+			}
+
+			writer := httptest.NewRecorder()
+			handler.ServeHTTP(writer, request)
+
+			return writer
+		}
+
+		It("passes the route of a route service binding to the binder", func() {
+			writer := bindWith(map[string]interface{}{
+				"bind_resource": map[string]interface{}{
+					"route": "https://app.example.com/path",
+				},
+			})
+
+			Expect(writer.Code).To(Equal(http.StatusCreated))
+			Expect(binder.WasCalledWith.AppGUID).To(BeEmpty())
+			Expect(binder.WasCalledWith.BindResource).To(Equal(&domain.BindResource{
+				Route: "https://app.example.com/path",
+			}))
+		})
+
+		It("uses the app_guid of the bind_resource when there is no top-level app_guid", func() {
+			writer := bindWith(map[string]interface{}{
+				"bind_resource": map[string]interface{}{
+					"app_guid":             "app-guid",
+					"space_guid":           "space-guid",
+					"credential_client_id": "client-id",
+				},
+			})
+
+			Expect(writer.Code).To(Equal(http.StatusCreated))
+			Expect(binder.WasCalledWith.AppGUID).To(Equal("app-guid"))
+			Expect(binder.WasCalledWith.BindResource).To(Equal(&domain.BindResource{
+				AppGUID:            "app-guid",
+				SpaceGUID:          "space-guid",
+				CredentialClientID: "client-id",
+			}))
+		})
+
+		It("accepts a top-level app_guid that matches the bind_resource", func() {
+			writer := bindWith(map[string]interface{}{
+				"app_guid": "app-guid",
+				"bind_resource": map[string]interface{}{
+					"app_guid": "app-guid",
+				},
+			})
+
+			Expect(writer.Code).To(Equal(http.StatusCreated))
+			Expect(binder.WasCalledWith.AppGUID).To(Equal("app-guid"))
+		})
+
+		It("returns a 400 without calling the binder when the app_guid conflicts with the bind_resource", func() {
+			writer := bindWith(map[string]interface{}{
+				"app_guid": "app-guid",
+				"bind_resource": map[string]interface{}{
+					"app_guid": "other-app-guid",
+				},
+			})
+
+			Expect(writer.Code).To(Equal(http.StatusBadRequest))
+			Expect(writer.Body.String()).To(MatchJSON(`{
+				"description": "app_guid \"app-guid\" does not match bind_resource.app_guid \"other-app-guid\""
+			}`))
+			Expect(binder.WasCalled).To(BeFalse())
+		})
+	})
+
+	Context("when a credential transformer is provided", func() {
+		bind := func() *httptest.ResponseRecorder {
+			writer := httptest.NewRecorder()
+			reqBody, err := json.Marshal(map[string]string{
+				"service_id": "service-id",
+				"plan_id":    "plan-id",
+			})
+			if err != nil {
+				panic(err)
+			}
+
+			request, err := http.NewRequest("PUT", "/v2/service_instances/service-instance-id/service_bindings/service-binding-id", bytes.NewBuffer(reqBody))
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+			return writer
+		}
+
+		BeforeEach(func() {
+			binder.Credentials = domain.BindingCredentials{
+				"username": "mysqluser",
+				"password": "pass",
+			}
+		})
+
+		It("returns the transformed credentials in the response body", func() {
+			handler.CredentialTransformer = Base64Transformer{}
+
+			writer := bind()
+
+			Expect(writer.Code).To(Equal(http.StatusCreated))
+			Expect(writer.Body.String()).To(MatchJSON(`{
+				"credentials": {
+					"username": "bXlzcWx1c2Vy",
+					"password": "cGFzcw=="
+				}
+			}`))
+		})
+
+		It("returns a 500 when the transformer fails", func() {
+			handler.CredentialTransformer = Base64Transformer{Error: errors.New("no key")}
+
+			writer := bind()
+
+			Expect(writer.Code).To(Equal(http.StatusInternalServerError))
+			Expect(writer.Body.String()).To(MatchJSON(`{"description":"no key"}`))
+		})
+	})
+
 	Context("when binding syslog drain URL is provided", func() {
 		BeforeEach(func() {
 			binder.SyslogDrainURL = "syslog://something"
@@ -170,6 +438,358 @@ var _ = Describe("BindHandler", func() {
 				"syslog_drain_url": "syslog://something"
 			}`))
 		})
+
+		Context("when undeclared syslog drains are stripped", func() {
+			var logger *Logger
+
+			BeforeEach(func() {
+				logger = NewLogger()
+				handler.Logger = logger
+				handler.StripUndeclaredSyslogDrain = true
+			})
+
+			bind := func() *httptest.ResponseRecorder {
+				writer := httptest.NewRecorder()
+				reqBody, err := json.Marshal(map[string]string{
+					"service_id": "service-id",
+					"plan_id":    "plan-id",
+					"app_guid":   "app-guid",
+				})
+				if err != nil {
+					panic(err)
+				}
+
+				request, err := http.NewRequest("PUT", "/v2/service_instances/service-instance-id/service_bindings/service-binding-id", bytes.NewBuffer(reqBody))
+				if err != nil {
+					panic(err)
+				}
+
+				handler.ServeHTTP(writer, request)
+				return writer
+			}
+
+			It("strips the syslog drain URL when the service does not require it", func() {
+				handler.Cataloger = StaticCataloger{domain.Catalog{
+					Services: []domain.Service{{ID: "service-id"}},
+				}}
+
+				writer := bind()
+
+				Expect(writer.Code).To(Equal(http.StatusCreated))
+				Expect(writer.Body.String()).To(MatchJSON(`{}`))
+				Expect(logger.Infos).To(HaveLen(1))
+				Expect(logger.Infos[0].Message).To(Equal("bind.syslog-drain-stripped"))
+				Expect(logger.Infos[0].Data).To(HaveKeyWithValue("service_id", "service-id"))
+			})
+
+			It("keeps the syslog drain URL when the service requires it", func() {
+				handler.Cataloger = StaticCataloger{domain.Catalog{
+					Services: []domain.Service{{ID: "service-id", Requires: []string{"syslog_drain"}}},
+				}}
+
+				writer := bind()
+
+				Expect(writer.Code).To(Equal(http.StatusCreated))
+				Expect(writer.Body.String()).To(MatchJSON(`{"syslog_drain_url": "syslog://something"}`))
+				Expect(logger.Infos).To(BeEmpty())
+			})
+		})
+	})
+
+	Context("when a volume mount is requested", func() {
+		bind := func() *httptest.ResponseRecorder {
+			writer := httptest.NewRecorder()
+			reqBody, err := json.Marshal(map[string]interface{}{
+				"service_id": "service-id",
+				"plan_id":    "plan-id",
+				"app_guid":   "app-guid",
+				"parameters": map[string]interface{}{
+					"mount": "/var/vcap/data/shared",
+				},
+			})
+			if err != nil {
+				panic(err)
+			}
+
+			request, err := http.NewRequest("PUT", "/v2/service_instances/service-instance-id/service_bindings/service-binding-id", bytes.NewBuffer(reqBody))
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+			return writer
+		}
+
+		It("returns a 422 without calling the binder when the service does not support volume mounts", func() {
+			handler.Cataloger = StaticCataloger{domain.Catalog{
+				Services: []domain.Service{{ID: "service-id"}},
+			}}
+
+			writer := bind()
+
+			Expect(writer.Code).To(Equal(http.StatusUnprocessableEntity))
+			Expect(writer.Body.String()).To(MatchJSON(`{"description": "service \"service-id\" does not support volume mounts"}`))
+			Expect(binder.WasCalled).To(BeFalse())
+		})
+
+		It("binds when the service requires volume mounts", func() {
+			handler.Cataloger = StaticCataloger{domain.Catalog{
+				Services: []domain.Service{{ID: "service-id", Requires: []string{"volume_mount"}}},
+			}}
+
+			writer := bind()
+
+			Expect(writer.Code).To(Equal(http.StatusCreated))
+			Expect(binder.WasCalled).To(BeTrue())
+			Expect(binder.WasCalledWith.Parameters).To(Equal(map[string]interface{}{
+				"mount": "/var/vcap/data/shared",
+			}))
+		})
+
+		It("binds when the service is not in the catalog", func() {
+			writer := bind()
+
+			Expect(writer.Code).To(Equal(http.StatusCreated))
+			Expect(binder.WasCalled).To(BeTrue())
+		})
+	})
+
+	Context("when the binder returns volume mounts", func() {
+		var logger *Logger
+
+		bind := func() *httptest.ResponseRecorder {
+			writer := httptest.NewRecorder()
+			reqBody, err := json.Marshal(map[string]string{
+				"service_id": "service-id",
+				"plan_id":    "plan-id",
+				"app_guid":   "app-guid",
+			})
+			if err != nil {
+				panic(err)
+			}
+
+			request, err := http.NewRequest("PUT", "/v2/service_instances/service-instance-id/service_bindings/service-binding-id", bytes.NewBuffer(reqBody))
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+			return writer
+		}
+
+		BeforeEach(func() {
+			logger = NewLogger()
+			handler.Logger = logger
+		})
+
+		It("returns the volume mounts when they are complete", func() {
+			binder.VolumeMounts = []domain.VolumeMount{{
+				Driver:       "nfsdriver",
+				ContainerDir: "/var/vcap/data/shared",
+				Mode:         "rw",
+				DeviceType:   "shared",
+				Device:       domain.VolumeMountDevice{VolumeID: "volume-id"},
+			}}
+
+			writer := bind()
+
+			Expect(writer.Code).To(Equal(http.StatusCreated))
+			Expect(writer.Body.String()).To(MatchJSON(`{
+				"volume_mounts": [{
+					"driver": "nfsdriver",
+					"container_dir": "/var/vcap/data/shared",
+					"mode": "rw",
+					"device_type": "shared",
+					"device": {"volume_id": "volume-id"}
+				}]
+			}`))
+			Expect(logger.Errors).To(BeEmpty())
+		})
+
+		It("returns a logged 500 when a volume mount is incomplete", func() {
+			binder.VolumeMounts = []domain.VolumeMount{{
+				Driver:       "nfsdriver",
+				ContainerDir: "/var/vcap/data/shared",
+				Mode:         "rw",
+				DeviceType:   "shared",
+			}}
+
+			writer := bind()
+
+			Expect(writer.Code).To(Equal(http.StatusInternalServerError))
+			Expect(writer.Body.String()).To(ContainSubstring("volume mount 0 is missing a device.volume_id"))
+			Expect(logger.Errors).To(HaveLen(1))
+			Expect(logger.Errors[0].Data).To(HaveKeyWithValue("error", "volume mount 0 is missing a device.volume_id"))
+		})
+	})
+
+	Context("when the credentials are generated by a provider", func() {
+		var calls int
+
+		bind := func() *httptest.ResponseRecorder {
+			writer := httptest.NewRecorder()
+			reqBody, err := json.Marshal(map[string]interface{}{
+				"service_id": "service-id",
+				"plan_id":    "plan-id",
+				"app_guid":   "app-guid",
+			})
+			if err != nil {
+				panic(err)
+			}
+
+			request, err := http.NewRequest("PUT", "/v2/service_instances/instance-guid/service_bindings/binding-guid", bytes.NewBuffer(reqBody))
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+			return writer
+		}
+
+		BeforeEach(func() {
+			calls = 0
+		})
+
+		It("returns the credentials from the provider", func() {
+			binder.Provider = func() (interface{}, error) {
+				calls++
+				return domain.BindingCredentials{"password": "generated"}, nil
+			}
+
+			writer := bind()
+
+			Expect(writer.Code).To(Equal(http.StatusCreated))
+			Expect(writer.Body.String()).To(MatchJSON(`{"credentials":{"password":"generated"}}`))
+			Expect(calls).To(Equal(1))
+		})
+
+		It("returns a 500 when the provider fails", func() {
+			binder.Provider = func() (interface{}, error) {
+				return nil, errors.New("vault is sealed")
+			}
+
+			writer := bind()
+
+			Expect(writer.Code).To(Equal(http.StatusInternalServerError))
+			Expect(writer.Body.String()).To(MatchJSON(`{"description":"vault is sealed"}`))
+		})
+
+		It("does not call the provider when the bind fails", func() {
+			binder.Provider = func() (interface{}, error) {
+				calls++
+				return domain.BindingCredentials{}, nil
+			}
+			binder.Error = errors.New("bind failed")
+
+			bind()
+
+			Expect(calls).To(Equal(0))
+		})
+	})
+
+	Context("when the binding ID is the same as the instance ID", func() {
+		bind := func(path string) *httptest.ResponseRecorder {
+			writer := httptest.NewRecorder()
+			reqBody, err := json.Marshal(map[string]interface{}{
+				"service_id": "service-id",
+				"plan_id":    "plan-id",
+				"app_guid":   "app-guid",
+			})
+			if err != nil {
+				panic(err)
+			}
+
+			request, err := http.NewRequest("PUT", path, bytes.NewBuffer(reqBody))
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+			return writer
+		}
+
+		It("does not warn by default", func() {
+			writer := bind("/v2/service_instances/same-guid/service_bindings/same-guid")
+
+			Expect(writer.Code).To(Equal(http.StatusCreated))
+			Expect(writer.Header()).NotTo(HaveKey("Warning"))
+		})
+
+		Context("when same IDs are warned about", func() {
+			BeforeEach(func() {
+				handler.WarnSameIDs = true
+			})
+
+			It("binds with a Warning header", func() {
+				writer := bind("/v2/service_instances/same-guid/service_bindings/same-guid")
+
+				Expect(writer.Code).To(Equal(http.StatusCreated))
+				Expect(writer.Header().Get("Warning")).To(Equal(`299 - "binding_id \"same-guid\" is the same as the instance_id"`))
+				Expect(binder.WasCalled).To(BeTrue())
+			})
+
+			It("does not warn when the IDs differ", func() {
+				writer := bind("/v2/service_instances/instance-guid/service_bindings/binding-guid")
+
+				Expect(writer.Header()).NotTo(HaveKey("Warning"))
+			})
+		})
+	})
+
+	Context("when the binding credentials cannot be written as a JSON object", func() {
+		var logger *Logger
+
+		bind := func() *httptest.ResponseRecorder {
+			writer := httptest.NewRecorder()
+			reqBody, err := json.Marshal(map[string]string{
+				"service_id": "service-id",
+				"plan_id":    "plan-id",
+				"app_guid":   "app-guid",
+			})
+			if err != nil {
+				panic(err)
+			}
+
+			request, err := http.NewRequest("PUT", "/v2/service_instances/service-instance-id/service_bindings/service-binding-id", bytes.NewBuffer(reqBody))
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+			return writer
+		}
+
+		BeforeEach(func() {
+			logger = NewLogger()
+			handler.Logger = logger
+		})
+
+		AfterEach(func() {
+			handlers.SetMarshaler(nil)
+		})
+
+		It("returns a logged 500 when the credentials are written as an array", func() {
+			handlers.SetMarshaler(ArrayCredentialsMarshaler{})
+			binder.Credentials = domain.BindingCredentials{"password": "secret"}
+
+			writer := bind()
+
+			Expect(writer.Code).To(Equal(http.StatusInternalServerError))
+			Expect(writer.Body.String()).To(ContainSubstring("binding credentials must be a JSON object"))
+			Expect(writer.Body.String()).NotTo(ContainSubstring("secret"))
+			Expect(logger.Errors).To(HaveLen(1))
+			Expect(logger.Errors[0].Data).To(HaveKeyWithValue("error", "binding credentials must be a JSON object"))
+		})
+
+		It("returns a logged 500 when the credentials cannot be marshaled", func() {
+			binder.Credentials = domain.BindingCredentials{"callback": func() {}}
+
+			writer := bind()
+
+			Expect(writer.Code).To(Equal(http.StatusInternalServerError))
+			Expect(writer.Body.String()).To(ContainSubstring("binding credentials cannot be written as JSON"))
+			Expect(logger.Errors).To(HaveLen(1))
+		})
 	})
 
 	Context("when there is a binding failure", func() {
@@ -200,6 +820,203 @@ var _ = Describe("BindHandler", func() {
 
 			Expect(writer.Body.String()).To(MatchJSON(`{"description":"BANG!"}`))
 		})
+
+		Context("when a logger is provided", func() {
+			var logger *Logger
+
+			BeforeEach(func() {
+				logger = NewLogger()
+				handler.Logger = logger
+			})
+
+			It("logs the error and includes the same reference in the response body", func() {
+				writer := httptest.NewRecorder()
+				reqBody, err := json.Marshal(map[string]string{
+					"service_id": "my-service-id",
+					"plan_id":    "my-plan-id",
+				})
+				if err != nil {
+					panic(err)
+				}
+
+				request, err := http.NewRequest("PUT", "/v2/service_instances/instance-guid/service_bindings/binding-guid", bytes.NewBuffer(reqBody))
+				if err != nil {
+					panic(err)
+				}
+
+				handler.ServeHTTP(writer, request)
+
+				Expect(writer.Code).To(Equal(http.StatusInternalServerError))
+				Expect(logger.Errors).To(HaveLen(1))
+				Expect(logger.Errors[0].Data).To(HaveKeyWithValue("error", "BANG!"))
+
+				ref, ok := logger.Errors[0].Data["ref"].(string)
+				Expect(ok).To(BeTrue())
+				Expect(ref).NotTo(BeEmpty())
+
+				var msg struct {
+					Description string `json:"description"`
+				}
+				Expect(json.Unmarshal(writer.Body.Bytes(), &msg)).To(Succeed())
+				Expect(msg.Description).To(Equal("BANG! (ref: " + ref + ")"))
+			})
+		})
+	})
+
+	Context("when the same binding is requested more than once", func() {
+		bind := func(appGUID string) *httptest.ResponseRecorder {
+			writer := httptest.NewRecorder()
+			reqBody, err := json.Marshal(map[string]string{
+				"service_id": "service-id",
+				"plan_id":    "plan-id",
+				"app_guid":   appGUID,
+			})
+			if err != nil {
+				panic(err)
+			}
+
+			request, err := http.NewRequest("PUT", "/v2/service_instances/service-instance-id/service_bindings/service-binding-id", bytes.NewBuffer(reqBody))
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+			return writer
+		}
+
+		BeforeEach(func() {
+			binder.Fingerprints = map[string]string{}
+			binder.Credentials = domain.BindingCredentials{"password": "secret"}
+		})
+
+		It("returns a 200 with the same credentials when the parameters are identical", func() {
+			Expect(bind("app-guid").Code).To(Equal(http.StatusCreated))
+
+			writer := bind("app-guid")
+
+			Expect(writer.Code).To(Equal(http.StatusOK))
+			Expect(writer.Body.String()).To(MatchJSON(`{"credentials": {"password": "secret"}}`))
+		})
+
+		It("returns a 409 when the parameters differ", func() {
+			Expect(bind("app-guid").Code).To(Equal(http.StatusCreated))
+
+			writer := bind("other-app-guid")
+
+			Expect(writer.Code).To(Equal(http.StatusConflict))
+			Expect(writer.Body.String()).To(MatchJSON(`{}`))
+		})
+
+		It("returns a 409 when only the bind parameters differ", func() {
+			bindWithParameters := func(parameters map[string]interface{}) int {
+				writer := httptest.NewRecorder()
+				reqBody, err := json.Marshal(map[string]interface{}{
+					"service_id": "service-id",
+					"plan_id":    "plan-id",
+					"app_guid":   "app-guid",
+					"parameters": parameters,
+				})
+				if err != nil {
+					panic(err)
+				}
+
+				request, err := http.NewRequest("PUT", "/v2/service_instances/service-instance-id/service_bindings/service-binding-id", bytes.NewBuffer(reqBody))
+				if err != nil {
+					panic(err)
+				}
+
+				handler.ServeHTTP(writer, request)
+				return writer.Code
+			}
+
+			Expect(bindWithParameters(map[string]interface{}{"role": "read"})).To(Equal(http.StatusCreated))
+			Expect(bindWithParameters(map[string]interface{}{"role": "write"})).To(Equal(http.StatusConflict))
+		})
+	})
+
+	Context("when the binder binds asynchronously", func() {
+		var bind func(query string) *httptest.ResponseRecorder
+
+		BeforeEach(func() {
+			binder.IsAsync = true
+			binder.OperationData = "bind-operation"
+			binder.Credentials = domain.BindingCredentials{"password": "secret"}
+
+			bind = func(query string) *httptest.ResponseRecorder {
+				writer := httptest.NewRecorder()
+				reqBody, err := json.Marshal(map[string]string{
+					"service_id": "service-id",
+					"plan_id":    "plan-id",
+					"app_guid":   "app-guid",
+				})
+				if err != nil {
+					panic(err)
+				}
+
+				request, err := http.NewRequest("PUT", "/v2/service_instances/service-instance-id/service_bindings/service-binding-id"+query, bytes.NewBuffer(reqBody))
+				if err != nil {
+					panic(err)
+				}
+
+				handler.ServeHTTP(writer, request)
+				return writer
+			}
+		})
+
+		It("returns a 202 with the operation when the request accepts incomplete responses", func() {
+			writer := bind("?accepts_incomplete=true")
+
+			Expect(binder.WasCalledWith.AcceptsIncomplete).To(BeTrue())
+			Expect(writer.Code).To(Equal(http.StatusAccepted))
+			Expect(writer.Body.String()).To(MatchJSON(`{"operation": "bind-operation"}`))
+		})
+
+		It("returns a 422 and an AsyncRequired error when the request does not accept incomplete responses", func() {
+			writer := bind("")
+
+			Expect(binder.WasCalledWith.AcceptsIncomplete).To(BeFalse())
+			Expect(writer.Code).To(Equal(http.StatusUnprocessableEntity))
+			Expect(writer.Body.String()).To(MatchJSON(`{
+				"error": "AsyncRequired",
+				"description": "this binding can only be created asynchronously"
+			}`))
+		})
+
+		It("returns a 201 with the credentials when the binder completes synchronously", func() {
+			binder.IsAsync = false
+			writer := bind("?accepts_incomplete=true")
+
+			Expect(writer.Code).To(Equal(http.StatusCreated))
+			Expect(writer.Body.String()).To(MatchJSON(`{"credentials": {"password": "secret"}}`))
+		})
+	})
+
+	Context("when the backend is unavailable without a retry delay", func() {
+		BeforeEach(func() {
+			binder.Error = domain.ServiceUnavailableError{Message: "the backend is down"}
+		})
+
+		It("returns a 503 without a Retry-After header", func() {
+			writer := httptest.NewRecorder()
+			reqBody, err := json.Marshal(map[string]string{
+				"service_id": "service-id",
+				"plan_id":    "plan-id",
+			})
+			if err != nil {
+				panic(err)
+			}
+
+			request, err := http.NewRequest("PUT", "/v2/service_instances/service-instance-id/service_bindings/service-binding-id", bytes.NewBuffer(reqBody))
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(writer.Header()).NotTo(HaveKey("Retry-After"))
+			Expect(writer.Body.String()).To(MatchJSON(`{"description": "the backend is down"}`))
+		})
 	})
 
 	Context("when the service binding has already been bound", func() {
@@ -232,6 +1049,23 @@ var _ = Describe("BindHandler", func() {
 		})
 	})
 
+	Context("when the request body is a JSON array", func() {
+		It("returns a 400 without calling the binder", func() {
+			writer := httptest.NewRecorder()
+
+			request, err := http.NewRequest("PUT", "/v2/service_instances/instance-guid/service_bindings/binding-guid", strings.NewReader(` [{"service_id":"service-id","plan_id":"plan-id","app_guid":"app-guid"}]`))
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusBadRequest))
+			Expect(writer.Body.String()).To(MatchJSON(`{"description":"request body must be a JSON object, not an array"}`))
+			Expect(binder.WasCalled).To(BeFalse())
+		})
+	})
+
 	Context("when the request body is not valid JSON", func() {
 		It("should not call the binder", func() {
 			writer := httptest.NewRecorder()
@@ -302,6 +1136,53 @@ var _ = Describe("BindHandler", func() {
 		})
 	})
 
+	Context("when binding endpoints are provided", func() {
+		bind := func(params map[string]string) *httptest.ResponseRecorder {
+			writer := httptest.NewRecorder()
+			reqBody, err := json.Marshal(params)
+			if err != nil {
+				panic(err)
+			}
+
+			request, err := http.NewRequest("PUT", "/v2/service_instances/service-instance-id/service_bindings/service-binding-id", bytes.NewBuffer(reqBody))
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+			return writer
+		}
+
+		BeforeEach(func() {
+			binder.Endpoints = []domain.Endpoint{
+				{Host: "db.example.com", Ports: []string{"5432"}},
+			}
+		})
+
+		It("returns the endpoints for a bind to an app", func() {
+			writer := bind(map[string]string{
+				"service_id": "service-id",
+				"plan_id":    "plan-id",
+				"app_guid":   "app-guid",
+			})
+
+			Expect(writer.Code).To(Equal(http.StatusCreated))
+			Expect(writer.Body.String()).To(MatchJSON(`{
+				"endpoints": [{"host": "db.example.com", "ports": ["5432"]}]
+			}`))
+		})
+
+		It("omits the endpoints for a service key", func() {
+			writer := bind(map[string]string{
+				"service_id": "service-id",
+				"plan_id":    "plan-id",
+			})
+
+			Expect(writer.Code).To(Equal(http.StatusCreated))
+			Expect(writer.Body.String()).To(MatchJSON(`{}`))
+		})
+	})
+
 	Context("when the request body is missing the app_guid field", func() {
 		It("should succeed, in order to support app-less service keys", func() {
 			writer := httptest.NewRecorder()
@@ -333,4 +1214,42 @@ var _ = Describe("BindHandler", func() {
 			}))
 		})
 	})
+
+	Context("when the request body is not read before the timeout", func() {
+		var bodyWriter *io.PipeWriter
+		var request *http.Request
+
+		BeforeEach(func() {
+			handler.BodyReadTimeout = 10 * time.Millisecond
+
+			var bodyReader *io.PipeReader
+			bodyReader, bodyWriter = io.Pipe()
+
+			var err error
+			request, err = http.NewRequest("PUT", "/v2/service_instances/instance-guid/service_bindings/binding-guid", bodyReader)
+			if err != nil {
+				panic(err)
+			}
+		})
+
+		AfterEach(func() {
+			bodyWriter.Close()
+		})
+
+		It("should not call the binder", func() {
+			handler.ServeHTTP(httptest.NewRecorder(), request)
+
+			Expect(binder.WasCalled).To(BeFalse())
+		})
+
+		It("should return a 408 and an error message", func() {
+			writer := httptest.NewRecorder()
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusRequestTimeout))
+			Expect(writer.Header()["Content-Type"]).To(Equal([]string{"application/json"}))
+			Expect(writer.Body.String()).To(MatchJSON(`{"description":"timed out reading request body"}`))
+		})
+	})
 })
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pivotal-cf-experimental/envoy/domain"
+)
+
+type counter interface {
+	IncrementCounter(name string)
+}
+
+const (
+	CatalogCacheHitCounter  = "catalog.cache.hit"
+	CatalogCacheMissCounter = "catalog.cache.miss"
+)
+
+// CatalogCache keeps the catalog returned by a cataloger for the TTL, so
+// that a broker whose catalog is expensive to build is not asked for it on
+// every request. Each lookup is counted as a hit or a miss when metrics are
+// configured. It is safe for concurrent use.
+type CatalogCache struct {
+	cataloger
+	Metrics counter
+
+	ttl       time.Duration
+	mutex     sync.Mutex
+	catalog   domain.Catalog
+	fetchedAt time.Time
+}
+
+func NewCatalogCache(cataloger cataloger, ttl time.Duration) *CatalogCache {
+	return &CatalogCache{
+		cataloger: cataloger,
+		ttl:       ttl,
+	}
+}
+
+func (c *CatalogCache) Catalog() domain.Catalog {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.fetchedAt.IsZero() && time.Since(c.fetchedAt) < c.ttl {
+		c.count(CatalogCacheHitCounter)
+		return c.catalog
+	}
+
+	c.count(CatalogCacheMissCounter)
+	c.catalog = c.cataloger.Catalog()
+	c.fetchedAt = time.Now()
+
+	return c.catalog
+}
+
+func (c *CatalogCache) count(name string) {
+	if c.Metrics != nil {
+		c.Metrics.IncrementCounter(name)
+	}
+}
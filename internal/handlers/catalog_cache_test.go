@@ -0,0 +1,71 @@
+package handlers_test
+
+import (
+	"time"
+
+	"github.com/pivotal-cf-experimental/envoy/domain"
+	"github.com/pivotal-cf-experimental/envoy/internal/handlers"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type CountingCataloger struct {
+	Calls int
+}
+
+func (c *CountingCataloger) Catalog() domain.Catalog {
+	c.Calls++
+	return domain.Catalog{Services: []domain.Service{{ID: "service-id"}}}
+}
+
+type Counters map[string]int
+
+func (c Counters) IncrementCounter(name string) {
+	c[name]++
+}
+
+var _ = Describe("CatalogCache", func() {
+	var cataloger *CountingCataloger
+	var counters Counters
+
+	BeforeEach(func() {
+		cataloger = &CountingCataloger{}
+		counters = Counters{}
+	})
+
+	It("counts a miss when the catalog is fetched cold, and a hit when it is served from the cache", func() {
+		cache := handlers.NewCatalogCache(cataloger, time.Hour)
+		cache.Metrics = counters
+
+		Expect(cache.Catalog().Services).To(HaveLen(1))
+		Expect(counters).To(Equal(Counters{handlers.CatalogCacheMissCounter: 1}))
+
+		Expect(cache.Catalog().Services).To(HaveLen(1))
+		Expect(counters).To(Equal(Counters{
+			handlers.CatalogCacheMissCounter: 1,
+			handlers.CatalogCacheHitCounter:  1,
+		}))
+		Expect(cataloger.Calls).To(Equal(1))
+	})
+
+	It("fetches the catalog again once the TTL has passed", func() {
+		cache := handlers.NewCatalogCache(cataloger, 10*time.Millisecond)
+		cache.Metrics = counters
+
+		cache.Catalog()
+		Eventually(func() int {
+			cache.Catalog()
+			return cataloger.Calls
+		}).Should(Equal(2))
+		Expect(counters[handlers.CatalogCacheMissCounter]).To(Equal(2))
+	})
+
+	It("does not require metrics", func() {
+		cache := handlers.NewCatalogCache(cataloger, time.Hour)
+
+		cache.Catalog()
+		cache.Catalog()
+		Expect(cataloger.Calls).To(Equal(1))
+	})
+})
@@ -1,7 +1,12 @@
 package handlers
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/pivotal-cf-experimental/envoy/domain"
 )
@@ -10,8 +15,14 @@ type cataloger interface {
 	Catalog() domain.Catalog
 }
 
+type catalogTransformer interface {
+	TransformCatalog(domain.Catalog) domain.Catalog
+}
+
 type CatalogHandler struct {
 	cataloger
+	Transformer catalogTransformer
+	Logger      Logger
 }
 
 func NewCatalogHandler(cataloger cataloger) CatalogHandler {
@@ -21,5 +32,102 @@ func NewCatalogHandler(cataloger cataloger) CatalogHandler {
 }
 
 func (handler CatalogHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	respond(w, http.StatusOK, handler.cataloger.Catalog())
+	catalog := handler.cataloger.Catalog()
+	if handler.Transformer != nil {
+		catalog = handler.Transformer.TransformCatalog(copyCatalog(catalog))
+	}
+
+	if serviceIDs, ok := req.URL.Query()["service_id"]; ok {
+		catalog = filterServices(catalog, serviceIDs)
+	}
+
+	if value := req.URL.Query().Get("plan_limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			respond(w, http.StatusBadRequest, Failure{Description: "plan_limit must be a positive integer"})
+			return
+		}
+
+		catalog = limitPlans(catalog, limit)
+	}
+
+	if catalog.Services == nil {
+		catalog.Services = []domain.Service{}
+	}
+
+	body, err := marshalCatalog(catalog)
+	if err != nil {
+		respondWithInternalError(w, handler.Logger, err)
+		return
+	}
+
+	respondWithBody(w, http.StatusOK, body)
+}
+
+// marshalCatalog writes the catalog as JSON, checking that it is an object
+// wrapping the services in a "services" array, since the platform rejects a
+// catalog in any other shape. This catches replacement marshalers that
+// write the catalog as a bare array of services.
+func marshalCatalog(catalog domain.Catalog) ([]byte, error) {
+	body, err := jsonMarshaler.Marshal(catalog)
+	if err != nil {
+		return nil, fmt.Errorf("catalog cannot be written as JSON: %s", err)
+	}
+
+	var wrapper map[string]json.RawMessage
+	if err := json.Unmarshal(body, &wrapper); err != nil {
+		return nil, errors.New(`catalog must be a JSON object with a "services" array`)
+	}
+
+	if services := bytes.TrimSpace(wrapper["services"]); len(services) == 0 || services[0] != '[' {
+		return nil, errors.New(`catalog must be a JSON object with a "services" array`)
+	}
+
+	return body, nil
+}
+
+// copyCatalog returns a copy of the catalog with its own slices of services
+// and plans, so that a transformer can modify them without changing the
+// catalog held by the broker.
+func copyCatalog(catalog domain.Catalog) domain.Catalog {
+	services := make([]domain.Service, len(catalog.Services))
+	for i, service := range catalog.Services {
+		service.Plans = append([]domain.Plan(nil), service.Plans...)
+		services[i] = service
+	}
+
+	return domain.Catalog{Services: services}
+}
+
+// filterServices returns a copy of the catalog containing only the services
+// with the given IDs. IDs that are not in the catalog are ignored.
+func filterServices(catalog domain.Catalog, serviceIDs []string) domain.Catalog {
+	wanted := map[string]bool{}
+	for _, id := range serviceIDs {
+		wanted[id] = true
+	}
+
+	services := []domain.Service{}
+	for _, service := range catalog.Services {
+		if wanted[service.ID] {
+			services = append(services, service)
+		}
+	}
+
+	return domain.Catalog{Services: services}
+}
+
+// limitPlans returns a copy of the catalog in which each service has at
+// most limit plans. Plans are kept in the order the broker lists them, so
+// brokers should list their most relevant plans first.
+func limitPlans(catalog domain.Catalog, limit int) domain.Catalog {
+	services := make([]domain.Service, len(catalog.Services))
+	for i, service := range catalog.Services {
+		if len(service.Plans) > limit {
+			service.Plans = service.Plans[:limit]
+		}
+		services[i] = service
+	}
+
+	return domain.Catalog{Services: services}
 }
@@ -13,6 +13,18 @@ import (
 	. "github.com/onsi/gomega"
 )
 
+type MultiServiceCataloger struct{}
+
+func (c MultiServiceCataloger) Catalog() domain.Catalog {
+	return domain.Catalog{
+		Services: []domain.Service{
+			{ID: "service-a", Name: "a"},
+			{ID: "service-b", Name: "b"},
+			{ID: "service-c", Name: "c"},
+		},
+	}
+}
+
 type Cataloger struct{}
 
 func NewCataloger() Cataloger {
@@ -76,6 +88,36 @@ func (c Cataloger) Catalog() domain.Catalog {
 	}
 }
 
+type TagTransformer struct {
+	Tag string
+}
+
+func (t TagTransformer) TransformCatalog(catalog domain.Catalog) domain.Catalog {
+	for i := range catalog.Services {
+		catalog.Services[i].Tags = append(catalog.Services[i].Tags, t.Tag)
+	}
+
+	return catalog
+}
+
+// BareServicesMarshaler writes a catalog as a bare array of its services,
+// as a misconfigured JSON library might.
+type BareServicesMarshaler struct{}
+
+func (BareServicesMarshaler) Marshal(v interface{}) ([]byte, error) {
+	if catalog, ok := v.(domain.Catalog); ok {
+		return json.Marshal(catalog.Services)
+	}
+
+	return json.Marshal(v)
+}
+
+type EmptyCataloger struct{}
+
+func (EmptyCataloger) Catalog() domain.Catalog {
+	return domain.Catalog{}
+}
+
 var _ = Describe("CatalogHandler", func() {
 	var handler handlers.CatalogHandler
 	var cataloger Cataloger
@@ -106,4 +148,215 @@ var _ = Describe("CatalogHandler", func() {
 
 		Expect(responseStructure).To(Equal(cataloger.Catalog()))
 	})
+
+	It("wraps the services in a top-level services object", func() {
+		writer := httptest.NewRecorder()
+		request, err := http.NewRequest("GET", "/v2/catalog", nil)
+		if err != nil {
+			panic(err)
+		}
+
+		handler.ServeHTTP(writer, request)
+
+		var wrapper map[string]json.RawMessage
+		Expect(json.Unmarshal(writer.Body.Bytes(), &wrapper)).To(Succeed())
+		Expect(wrapper).To(HaveLen(1))
+		Expect(wrapper).To(HaveKey("services"))
+		Expect(string(wrapper["services"])).To(HavePrefix("["))
+	})
+
+	It("serves a catalog without services as an empty services array", func() {
+		handler = handlers.NewCatalogHandler(EmptyCataloger{})
+
+		writer := httptest.NewRecorder()
+		request, err := http.NewRequest("GET", "/v2/catalog", nil)
+		if err != nil {
+			panic(err)
+		}
+
+		handler.ServeHTTP(writer, request)
+
+		Expect(writer.Code).To(Equal(http.StatusOK))
+		Expect(writer.Body.String()).To(MatchJSON(`{"services":[]}`))
+	})
+
+	Context("when the catalog would be written as a top-level array", func() {
+		BeforeEach(func() {
+			handlers.SetMarshaler(BareServicesMarshaler{})
+		})
+
+		AfterEach(func() {
+			handlers.SetMarshaler(nil)
+		})
+
+		It("returns a 500 rather than serving the array", func() {
+			writer := httptest.NewRecorder()
+			request, err := http.NewRequest("GET", "/v2/catalog", nil)
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusInternalServerError))
+			Expect(writer.Body.String()).To(MatchJSON(`{"description":"catalog must be a JSON object with a \"services\" array"}`))
+		})
+	})
+
+	It("does not prevent the catalog from being cached", func() {
+		writer := httptest.NewRecorder()
+		request, err := http.NewRequest("GET", "/v2/catalog", nil)
+		if err != nil {
+			panic(err)
+		}
+
+		handler.ServeHTTP(writer, request)
+
+		Expect(writer.Header()).NotTo(HaveKey("Cache-Control"))
+		Expect(writer.Header()).NotTo(HaveKey("Pragma"))
+	})
+
+	Context("when the plan_limit query parameter is provided", func() {
+		It("caps the number of plans returned for each service", func() {
+			writer := httptest.NewRecorder()
+			request, err := http.NewRequest("GET", "/v2/catalog?plan_limit=1", nil)
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusOK))
+
+			var responseStructure domain.Catalog
+			err = json.Unmarshal(writer.Body.Bytes(), &responseStructure)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(responseStructure.Services).To(HaveLen(1))
+			Expect(responseStructure.Services[0].Plans).To(HaveLen(1))
+			Expect(responseStructure.Services[0].Plans[0].ID).To(Equal("test-plan-1"))
+		})
+
+		It("returns every plan when the limit exceeds the number of plans", func() {
+			writer := httptest.NewRecorder()
+			request, err := http.NewRequest("GET", "/v2/catalog?plan_limit=50", nil)
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+
+			var responseStructure domain.Catalog
+			err = json.Unmarshal(writer.Body.Bytes(), &responseStructure)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(responseStructure.Services[0].Plans).To(HaveLen(2))
+		})
+
+		It("returns a 400 when the limit is not a positive integer", func() {
+			writer := httptest.NewRecorder()
+			request, err := http.NewRequest("GET", "/v2/catalog?plan_limit=none", nil)
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusBadRequest))
+			Expect(writer.Body.String()).To(MatchJSON(`{"description":"plan_limit must be a positive integer"}`))
+		})
+	})
+
+	Context("when service_id query parameters are provided", func() {
+		BeforeEach(func() {
+			handler = handlers.NewCatalogHandler(MultiServiceCataloger{})
+		})
+
+		serviceIDs := func(query string) []string {
+			writer := httptest.NewRecorder()
+			request, err := http.NewRequest("GET", "/v2/catalog?"+query, nil)
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+			Expect(writer.Code).To(Equal(http.StatusOK))
+
+			var responseStructure domain.Catalog
+			err = json.Unmarshal(writer.Body.Bytes(), &responseStructure)
+			Expect(err).NotTo(HaveOccurred())
+
+			ids := []string{}
+			for _, service := range responseStructure.Services {
+				ids = append(ids, service.ID)
+			}
+			return ids
+		}
+
+		It("returns the full catalog when there is no filter", func() {
+			Expect(serviceIDs("")).To(Equal([]string{"service-a", "service-b", "service-c"}))
+		})
+
+		It("returns only the requested service", func() {
+			Expect(serviceIDs("service_id=service-b")).To(Equal([]string{"service-b"}))
+		})
+
+		It("returns each of the requested services", func() {
+			Expect(serviceIDs("service_id=service-c&service_id=service-a")).To(Equal([]string{"service-a", "service-c"}))
+		})
+
+		It("ignores unknown service IDs", func() {
+			Expect(serviceIDs("service_id=service-a&service_id=unknown")).To(Equal([]string{"service-a"}))
+			Expect(serviceIDs("service_id=unknown")).To(BeEmpty())
+		})
+	})
+
+	Context("when a transformer is provided", func() {
+		var stored domain.Catalog
+
+		BeforeEach(func() {
+			stored = domain.Catalog{
+				Services: []domain.Service{
+					{ID: "service-a", Tags: make([]string, 1, 4)},
+					{ID: "service-b"},
+				},
+			}
+			stored.Services[0].Tags[0] = "existing"
+
+			handler = handlers.NewCatalogHandler(StaticCataloger{stored})
+			handler.Transformer = TagTransformer{Tag: "staging"}
+		})
+
+		serve := func() domain.Catalog {
+			writer := httptest.NewRecorder()
+			request, err := http.NewRequest("GET", "/v2/catalog", nil)
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+			Expect(writer.Code).To(Equal(http.StatusOK))
+
+			var catalog domain.Catalog
+			Expect(json.Unmarshal(writer.Body.Bytes(), &catalog)).To(Succeed())
+			return catalog
+		}
+
+		It("returns the transformed catalog", func() {
+			catalog := serve()
+
+			Expect(catalog.Services).To(HaveLen(2))
+			Expect(catalog.Services[0].Tags).To(Equal([]string{"existing", "staging"}))
+			Expect(catalog.Services[1].Tags).To(Equal([]string{"staging"}))
+		})
+
+		It("transforms the catalog on each request without modifying the stored catalog", func() {
+			serve()
+			catalog := serve()
+
+			Expect(catalog.Services[0].Tags).To(Equal([]string{"existing", "staging"}))
+			Expect(stored.Services[0].Tags).To(Equal([]string{"existing"}))
+			Expect(stored.Services[1].Tags).To(BeNil())
+		})
+	})
 })
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pivotal-cf-experimental/envoy/domain"
+)
+
+// DeprecationWarningCode is the warn-code of the Warning header written by
+// Deprecate. It is the code reserved for miscellaneous persistent warnings.
+const DeprecationWarningCode = 299
+
+// Deprecate adds a Warning header to the response telling the client that
+// it has used something the broker considers deprecated. The request is
+// otherwise served as normal. It must be called before the response status
+// is written.
+func Deprecate(w http.ResponseWriter, message string) {
+	Warn(w, message)
+}
+
+// Warn adds a Warning header to the response with the given message, such
+// as to tell the client about a likely mistake in a request that the broker
+// serves anyway. It must be called before the response status is written.
+func Warn(w http.ResponseWriter, message string) {
+	text := strings.Replace(strings.Replace(message, `\`, `\\`, -1), `"`, `\"`, -1)
+	w.Header().Add("Warning", fmt.Sprintf(`%d - "%s"`, DeprecationWarningCode, text))
+}
+
+// warnSameIDs adds a Warning header when the binding ID is the same as the
+// ID of the service instance. This is allowed, but is more often the sign
+// of a client that has passed the wrong ID.
+func warnSameIDs(w http.ResponseWriter, instanceID, bindingID string) {
+	if instanceID == bindingID {
+		Warn(w, fmt.Sprintf("binding_id %q is the same as the instance_id", bindingID))
+	}
+}
+
+// warnUnrecognizedParameters adds a Warning header listing the parameters
+// that are not declared in the schema, if there are any.
+func warnUnrecognizedParameters(w http.ResponseWriter, schema *domain.InputParametersSchema, parameters map[string]interface{}) {
+	if unrecognized := schema.UnrecognizedParameters(parameters); len(unrecognized) > 0 {
+		Warn(w, fmt.Sprintf("unrecognized parameters: %s", strings.Join(unrecognized, ", ")))
+	}
+}
@@ -0,0 +1,46 @@
+package handlers_test
+
+import (
+	"net/http/httptest"
+
+	"github.com/pivotal-cf-experimental/envoy/internal/handlers"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Warn", func() {
+	It("adds a Warning header with the message", func() {
+		writer := httptest.NewRecorder()
+		handlers.Warn(writer, "unrecognized parameters: zize")
+
+		Expect(writer.Header()["Warning"]).To(Equal([]string{`299 - "unrecognized parameters: zize"`}))
+	})
+})
+
+var _ = Describe("Deprecate", func() {
+	It("adds a 299 Warning header with the message", func() {
+		writer := httptest.NewRecorder()
+
+		handlers.Deprecate(writer, "this field is deprecated")
+
+		Expect(writer.Header().Get("Warning")).To(Equal(`299 - "this field is deprecated"`))
+	})
+
+	It("escapes quotes in the message", func() {
+		writer := httptest.NewRecorder()
+
+		handlers.Deprecate(writer, `use "plan_id" instead`)
+
+		Expect(writer.Header().Get("Warning")).To(Equal(`299 - "use \"plan_id\" instead"`))
+	})
+
+	It("adds a header for each warning", func() {
+		writer := httptest.NewRecorder()
+
+		handlers.Deprecate(writer, "first")
+		handlers.Deprecate(writer, "second")
+
+		Expect(writer.Header()["Warning"]).To(Equal([]string{`299 - "first"`, `299 - "second"`}))
+	})
+})
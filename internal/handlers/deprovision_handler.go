@@ -2,18 +2,30 @@ package handlers
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 	"regexp"
+	"time"
 
 	"github.com/pivotal-cf-experimental/envoy/domain"
 )
 
 type deprovisioner interface {
-	Deprovision(domain.DeprovisionRequest) error
+	Deprovision(domain.DeprovisionRequest) (domain.DeprovisionResponse, error)
+}
+
+type provisionRequestForgetter interface {
+	Forget(instanceID string)
 }
 
 type DeprovisionHandler struct {
 	deprovisioner
+	BodyReadTimeout time.Duration
+	Logger          Logger
+	Cataloger       cataloger
+	Requests        provisionRequestForgetter
+	Signer          operationSigner
+	Instances       serviceInstanceDetailer
 }
 
 func NewDeprovisionHandler(deprovisioner deprovisioner) DeprovisionHandler {
@@ -23,25 +35,73 @@ func NewDeprovisionHandler(deprovisioner deprovisioner) DeprovisionHandler {
 }
 
 func (handler DeprovisionHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	request, err := handler.Parse(req)
+	request, err := handler.Parse(withBodyInterrupter(w, req))
 	if err != nil {
-		respond(w, http.StatusBadRequest, Failure{err.Error()})
+		switch err {
+		case errBodyReadTimeout:
+			respond(w, http.StatusRequestTimeout, Failure{Description: err.Error()})
+		default:
+			respond(w, http.StatusBadRequest, Failure{Description: err.Error()})
+		}
+		return
+	}
+
+	query := req.URL.Query()
+	if query.Get("service_id") == "" || query.Get("plan_id") == "" {
+		Deprecate(w, "sending service_id and plan_id in the request body is deprecated; use query parameters instead")
+	}
+
+	if err := handler.Validate(request); err != nil {
+		respond(w, http.StatusBadRequest, Failure{Description: err.Error()})
+		return
+	}
+
+	if !request.AcceptsIncomplete && handler.Cataloger != nil && handler.Cataloger.Catalog().IsAsyncOnly(request.ServiceID, request.PlanID) {
+		respond(w, http.StatusUnprocessableEntity, Failure{
+			Error:       "AsyncRequired",
+			Description: fmt.Sprintf("plan %q can only be deprovisioned asynchronously", request.PlanID),
+		})
 		return
 	}
 
-	err = handler.deprovisioner.Deprovision(request)
+	syncOnly := handler.Cataloger != nil && handler.Cataloger.Catalog().IsSyncOnly(request.ServiceID, request.PlanID)
+	if syncOnly {
+		request.AcceptsIncomplete = false
+	}
+
+	response, err := handler.deprovisioner.Deprovision(request)
 	if err != nil {
-		switch err.(type) {
-		case domain.ServiceInstanceNotFoundError:
+		switch e := err.(type) {
+		case domain.ServiceInstanceNotFoundError, domain.ServiceInstanceGoneError:
 			respond(w, http.StatusGone, EmptyJSON)
-		default:
-			respond(w, http.StatusInternalServerError, Failure{
+		case domain.AsyncRequiredError:
+			respond(w, http.StatusUnprocessableEntity, Failure{
+				Error:       "AsyncRequired",
 				Description: err.Error(),
 			})
+		case domain.ServiceUnavailableError:
+			respondUnavailable(w, e)
+		default:
+			respondWithInternalError(w, handler.Logger, err)
 		}
 		return
 	}
 
+	if response.IsAsync && !syncOnly {
+		operation := signOperation(handler.Signer, response.OperationData)
+		w.Header().Set("Location", LastOperationURL(request.InstanceID, request.ServiceID, request.PlanID, operation))
+		respond(w, http.StatusAccepted, struct {
+			Operation string `json:"operation,omitempty"`
+		}{
+			Operation: operation,
+		})
+		return
+	}
+
+	if handler.Requests != nil {
+		handler.Requests.Forget(request.InstanceID)
+	}
+
 	respond(w, http.StatusOK, EmptyJSON)
 }
 
@@ -52,13 +112,75 @@ func (handler DeprovisionHandler) Parse(req *http.Request) (domain.DeprovisionRe
 	serviceIDValues := req.URL.Query()["service_id"]
 	planIDValues := req.URL.Query()["plan_id"]
 
+	var params deprovisionParams
 	if len(serviceIDValues) != 1 || len(planIDValues) != 1 {
+		var err error
+		params, err = handler.parseBody(req)
+		if err != nil {
+			return domain.DeprovisionRequest{}, err
+		}
+	}
+
+	if len(serviceIDValues) == 1 {
+		params.ServiceID = serviceIDValues[0]
+	}
+
+	if len(planIDValues) == 1 {
+		params.PlanID = planIDValues[0]
+	}
+
+	if len(params.ServiceID) == 0 || len(params.PlanID) == 0 {
 		return domain.DeprovisionRequest{}, errors.New("query parameters 'service_id' and 'plan_id' are required.")
 	}
 
 	return domain.DeprovisionRequest{
-		InstanceID: matches[1],
-		ServiceID:  serviceIDValues[0],
-		PlanID:     planIDValues[0],
+		InstanceID:        matches[1],
+		ServiceID:         params.ServiceID,
+		PlanID:            params.PlanID,
+		AcceptsIncomplete: req.URL.Query().Get("accepts_incomplete") == "true",
 	}, nil
 }
+
+// Validate checks that the service_id of the deprovision request matches
+// the service that the instance was provisioned with, when the handler can
+// look up service instances. The plan_id is not checked, since the client
+// may not yet know about a recent plan change. Instances that cannot be
+// looked up are left to the deprovisioner.
+func (handler DeprovisionHandler) Validate(request domain.DeprovisionRequest) error {
+	if handler.Instances == nil {
+		return nil
+	}
+
+	details, err := handler.Instances.ServiceInstanceDetails(domain.ServiceInstanceDetailsRequest{InstanceID: request.InstanceID})
+	if err != nil || details.ServiceID == "" {
+		return nil
+	}
+
+	if details.ServiceID != request.ServiceID {
+		return fmt.Errorf("service_id %q does not match the service %q of service instance %q", request.ServiceID, details.ServiceID, request.InstanceID)
+	}
+
+	return nil
+}
+
+type deprovisionParams struct {
+	ServiceID string `json:"service_id"`
+	PlanID    string `json:"plan_id"`
+}
+
+// parseBody supports older clients that send the service_id and plan_id
+// in the request body rather than the query string. Any body that cannot
+// be read as a JSON object is ignored, but errBodyReadTimeout is returned
+// when the body is not read before the handler's BodyReadTimeout.
+func (handler DeprovisionHandler) parseBody(req *http.Request) (deprovisionParams, error) {
+	var params deprovisionParams
+	if req.Body == nil {
+		return params, nil
+	}
+
+	if err := decodeBody(req, handler.BodyReadTimeout, &params); err == errBodyReadTimeout {
+		return deprovisionParams{}, err
+	}
+
+	return params, nil
+}
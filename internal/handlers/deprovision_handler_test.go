@@ -4,8 +4,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"time"
 
 	"github.com/pivotal-cf-experimental/envoy/domain"
 	"github.com/pivotal-cf-experimental/envoy/internal/handlers"
@@ -17,13 +20,18 @@ import (
 type Deprovisioner struct {
 	WasCalledWith    domain.DeprovisionRequest
 	WasCalled        bool
+	IsAsync          bool
+	OperationData    string
 	DeprovisionError error
 }
 
-func (d *Deprovisioner) Deprovision(deprovisionRequest domain.DeprovisionRequest) error {
+func (d *Deprovisioner) Deprovision(deprovisionRequest domain.DeprovisionRequest) (domain.DeprovisionResponse, error) {
 	d.WasCalledWith = deprovisionRequest
 	d.WasCalled = true
-	return d.DeprovisionError
+	return domain.DeprovisionResponse{
+		IsAsync:       d.IsAsync,
+		OperationData: d.OperationData,
+	}, d.DeprovisionError
 }
 
 func NewDeprovisioner() *Deprovisioner {
@@ -58,7 +66,7 @@ var _ = Describe("DeprovisionHandler", func() {
 			ServiceID:  "the-sshfs-service-id",
 			PlanID:     "the-1gb-plan-id",
 		}))
-
+		Expect(writer.Header()).NotTo(HaveKey("Warning"))
 	})
 
 	Context("when the deprovisioner succeeds", func() {
@@ -101,6 +109,25 @@ var _ = Describe("DeprovisionHandler", func() {
 		})
 	})
 
+	Context("when the service instance has already been deprovisioned", func() {
+		It("returns a 410 Gone with JSON {}", func() {
+			writer := httptest.NewRecorder()
+			request, err := http.NewRequest("DELETE",
+				"/v2/service_instances/a-deleted-service-instance-id?plan_id=some-plan-id&service_id=some-service-id",
+				nil)
+			if err != nil {
+				panic(err)
+			}
+
+			deprovisioner.DeprovisionError = domain.ServiceInstanceGoneError("that instance is gone")
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusGone))
+			Expect(writer.Body.String()).To(MatchJSON("{}"))
+		})
+	})
+
 	Context("when the deprovisioner fails", func() {
 		It("returns a 500 error with the message", func() {
 			writer := httptest.NewRecorder()
@@ -120,6 +147,196 @@ var _ = Describe("DeprovisionHandler", func() {
 		})
 	})
 
+	Context("when the backend is unavailable", func() {
+		It("returns a 503 with a Retry-After header", func() {
+			writer := httptest.NewRecorder()
+			request, err := http.NewRequest("DELETE", "/v2/service_instances/service-instance-id?plan_id=some-plan-id&service_id=some-service-id",
+				nil)
+			if err != nil {
+				panic(err)
+			}
+
+			deprovisioner.DeprovisionError = domain.ServiceUnavailableError{
+				Message:    "the database is restarting",
+				RetryAfter: 1500 * time.Millisecond,
+			}
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(writer.Header().Get("Retry-After")).To(Equal("2"))
+			Expect(writer.Body.String()).To(MatchJSON(`{"description": "the database is restarting"}`))
+		})
+	})
+
+	Context("when the plan declares whether it deprovisions asynchronously", func() {
+		deprovision := func(planID, query string) *httptest.ResponseRecorder {
+			writer := httptest.NewRecorder()
+			request, err := http.NewRequest("DELETE", "/v2/service_instances/service-instance-id?service_id=my-service-id&plan_id="+planID+query, nil)
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+			return writer
+		}
+
+		BeforeEach(func() {
+			handler.Cataloger = StaticCataloger{domain.Catalog{
+				Services: []domain.Service{
+					{
+						ID: "my-service-id",
+						Plans: []domain.Plan{
+							{ID: "async-plan-id", AsyncOnly: true},
+							{ID: "sync-plan-id", SyncOnly: true},
+						},
+					},
+				},
+			}}
+		})
+
+		It("rejects a request for an asynchronous plan that does not accept incomplete responses", func() {
+			writer := deprovision("async-plan-id", "")
+
+			Expect(writer.Code).To(Equal(http.StatusUnprocessableEntity))
+			Expect(writer.Body.String()).To(MatchJSON(`{
+				"error": "AsyncRequired",
+				"description": "plan \"async-plan-id\" can only be deprovisioned asynchronously"
+			}`))
+			Expect(deprovisioner.WasCalled).To(BeFalse())
+		})
+
+		It("deprovisions an asynchronous plan when the request accepts incomplete responses", func() {
+			writer := deprovision("async-plan-id", "&accepts_incomplete=true")
+
+			Expect(writer.Code).To(Equal(http.StatusOK))
+			Expect(deprovisioner.WasCalledWith.AcceptsIncomplete).To(BeTrue())
+		})
+
+		It("deprovisions a synchronous plan without accepting incomplete responses", func() {
+			writer := deprovision("sync-plan-id", "&accepts_incomplete=true")
+
+			Expect(writer.Code).To(Equal(http.StatusOK))
+			Expect(deprovisioner.WasCalledWith.AcceptsIncomplete).To(BeFalse())
+		})
+	})
+
+	Context("when the deprovision is asynchronous", func() {
+		var writer *httptest.ResponseRecorder
+
+		BeforeEach(func() {
+			deprovisioner.IsAsync = true
+			deprovisioner.OperationData = "delete-1"
+		})
+
+		JustBeforeEach(func() {
+			writer = httptest.NewRecorder()
+			request, err := http.NewRequest("DELETE", "/v2/service_instances/service-instance-id?service_id=my-service-id&plan_id=my-plan-id&accepts_incomplete=true", nil)
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+		})
+
+		It("returns a 202 with the operation and the last_operation URL", func() {
+			Expect(writer.Code).To(Equal(http.StatusAccepted))
+			Expect(writer.Body.String()).To(MatchJSON(`{"operation":"delete-1"}`))
+			Expect(writer.Header().Get("Location")).To(Equal(
+				"/v2/service_instances/service-instance-id/last_operation?operation=delete-1&plan_id=my-plan-id&service_id=my-service-id"))
+		})
+
+		Context("and the plan is declared synchronous-only", func() {
+			BeforeEach(func() {
+				handler.Cataloger = StaticCataloger{domain.Catalog{
+					Services: []domain.Service{{
+						ID:    "my-service-id",
+						Plans: []domain.Plan{{ID: "my-plan-id", SyncOnly: true}},
+					}},
+				}}
+			})
+
+			It("returns a 200", func() {
+				Expect(writer.Code).To(Equal(http.StatusOK))
+				Expect(writer.Body.String()).To(MatchJSON(`{}`))
+			})
+		})
+	})
+
+	Context("when service instances can be looked up", func() {
+		var detailer *ServiceInstanceDetailer
+
+		deprovision := func(serviceID, planID string) *httptest.ResponseRecorder {
+			writer := httptest.NewRecorder()
+			request, err := http.NewRequest("DELETE", "/v2/service_instances/service-instance-id?service_id="+serviceID+"&plan_id="+planID, nil)
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+			return writer
+		}
+
+		BeforeEach(func() {
+			detailer = NewServiceInstanceDetailer()
+			detailer.Details = domain.ServiceInstanceDetails{ServiceID: "my-service-id", PlanID: "my-plan-id"}
+			handler.Instances = detailer
+		})
+
+		It("deprovisions when the service_id matches the instance's service", func() {
+			writer := deprovision("my-service-id", "my-plan-id")
+
+			Expect(writer.Code).To(Equal(http.StatusOK))
+			Expect(detailer.WasCalledWith.InstanceID).To(Equal("service-instance-id"))
+			Expect(deprovisioner.WasCalled).To(BeTrue())
+		})
+
+		It("returns a 400 without calling the deprovisioner when the service_id does not match", func() {
+			writer := deprovision("other-service-id", "my-plan-id")
+
+			Expect(writer.Code).To(Equal(http.StatusBadRequest))
+			Expect(writer.Body.String()).To(MatchJSON(`{
+				"description": "service_id \"other-service-id\" does not match the service \"my-service-id\" of service instance \"service-instance-id\""
+			}`))
+			Expect(deprovisioner.WasCalled).To(BeFalse())
+		})
+
+		It("deprovisions when only the plan_id is stale", func() {
+			writer := deprovision("my-service-id", "old-plan-id")
+
+			Expect(writer.Code).To(Equal(http.StatusOK))
+			Expect(deprovisioner.WasCalled).To(BeTrue())
+		})
+
+		It("leaves instances that cannot be looked up to the deprovisioner", func() {
+			detailer.Error = domain.ServiceInstanceNotFoundError("")
+
+			writer := deprovision("other-service-id", "my-plan-id")
+
+			Expect(writer.Code).To(Equal(http.StatusOK))
+			Expect(deprovisioner.WasCalled).To(BeTrue())
+		})
+	})
+
+	Context("when the deprovisioner requires an asynchronous operation", func() {
+		It("returns a 422 and an AsyncRequired error", func() {
+			writer := httptest.NewRecorder()
+			request, err := http.NewRequest("DELETE", "/v2/service_instances/service-instance-id?service_id=my-service-id&plan_id=my-plan-id", nil)
+			if err != nil {
+				panic(err)
+			}
+
+			deprovisioner.DeprovisionError = domain.AsyncRequiredError("this instance can only be deprovisioned asynchronously")
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusUnprocessableEntity))
+			Expect(writer.Body.String()).To(MatchJSON(`{
+				"error": "AsyncRequired",
+				"description": "this instance can only be deprovisioned asynchronously"
+			}`))
+		})
+	})
+
 	Context("when the request is missing a required parameter", func() {
 		It("should not call the deprovisioner", func() {
 			writer := httptest.NewRecorder()
@@ -155,4 +372,101 @@ var _ = Describe("DeprovisionHandler", func() {
 			Expect(msg.Description).To(ContainSubstring("service_id"))
 		})
 	})
+
+	Context("when the service_id and plan_id are provided in the request body", func() {
+		It("calls the deprovisioner with the values from the body", func() {
+			writer := httptest.NewRecorder()
+
+			request, err := http.NewRequest("DELETE", "/v2/service_instances/service-instance-id",
+				strings.NewReader(`{"service_id":"body-service-id","plan_id":"body-plan-id"}`))
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusOK))
+			Expect(deprovisioner.WasCalledWith).To(Equal(domain.DeprovisionRequest{
+				InstanceID: "service-instance-id",
+				ServiceID:  "body-service-id",
+				PlanID:     "body-plan-id",
+			}))
+		})
+
+		It("warns that the request body is deprecated", func() {
+			writer := httptest.NewRecorder()
+
+			request, err := http.NewRequest("DELETE", "/v2/service_instances/service-instance-id",
+				strings.NewReader(`{"service_id":"body-service-id","plan_id":"body-plan-id"}`))
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusOK))
+			Expect(writer.Header().Get("Warning")).To(Equal(
+				`299 - "sending service_id and plan_id in the request body is deprecated; use query parameters instead"`))
+		})
+
+		It("prefers the values from the query string", func() {
+			writer := httptest.NewRecorder()
+
+			request, err := http.NewRequest("DELETE", "/v2/service_instances/service-instance-id?service_id=query-service-id",
+				strings.NewReader(`{"service_id":"body-service-id","plan_id":"body-plan-id"}`))
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusOK))
+			Expect(deprovisioner.WasCalledWith).To(Equal(domain.DeprovisionRequest{
+				InstanceID: "service-instance-id",
+				ServiceID:  "query-service-id",
+				PlanID:     "body-plan-id",
+			}))
+		})
+	})
+
+	Context("when the service_id and plan_id are missing from both the query and the body", func() {
+		It("should return a 400 error without calling the deprovisioner", func() {
+			writer := httptest.NewRecorder()
+
+			request, err := http.NewRequest("DELETE", "/v2/service_instances/service-instance-id",
+				strings.NewReader(`{"something_else":"value"}`))
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusBadRequest))
+			Expect(deprovisioner.WasCalled).To(BeFalse())
+		})
+	})
+
+	Context("when the request body is not read before the timeout", func() {
+		It("returns a 408 and stops reading the body", func() {
+			handler.BodyReadTimeout = 10 * time.Millisecond
+
+			bodyReader, bodyWriter := io.Pipe()
+			defer bodyWriter.Close()
+
+			request, err := http.NewRequest("DELETE", "/v2/service_instances/service-instance-id", bodyReader)
+			if err != nil {
+				panic(err)
+			}
+
+			writer := httptest.NewRecorder()
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusRequestTimeout))
+			Expect(writer.Body.String()).To(MatchJSON(`{"description":"timed out reading request body"}`))
+			Expect(deprovisioner.WasCalled).To(BeFalse())
+
+			_, err = bodyWriter.Write([]byte(`{}`))
+			Expect(err).To(Equal(io.ErrClosedPipe))
+		})
+	})
 })
@@ -0,0 +1,37 @@
+package handlers
+
+import "encoding/json"
+
+type marshaler interface {
+	Marshal(v interface{}) ([]byte, error)
+}
+
+type unmarshaler interface {
+	Unmarshal(data []byte, v interface{}) error
+}
+
+type standardMarshaler struct{}
+
+func (standardMarshaler) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+var (
+	jsonMarshaler   marshaler = standardMarshaler{}
+	jsonUnmarshaler unmarshaler
+)
+
+// SetMarshaler replaces the marshaler used to write response bodies. A nil
+// marshaler restores encoding/json.
+func SetMarshaler(m marshaler) {
+	if m == nil {
+		m = standardMarshaler{}
+	}
+	jsonMarshaler = m
+}
+
+// SetUnmarshaler replaces the unmarshaler used to read request bodies. A
+// nil unmarshaler restores the streaming encoding/json decoder.
+func SetUnmarshaler(u unmarshaler) {
+	jsonUnmarshaler = u
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/pivotal-cf-experimental/envoy/domain"
+)
+
+type lastOperationer interface {
+	LastOperation(domain.LastOperationRequest) (domain.LastOperationResponse, error)
+}
+
+type operationGetter interface {
+	Get(instanceID string) (domain.OperationRecord, error)
+}
+
+type LastOperationHandler struct {
+	lastOperationer
+	Logger     Logger
+	Operations operationGetter
+	Verifier   operationVerifier
+
+	// FailUnknownOperations reports operations unknown to the broker
+	// as failed rather than responding with a 404 Not Found.
+	FailUnknownOperations bool
+}
+
+func NewLastOperationHandler(lastOperationer lastOperationer) LastOperationHandler {
+	return LastOperationHandler{
+		lastOperationer: lastOperationer,
+	}
+}
+
+func (handler LastOperationHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	request := handler.Parse(req)
+
+	if handler.Verifier != nil && request.OperationData != "" {
+		operation, err := handler.Verifier.Verify(request.OperationData)
+		if err != nil {
+			respond(w, http.StatusBadRequest, Failure{Description: err.Error()})
+			return
+		}
+		request.OperationData = operation
+	}
+
+	if err := handler.Validate(request); err != nil {
+		switch err.(type) {
+		case domain.InvalidOperationError:
+			respond(w, http.StatusBadRequest, Failure{Description: err.Error()})
+		default:
+			respondWithInternalError(w, handler.Logger, err)
+		}
+		return
+	}
+
+	response, err := handler.lastOperationer.LastOperation(request)
+	if err != nil {
+		switch err.(type) {
+		case domain.ServiceInstanceNotFoundError, domain.ServiceInstanceGoneError:
+			respond(w, http.StatusGone, EmptyJSON)
+		case domain.OperationNotFoundError:
+			if handler.FailUnknownOperations {
+				respond(w, http.StatusOK, domain.LastOperationResponse{
+					State:       domain.LastOperationFailed,
+					Description: err.Error(),
+				})
+			} else {
+				respond(w, http.StatusNotFound, Failure{Description: err.Error()})
+			}
+		default:
+			respondWithInternalError(w, handler.Logger, err)
+		}
+		return
+	}
+
+	respond(w, http.StatusOK, response)
+}
+
+func (handler LastOperationHandler) Parse(req *http.Request) domain.LastOperationRequest {
+	expression := regexp.MustCompile(`^/v2/service_instances/(.*)/last_operation$`)
+	matches := expression.FindStringSubmatch(req.URL.Path)
+	query := req.URL.Query()
+
+	return domain.LastOperationRequest{
+		InstanceID:    matches[1],
+		ServiceID:     query.Get("service_id"),
+		PlanID:        query.Get("plan_id"),
+		OperationData: query.Get("operation"),
+	}
+}
+
+// Validate checks that the operation being polled is the last operation
+// recorded for the service instance, when an operation store is available
+// to the handler. Instances without a recorded operation are left to the
+// broker.
+func (handler LastOperationHandler) Validate(request domain.LastOperationRequest) error {
+	if handler.Operations == nil || request.OperationData == "" {
+		return nil
+	}
+
+	record, err := handler.Operations.Get(request.InstanceID)
+	if err != nil {
+		if _, ok := err.(domain.OperationNotFoundError); ok {
+			return nil
+		}
+
+		return err
+	}
+
+	if record.ID != request.OperationData {
+		return domain.InvalidOperationError(fmt.Sprintf("operation %q is not the last operation on service instance %q", request.OperationData, request.InstanceID))
+	}
+
+	return nil
+}
@@ -0,0 +1,317 @@
+package handlers_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/pivotal-cf-experimental/envoy/domain"
+	"github.com/pivotal-cf-experimental/envoy/internal/handlers"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type LastOperationer struct {
+	WasCalledWith domain.LastOperationRequest
+	Response      domain.LastOperationResponse
+	Error         error
+}
+
+func NewLastOperationer() *LastOperationer {
+	return &LastOperationer{}
+}
+
+func (o *LastOperationer) LastOperation(req domain.LastOperationRequest) (domain.LastOperationResponse, error) {
+	o.WasCalledWith = req
+	return o.Response, o.Error
+}
+
+var _ = Describe("LastOperationHandler", func() {
+	var lastOperationer *LastOperationer
+	var handler handlers.LastOperationHandler
+
+	BeforeEach(func() {
+		lastOperationer = NewLastOperationer()
+		handler = handlers.NewLastOperationHandler(lastOperationer)
+	})
+
+	It("calls the LastOperation method with the correct values", func() {
+		request, err := http.NewRequest("GET", handlers.LastOperationURL("instance-id", "service-id", "plan-id", "task-1"), nil)
+		if err != nil {
+			panic(err)
+		}
+
+		handler.ServeHTTP(httptest.NewRecorder(), request)
+
+		Expect(lastOperationer.WasCalledWith).To(Equal(domain.LastOperationRequest{
+			InstanceID:    "instance-id",
+			ServiceID:     "service-id",
+			PlanID:        "plan-id",
+			OperationData: "task-1",
+		}))
+	})
+
+	It("returns a 200 with the state of the operation", func() {
+		lastOperationer.Response = domain.LastOperationResponse{
+			State: domain.LastOperationSucceeded,
+		}
+
+		writer := httptest.NewRecorder()
+		request, err := http.NewRequest("GET", "/v2/service_instances/instance-id/last_operation", nil)
+		if err != nil {
+			panic(err)
+		}
+
+		handler.ServeHTTP(writer, request)
+
+		Expect(writer.Code).To(Equal(http.StatusOK))
+		Expect(writer.Header()["Content-Type"]).To(Equal([]string{"application/json"}))
+		Expect(writer.Body.String()).To(MatchJSON(`{"state":"succeeded"}`))
+	})
+
+	It("passes the description through unmodified", func() {
+		lastOperationer.Response = domain.LastOperationResponse{
+			State:       domain.LastOperationInProgress,
+			Description: "provisioning: 40% complete",
+		}
+
+		writer := httptest.NewRecorder()
+		request, err := http.NewRequest("GET", "/v2/service_instances/instance-id/last_operation", nil)
+		if err != nil {
+			panic(err)
+		}
+
+		handler.ServeHTTP(writer, request)
+
+		Expect(writer.Code).To(Equal(http.StatusOK))
+		Expect(writer.Body.String()).To(MatchJSON(`{
+			"state": "in progress",
+			"description": "provisioning: 40% complete"
+		}`))
+	})
+
+	Context("when a delete operation has failed", func() {
+		It("passes the operation through so that a retry can be correlated", func() {
+			deleteOperation := domain.Operation{Type: domain.OperationTypeDelete, ID: "task-1"}.Encode()
+
+			lastOperationer.Response = domain.LastOperationResponse{
+				State:         domain.LastOperationFailed,
+				Description:   "deprovisioning failed",
+				OperationData: deleteOperation,
+			}
+
+			writer := httptest.NewRecorder()
+			request, err := http.NewRequest("GET", handlers.LastOperationURL("instance-id", "", "", deleteOperation), nil)
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusOK))
+			Expect(writer.Body.String()).To(MatchJSON(`{
+				"state": "failed",
+				"description": "deprovisioning failed",
+				"operation": "` + deleteOperation + `"
+			}`))
+		})
+
+		It("reports whether the service instance is still usable", func() {
+			usable := false
+			lastOperationer.Response = domain.LastOperationResponse{
+				State:          domain.LastOperationFailed,
+				Description:    "deprovisioning failed after the data was removed",
+				InstanceUsable: &usable,
+			}
+
+			writer := httptest.NewRecorder()
+			request, err := http.NewRequest("GET", "/v2/service_instances/instance-id/last_operation", nil)
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusOK))
+			Expect(writer.Body.String()).To(MatchJSON(`{
+				"state": "failed",
+				"description": "deprovisioning failed after the data was removed",
+				"instance_usable": false
+			}`))
+		})
+	})
+
+	Context("when the service instance no longer exists", func() {
+		It("returns a 410 Gone with JSON {}", func() {
+			lastOperationer.Error = domain.ServiceInstanceGoneError("instance was deprovisioned")
+
+			writer := httptest.NewRecorder()
+			request, err := http.NewRequest("GET", "/v2/service_instances/instance-id/last_operation", nil)
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusGone))
+			Expect(writer.Body.String()).To(MatchJSON("{}"))
+		})
+	})
+
+	Context("when the operation is not known to the broker", func() {
+		var writer *httptest.ResponseRecorder
+
+		JustBeforeEach(func() {
+			lastOperationer.Error = domain.OperationNotFoundError("operation \"task-1\" is not known")
+
+			writer = httptest.NewRecorder()
+			request, err := http.NewRequest("GET", handlers.LastOperationURL("instance-id", "", "", "task-1"), nil)
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+		})
+
+		It("returns a 404 with the message", func() {
+			Expect(writer.Code).To(Equal(http.StatusNotFound))
+			Expect(writer.Body.String()).To(MatchJSON(`{"description":"operation \"task-1\" is not known"}`))
+		})
+
+		Context("and unknown operations are reported as failed", func() {
+			BeforeEach(func() {
+				handler.FailUnknownOperations = true
+			})
+
+			It("returns a 200 with a failed state", func() {
+				Expect(writer.Code).To(Equal(http.StatusOK))
+				Expect(writer.Body.String()).To(MatchJSON(`{
+					"state": "failed",
+					"description": "operation \"task-1\" is not known"
+				}`))
+			})
+		})
+	})
+
+	Context("when the LastOperation method fails", func() {
+		It("returns a 500 error with the message", func() {
+			lastOperationer.Error = errors.New("BANG!")
+
+			writer := httptest.NewRecorder()
+			request, err := http.NewRequest("GET", "/v2/service_instances/instance-id/last_operation", nil)
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusInternalServerError))
+			Expect(writer.Body.String()).To(MatchJSON(`{"description":"BANG!"}`))
+		})
+	})
+
+	Context("when operations are signed", func() {
+		var signer handlers.OperationSigner
+
+		poll := func(operation string) *httptest.ResponseRecorder {
+			request, err := http.NewRequest("GET", handlers.LastOperationURL("instance-id", "", "", operation), nil)
+			if err != nil {
+				panic(err)
+			}
+
+			writer := httptest.NewRecorder()
+			handler.ServeHTTP(writer, request)
+
+			return writer
+		}
+
+		BeforeEach(func() {
+			signer = handlers.NewOperationSigner([]byte("signing-key"))
+			handler.Verifier = signer
+			lastOperationer.Response = domain.LastOperationResponse{State: domain.LastOperationInProgress}
+		})
+
+		It("passes the original operation of a validly signed operation to the broker", func() {
+			writer := poll(signer.Sign("task-1"))
+
+			Expect(writer.Code).To(Equal(http.StatusOK))
+			Expect(lastOperationer.WasCalledWith.OperationData).To(Equal("task-1"))
+		})
+
+		It("returns a 400 without calling the broker for a tampered operation", func() {
+			signed := signer.Sign("task-1")
+			writer := poll("task-2" + signed[len("task-1"):])
+
+			Expect(writer.Code).To(Equal(http.StatusBadRequest))
+			Expect(writer.Body.String()).To(ContainSubstring("does not have a valid signature"))
+			Expect(lastOperationer.WasCalledWith).To(Equal(domain.LastOperationRequest{}))
+		})
+
+		It("leaves requests without an operation to the broker", func() {
+			writer := poll("")
+
+			Expect(writer.Code).To(Equal(http.StatusOK))
+		})
+	})
+
+	Context("when an operation store is provided", func() {
+		var store *domain.MemoryOperationStore
+
+		poll := func(operation string) *httptest.ResponseRecorder {
+			request, err := http.NewRequest("GET", handlers.LastOperationURL("instance-id", "", "", operation), nil)
+			if err != nil {
+				panic(err)
+			}
+
+			writer := httptest.NewRecorder()
+			handler.ServeHTTP(writer, request)
+
+			return writer
+		}
+
+		BeforeEach(func() {
+			store = domain.NewMemoryOperationStore()
+			handler.Operations = store
+			lastOperationer.Response = domain.LastOperationResponse{State: domain.LastOperationInProgress}
+
+			err := store.Create("instance-id", domain.OperationRecord{
+				ID:    "task-2",
+				State: domain.LastOperationInProgress,
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("calls the LastOperation method for the last operation on the instance", func() {
+			writer := poll("task-2")
+
+			Expect(writer.Code).To(Equal(http.StatusOK))
+			Expect(lastOperationer.WasCalledWith.OperationData).To(Equal("task-2"))
+		})
+
+		It("returns a 400 for any other operation", func() {
+			writer := poll("task-1")
+
+			Expect(writer.Code).To(Equal(http.StatusBadRequest))
+			Expect(writer.Body.String()).To(MatchJSON(`{
+				"description": "operation \"task-1\" is not the last operation on service instance \"instance-id\""
+			}`))
+			Expect(lastOperationer.WasCalledWith).To(Equal(domain.LastOperationRequest{}))
+		})
+
+		It("leaves requests without an operation to the broker", func() {
+			writer := poll("")
+
+			Expect(writer.Code).To(Equal(http.StatusOK))
+		})
+
+		It("leaves instances without a recorded operation to the broker", func() {
+			Expect(store.Delete("instance-id")).To(Succeed())
+
+			writer := poll("task-1")
+
+			Expect(writer.Code).To(Equal(http.StatusOK))
+			Expect(lastOperationer.WasCalledWith.OperationData).To(Equal("task-1"))
+		})
+	})
+})
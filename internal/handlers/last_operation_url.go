@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// LastOperationURL returns the path, with an encoded query string, that a
+// client should poll for the state of an asynchronous operation on the
+// given service instance. Empty values are omitted from the query.
+func LastOperationURL(instanceID, serviceID, planID, operation string) string {
+	path := fmt.Sprintf("/v2/service_instances/%s/last_operation", url.PathEscape(instanceID))
+
+	query := url.Values{}
+	if serviceID != "" {
+		query.Set("service_id", serviceID)
+	}
+	if planID != "" {
+		query.Set("plan_id", planID)
+	}
+	if operation != "" {
+		query.Set("operation", operation)
+	}
+
+	if len(query) == 0 {
+		return path
+	}
+
+	return path + "?" + query.Encode()
+}
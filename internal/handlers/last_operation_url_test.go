@@ -0,0 +1,38 @@
+package handlers_test
+
+import (
+	"net/url"
+
+	"github.com/pivotal-cf-experimental/envoy/internal/handlers"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LastOperationURL", func() {
+	It("builds the last_operation path with the query parameters", func() {
+		Expect(handlers.LastOperationURL("instance-id", "service-id", "plan-id", "operation-id")).To(Equal(
+			"/v2/service_instances/instance-id/last_operation?operation=operation-id&plan_id=plan-id&service_id=service-id"))
+	})
+
+	It("encodes special characters in the operation", func() {
+		lastOperationURL := handlers.LastOperationURL("instance-id", "service-id", "plan-id", "create&id=1 2/3?")
+
+		parsed, err := url.Parse(lastOperationURL)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(parsed.Path).To(Equal("/v2/service_instances/instance-id/last_operation"))
+		Expect(parsed.Query().Get("operation")).To(Equal("create&id=1 2/3?"))
+		Expect(parsed.Query().Get("service_id")).To(Equal("service-id"))
+		Expect(lastOperationURL).To(ContainSubstring("operation=create%26id%3D1+2%2F3%3F"))
+	})
+
+	It("encodes special characters in the instance ID", func() {
+		Expect(handlers.LastOperationURL("some instance/id", "", "", "")).To(Equal(
+			"/v2/service_instances/some%20instance%2Fid/last_operation"))
+	})
+
+	It("omits empty query parameters", func() {
+		Expect(handlers.LastOperationURL("instance-id", "", "", "operation-id")).To(Equal(
+			"/v2/service_instances/instance-id/last_operation?operation=operation-id"))
+	})
+})
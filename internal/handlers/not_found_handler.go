@@ -0,0 +1,18 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// NotFoundHandler responds to requests for routes that the broker does not
+// serve with a coded JSON error, so that clients can branch on the error
+// rather than parsing a plain text body.
+type NotFoundHandler struct{}
+
+func (handler NotFoundHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	respond(w, http.StatusNotFound, Failure{
+		Error:       "NotFound",
+		Description: fmt.Sprintf("no route for %s %s", req.Method, req.URL.Path),
+	})
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/pivotal-cf-experimental/envoy/domain"
+)
+
+type operationSigner interface {
+	Sign(operation string) string
+}
+
+type operationVerifier interface {
+	Verify(signed string) (string, error)
+}
+
+// OperationSigner appends an HMAC-SHA256 signature to the operation data
+// returned to clients, so that an operation a client polls for can be
+// checked to be one that the broker returned.
+type OperationSigner struct {
+	key []byte
+}
+
+func NewOperationSigner(key []byte) OperationSigner {
+	return OperationSigner{key: key}
+}
+
+// Sign returns the operation followed by a dot and its signature.
+func (s OperationSigner) Sign(operation string) string {
+	return operation + "." + s.signature(operation)
+}
+
+// Verify returns the operation that was signed, or an
+// InvalidOperationError if the signature is missing or does not match.
+func (s OperationSigner) Verify(signed string) (string, error) {
+	i := strings.LastIndex(signed, ".")
+	if i < 0 || !hmac.Equal([]byte(signed[i+1:]), []byte(s.signature(signed[:i]))) {
+		return "", domain.InvalidOperationError(fmt.Sprintf("operation %q does not have a valid signature", signed))
+	}
+
+	return signed[:i], nil
+}
+
+func (s OperationSigner) signature(operation string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(operation))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// signOperation signs the operation when there is a signer and an
+// operation to sign.
+func signOperation(signer operationSigner, operation string) string {
+	if signer == nil || operation == "" {
+		return operation
+	}
+
+	return signer.Sign(operation)
+}
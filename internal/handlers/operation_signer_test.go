@@ -0,0 +1,42 @@
+package handlers_test
+
+import (
+	"github.com/pivotal-cf-experimental/envoy/domain"
+	"github.com/pivotal-cf-experimental/envoy/internal/handlers"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("OperationSigner", func() {
+	var signer handlers.OperationSigner
+
+	BeforeEach(func() {
+		signer = handlers.NewOperationSigner([]byte("signing-key"))
+	})
+
+	It("verifies a signed operation and returns the original operation", func() {
+		operation, err := signer.Verify(signer.Sign("task.1"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(operation).To(Equal("task.1"))
+	})
+
+	It("rejects a tampered operation", func() {
+		signed := signer.Sign("task-1")
+
+		_, err := signer.Verify("task-2" + signed[len("task-1"):])
+		Expect(err).To(BeAssignableToTypeOf(domain.InvalidOperationError("")))
+	})
+
+	It("rejects an unsigned operation", func() {
+		_, err := signer.Verify("task-1")
+		Expect(err).To(MatchError(`operation "task-1" does not have a valid signature`))
+	})
+
+	It("rejects an operation signed with another key", func() {
+		other := handlers.NewOperationSigner([]byte("other-key"))
+
+		_, err := signer.Verify(other.Sign("task-1"))
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -1,11 +1,11 @@
 package handlers
 
 import (
-	"encoding/json"
 	"errors"
-	"io/ioutil"
+	"fmt"
 	"net/http"
 	"regexp"
+	"time"
 
 	"github.com/pivotal-cf-experimental/envoy/domain"
 )
@@ -14,8 +14,22 @@ type provisioner interface {
 	Provision(domain.ProvisionRequest) (domain.ProvisionResponse, error)
 }
 
+type provisionRequestRecorder interface {
+	Record(domain.ProvisionRequest)
+}
+
 type ProvisionHandler struct {
 	provisioner
+	BodyReadTimeout            time.Duration
+	IncludeSyncOperation       bool
+	Logger                     Logger
+	Cataloger                  cataloger
+	RejectUnknownPlans         bool
+	AllowMissingSpace          bool
+	DefaultPlanID              string
+	WarnUnrecognizedParameters bool
+	Requests                   provisionRequestRecorder
+	Signer                     operationSigner
 }
 
 func NewProvisionHandler(provisioner provisioner) ProvisionHandler {
@@ -25,61 +39,167 @@ func NewProvisionHandler(provisioner provisioner) ProvisionHandler {
 }
 
 func (handler ProvisionHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	request, err := handler.Parse(req)
+	request, err := handler.Parse(withBodyInterrupter(w, req))
 	if err != nil {
-		respond(w, http.StatusBadRequest, Failure{err.Error()})
+		switch err {
+		case errBodyReadTimeout:
+			respond(w, http.StatusRequestTimeout, Failure{Description: err.Error()})
+		case errUnsupportedCharset:
+			respond(w, http.StatusUnsupportedMediaType, Failure{Description: err.Error()})
+		default:
+			respond(w, http.StatusBadRequest, Failure{Description: err.Error()})
+		}
+		return
+	}
+
+	if err := handler.Validate(request); err != nil {
+		switch err.(type) {
+		case domain.MaintenanceInfoConflictError:
+			respond(w, http.StatusUnprocessableEntity, Failure{
+				Error:       "MaintenanceInfoConflict",
+				Description: err.Error(),
+			})
+		case domain.UnknownPlanError:
+			respond(w, http.StatusUnprocessableEntity, Failure{Description: err.Error()})
+		default:
+			respond(w, http.StatusBadRequest, Failure{Description: err.Error()})
+		}
 		return
 	}
+
+	if !request.AcceptsIncomplete && handler.Cataloger != nil && handler.Cataloger.Catalog().IsAsyncOnly(request.ServiceID, request.PlanID) {
+		respond(w, http.StatusUnprocessableEntity, Failure{
+			Error:       "AsyncRequired",
+			Description: fmt.Sprintf("plan %q can only be provisioned asynchronously", request.PlanID),
+		})
+		return
+	}
+
+	syncOnly := handler.Cataloger != nil && handler.Cataloger.Catalog().IsSyncOnly(request.ServiceID, request.PlanID)
+	if syncOnly {
+		request.AcceptsIncomplete = false
+	}
+
+	if handler.WarnUnrecognizedParameters && handler.Cataloger != nil {
+		if plan, ok := handler.Cataloger.Catalog().FindPlan(request.ServiceID, request.PlanID); ok {
+			warnUnrecognizedParameters(w, plan.Schemas.InstanceCreate(), request.Parameters)
+		}
+	}
+
 	response, err := handler.provisioner.Provision(request)
 	if err != nil {
-		switch err.(type) {
+		switch e := err.(type) {
 		case domain.ServiceInstanceAlreadyExistsError:
-			respond(w, http.StatusConflict, EmptyJSON)
-		default:
-			respond(w, http.StatusInternalServerError, Failure{
+			if err.Error() == "" {
+				respond(w, http.StatusConflict, EmptyJSON)
+			} else {
+				respond(w, http.StatusConflict, Failure{Description: err.Error()})
+			}
+		case domain.AsyncRequiredError:
+			respond(w, http.StatusUnprocessableEntity, Failure{
+				Error:       "AsyncRequired",
 				Description: err.Error(),
 			})
+		case domain.ServiceUnavailableError:
+			respondUnavailable(w, e)
+		default:
+			respondWithInternalError(w, handler.Logger, err)
 		}
 		return
 	}
 
-	respond(w, http.StatusCreated, struct {
+	if handler.Requests != nil {
+		handler.Requests.Record(request)
+	}
+
+	body := struct {
 		DashboardURL string `json:"dashboard_url,omitempty"`
+		Operation    string `json:"operation,omitempty"`
 	}{
 		DashboardURL: response.DashboardURL,
-	})
-}
+	}
 
-func (handler ProvisionHandler) Parse(req *http.Request) (domain.ProvisionRequest, error) {
-	body, err := ioutil.ReadAll(req.Body)
-	if err != nil {
-		panic(err)
+	if response.IsAsync && !syncOnly {
+		body.Operation = signOperation(handler.Signer, response.OperationData)
+		w.Header().Set("Location", LastOperationURL(request.InstanceID, request.ServiceID, request.PlanID, body.Operation))
+		respond(w, http.StatusAccepted, body)
+		return
 	}
 
+	if handler.IncludeSyncOperation {
+		body.Operation = signOperation(handler.Signer, response.OperationData)
+	}
+
+	respond(w, http.StatusCreated, body)
+}
+
+func (handler ProvisionHandler) Parse(req *http.Request) (domain.ProvisionRequest, error) {
 	var params struct {
-		ServiceID        string `json:"service_id"`
-		PlanID           string `json:"plan_id"`
-		OrganizationGUID string `json:"organization_guid"`
-		SpaceGUID        string `json:"space_guid"`
+		ServiceID        string                  `json:"service_id"`
+		PlanID           string                  `json:"plan_id"`
+		OrganizationGUID string                  `json:"organization_guid"`
+		SpaceGUID        string                  `json:"space_guid"`
+		MaintenanceInfo  *domain.MaintenanceInfo `json:"maintenance_info"`
+		Context          map[string]interface{}  `json:"context"`
+		Parameters       map[string]interface{}  `json:"parameters"`
 	}
-	err = json.Unmarshal(body, &params)
-	if err != nil {
-		return domain.ProvisionRequest{}, errors.New("request body must be a JSON object")
+	if err := decodeBody(req, handler.BodyReadTimeout, &params); err != nil {
+		return domain.ProvisionRequest{}, err
 	}
 
 	expression := regexp.MustCompile(`^/v2/service_instances/(.*)$`)
 	instanceID := expression.FindStringSubmatch(req.URL.Path)[1]
 
-	if len(instanceID) == 0 || len(params.ServiceID) == 0 || len(params.PlanID) == 0 ||
-		len(params.OrganizationGUID) == 0 || len(params.SpaceGUID) == 0 {
+	if len(params.PlanID) == 0 {
+		params.PlanID = handler.DefaultPlanID
+	}
+
+	if len(instanceID) == 0 || len(params.ServiceID) == 0 || len(params.PlanID) == 0 {
 		return domain.ProvisionRequest{}, errors.New("missing required field")
 	}
 
+	if !handler.AllowMissingSpace && (len(params.OrganizationGUID) == 0 || len(params.SpaceGUID) == 0) {
+		return domain.ProvisionRequest{}, errors.New("missing required field: 'organization_guid' and 'space_guid' are required")
+	}
+
 	return domain.ProvisionRequest{
-		InstanceID:       instanceID,
-		ServiceID:        params.ServiceID,
-		PlanID:           params.PlanID,
-		OrganizationGUID: params.OrganizationGUID,
-		SpaceGUID:        params.SpaceGUID,
+		InstanceID:        instanceID,
+		ServiceID:         params.ServiceID,
+		PlanID:            params.PlanID,
+		OrganizationGUID:  params.OrganizationGUID,
+		SpaceGUID:         params.SpaceGUID,
+		AcceptsIncomplete: req.URL.Query().Get("accepts_incomplete") == "true",
+		MaintenanceInfo:   params.MaintenanceInfo,
+		Context:           params.Context,
+		Parameters:        params.Parameters,
 	}, nil
 }
+
+// Validate checks the provision request against the catalog, when one is
+// available to the handler.
+func (handler ProvisionHandler) Validate(request domain.ProvisionRequest) error {
+	if handler.Cataloger == nil {
+		return nil
+	}
+
+	plan, ok := handler.Cataloger.Catalog().FindPlan(request.ServiceID, request.PlanID)
+	if !ok {
+		if handler.RejectUnknownPlans {
+			return domain.UnknownPlanError(fmt.Sprintf("plan %q of service %q is not in the catalog", request.PlanID, request.ServiceID))
+		}
+
+		return nil
+	}
+
+	if request.MaintenanceInfo != nil {
+		if plan.MaintenanceInfo == nil {
+			return domain.MaintenanceInfoConflictError("passed maintenance_info does not match the catalog maintenance_info: the plan has no maintenance_info")
+		}
+
+		if plan.MaintenanceInfo.Version != request.MaintenanceInfo.Version {
+			return domain.MaintenanceInfoConflictError(fmt.Sprintf("passed maintenance_info does not match the catalog maintenance_info: expected version %q", plan.MaintenanceInfo.Version))
+		}
+	}
+
+	return nil
+}
@@ -1,12 +1,20 @@
 package handlers_test
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"runtime"
 	"strings"
+	"testing/iotest"
+	"time"
 
 	"github.com/pivotal-cf-experimental/envoy/domain"
 	"github.com/pivotal-cf-experimental/envoy/internal/handlers"
@@ -20,6 +28,8 @@ type Provisioner struct {
 	WasCalled     bool
 	Error         error
 	DashboardURL  string
+	IsAsync       bool
+	OperationData string
 }
 
 func NewProvisioner() *Provisioner {
@@ -30,10 +40,20 @@ func (p *Provisioner) Provision(req domain.ProvisionRequest) (domain.ProvisionRe
 	p.WasCalledWith = req
 	p.WasCalled = true
 	return domain.ProvisionResponse{
-		DashboardURL: p.DashboardURL,
+		DashboardURL:  p.DashboardURL,
+		IsAsync:       p.IsAsync,
+		OperationData: p.OperationData,
 	}, p.Error
 }
 
+type StaticCataloger struct {
+	catalog domain.Catalog
+}
+
+func (c StaticCataloger) Catalog() domain.Catalog {
+	return c.catalog
+}
+
 var _ = Describe("Provision Handler", func() {
 	var handler handlers.ProvisionHandler
 	var provisioner *Provisioner
@@ -148,6 +168,33 @@ var _ = Describe("Provision Handler", func() {
 
 			Expect(writer.Body.String()).To(MatchJSON(`{"description":"BOOM!"}`))
 		})
+
+		It("generates a new reference for each failed request", func() {
+			logger := NewLogger()
+			handler.Logger = logger
+
+			for i := 0; i < 2; i++ {
+				reqBody, err := json.Marshal(map[string]string{
+					"service_id":        "my-service-id",
+					"plan_id":           "my-plan-id",
+					"organization_guid": "my-organization-guid",
+					"space_guid":        "my-space-guid",
+				})
+				if err != nil {
+					panic(err)
+				}
+
+				request, err := http.NewRequest("PUT", "/v2/service_instances/some-other-guid", bytes.NewBuffer(reqBody))
+				if err != nil {
+					panic(err)
+				}
+
+				handler.ServeHTTP(httptest.NewRecorder(), request)
+			}
+
+			Expect(logger.Errors).To(HaveLen(2))
+			Expect(logger.Errors[0].Data["ref"]).NotTo(Equal(logger.Errors[1].Data["ref"]))
+		})
 	})
 
 	Context("when the service instance has already been provisioned", func() {
@@ -177,77 +224,1082 @@ var _ = Describe("Provision Handler", func() {
 			Expect(writer.Code).To(Equal(http.StatusConflict))
 			Expect(writer.Header()["Content-Type"]).To(Equal([]string{"application/json"}))
 
-			Expect(writer.Body.String()).To(MatchJSON(`{}`))
+			Expect(writer.Body.String()).To(MatchJSON(`{"description":"already exists"}`))
+		})
+
+		Context("when the error has no message", func() {
+			BeforeEach(func() {
+				provisioner.Error = domain.ServiceInstanceAlreadyExistsError("")
+			})
+
+			It("returns a 409 with an empty JSON body", func() {
+				writer := httptest.NewRecorder()
+				reqBody, err := json.Marshal(map[string]string{
+					"service_id":        "my-service-id",
+					"plan_id":           "my-plan-id",
+					"organization_guid": "my-organization-guid",
+					"space_guid":        "my-space-guid",
+				})
+				if err != nil {
+					panic(err)
+				}
+
+				request, err := http.NewRequest("PUT", "/v2/service_instances/a-duplicate-guid", bytes.NewBuffer(reqBody))
+				if err != nil {
+					panic(err)
+				}
+
+				handler.ServeHTTP(writer, request)
+
+				Expect(writer.Code).To(Equal(http.StatusConflict))
+				Expect(writer.Body.String()).To(MatchJSON(`{}`))
+			})
 		})
 	})
 
-	Context("when the request body is not valid JSON", func() {
-		It("should not call the provisioner", func() {
+	Context("when the request accepts incomplete responses", func() {
+		It("passes that along to the provisioner", func() {
 			writer := httptest.NewRecorder()
+			reqBody, err := json.Marshal(map[string]string{
+				"service_id":        "my-service-id",
+				"plan_id":           "my-plan-id",
+				"organization_guid": "my-organization-guid",
+				"space_guid":        "my-space-guid",
+			})
+			if err != nil {
+				panic(err)
+			}
 
-			request, err := http.NewRequest("PUT", "/v2/service_instances/a-guid", strings.NewReader("{"))
+			request, err := http.NewRequest("PUT", "/v2/service_instances/some-guid?accepts_incomplete=true", bytes.NewBuffer(reqBody))
 			if err != nil {
 				panic(err)
 			}
 
 			handler.ServeHTTP(writer, request)
 
-			Expect(provisioner.WasCalled).To(BeFalse())
+			Expect(provisioner.WasCalledWith.AcceptsIncomplete).To(BeTrue())
 		})
+	})
 
-		It("should return a 400 and an error message", func() {
+	Context("when the provision is asynchronous", func() {
+		BeforeEach(func() {
+			provisioner.IsAsync = true
+			provisioner.OperationData = "some-operation"
+			provisioner.DashboardURL = "http://www.example.com/my-silly-dashboard-url"
+		})
+
+		It("returns a 202 with the operation and dashboard URL", func() {
 			writer := httptest.NewRecorder()
+			reqBody, err := json.Marshal(map[string]string{
+				"service_id":        "my-service-id",
+				"plan_id":           "my-plan-id",
+				"organization_guid": "my-organization-guid",
+				"space_guid":        "my-space-guid",
+			})
+			if err != nil {
+				panic(err)
+			}
 
-			request, err := http.NewRequest("PUT", "/v2/service_instances/a-guid", strings.NewReader("{"))
+			request, err := http.NewRequest("PUT", "/v2/service_instances/some-guid?accepts_incomplete=true", bytes.NewBuffer(reqBody))
 			if err != nil {
 				panic(err)
 			}
 
 			handler.ServeHTTP(writer, request)
 
-			Expect(writer.Code).To(Equal(http.StatusBadRequest))
+			Expect(writer.Code).To(Equal(http.StatusAccepted))
 			Expect(writer.Header()["Content-Type"]).To(Equal([]string{"application/json"}))
+			Expect(writer.Body.String()).To(MatchJSON(`{
+				"dashboard_url": "http://www.example.com/my-silly-dashboard-url",
+				"operation": "some-operation"
+			}`))
+		})
 
-			var msg struct {
-				Description string `json:"description"`
+		It("includes the last_operation URL in the Location header", func() {
+			writer := httptest.NewRecorder()
+			reqBody, err := json.Marshal(map[string]string{
+				"service_id":        "my-service-id",
+				"plan_id":           "my-plan-id",
+				"organization_guid": "my-organization-guid",
+				"space_guid":        "my-space-guid",
+			})
+			if err != nil {
+				panic(err)
 			}
-			Expect(json.Unmarshal(writer.Body.Bytes(), &msg)).To(Succeed())
-			Expect(msg.Description).To(ContainSubstring("JSON"))
+
+			request, err := http.NewRequest("PUT", "/v2/service_instances/some-guid?accepts_incomplete=true", bytes.NewBuffer(reqBody))
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Header().Get("Location")).To(Equal(
+				"/v2/service_instances/some-guid/last_operation?operation=some-operation&plan_id=my-plan-id&service_id=my-service-id"))
+		})
+
+		It("signs the operation when a signer is provided", func() {
+			signer := handlers.NewOperationSigner([]byte("signing-key"))
+			handler.Signer = signer
+
+			writer := httptest.NewRecorder()
+			reqBody, err := json.Marshal(map[string]string{
+				"service_id":        "my-service-id",
+				"plan_id":           "my-plan-id",
+				"organization_guid": "my-organization-guid",
+				"space_guid":        "my-space-guid",
+			})
+			if err != nil {
+				panic(err)
+			}
+
+			request, err := http.NewRequest("PUT", "/v2/service_instances/some-guid?accepts_incomplete=true", bytes.NewBuffer(reqBody))
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+
+			var body struct {
+				Operation string `json:"operation"`
+			}
+			Expect(json.Unmarshal(writer.Body.Bytes(), &body)).To(Succeed())
+			Expect(body.Operation).To(Equal(signer.Sign("some-operation")))
+			Expect(writer.Header().Get("Location")).To(ContainSubstring(url.QueryEscape(body.Operation)))
 		})
 	})
 
-	Context("when the request body is missing a required field", func() {
-		It("should not call the provisioner", func() {
+	Context("when the provision is synchronous but has operation data", func() {
+		var request *http.Request
+
+		BeforeEach(func() {
+			provisioner.OperationData = "some-operation"
+
+			reqBody, err := json.Marshal(map[string]string{
+				"service_id":        "my-service-id",
+				"plan_id":           "my-plan-id",
+				"organization_guid": "my-organization-guid",
+				"space_guid":        "my-space-guid",
+			})
+			if err != nil {
+				panic(err)
+			}
+
+			request, err = http.NewRequest("PUT", "/v2/service_instances/some-guid", bytes.NewBuffer(reqBody))
+			if err != nil {
+				panic(err)
+			}
+		})
+
+		It("omits the operation from the 201 response", func() {
 			writer := httptest.NewRecorder()
 
-			request, err := http.NewRequest("PUT", "/v2/service_instances/a-guid", strings.NewReader("{}"))
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusCreated))
+			Expect(writer.Body.String()).To(MatchJSON("{}"))
+		})
+
+		Context("when the handler is configured to include the operation", func() {
+			BeforeEach(func() {
+				handler.IncludeSyncOperation = true
+			})
+
+			It("includes the operation in the 201 response", func() {
+				writer := httptest.NewRecorder()
+
+				handler.ServeHTTP(writer, request)
+
+				Expect(writer.Code).To(Equal(http.StatusCreated))
+				Expect(writer.Body.String()).To(MatchJSON(`{"operation":"some-operation"}`))
+			})
+		})
+	})
+
+	Context("when the backend is unavailable", func() {
+		BeforeEach(func() {
+			provisioner.Error = domain.ServiceUnavailableError{
+				Message:    "the backend is down for maintenance",
+				RetryAfter: 30 * time.Second,
+			}
+		})
+
+		It("returns a 503 with a Retry-After header", func() {
+			writer := httptest.NewRecorder()
+			reqBody, err := json.Marshal(map[string]string{
+				"service_id":        "my-service-id",
+				"plan_id":           "my-plan-id",
+				"organization_guid": "my-organization-guid",
+				"space_guid":        "my-space-guid",
+			})
+			if err != nil {
+				panic(err)
+			}
+
+			request, err := http.NewRequest("PUT", "/v2/service_instances/some-guid", bytes.NewBuffer(reqBody))
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(writer.Header().Get("Retry-After")).To(Equal("30"))
+			Expect(writer.Body.String()).To(MatchJSON(`{"description": "the backend is down for maintenance"}`))
+		})
+	})
+
+	Context("when the plan is declared synchronous-only", func() {
+		provision := func(path string) *httptest.ResponseRecorder {
+			reqBody, err := json.Marshal(map[string]string{
+				"service_id":        "my-service-id",
+				"plan_id":           "my-plan-id",
+				"organization_guid": "my-organization-guid",
+				"space_guid":        "my-space-guid",
+			})
+			if err != nil {
+				panic(err)
+			}
+
+			request, err := http.NewRequest("PUT", path, bytes.NewBuffer(reqBody))
+			if err != nil {
+				panic(err)
+			}
+
+			writer := httptest.NewRecorder()
+			handler.ServeHTTP(writer, request)
+
+			return writer
+		}
+
+		BeforeEach(func() {
+			handler.Cataloger = StaticCataloger{domain.Catalog{
+				Services: []domain.Service{
+					{
+						ID:    "my-service-id",
+						Plans: []domain.Plan{{ID: "my-plan-id", SyncOnly: true}},
+					},
+				},
+			}}
+		})
+
+		It("does not tell the provisioner that the client accepts incomplete operations", func() {
+			writer := provision("/v2/service_instances/some-guid?accepts_incomplete=true")
+
+			Expect(writer.Code).To(Equal(http.StatusCreated))
+			Expect(provisioner.WasCalledWith.AcceptsIncomplete).To(BeFalse())
+		})
+
+		It("returns a 201 even if the provisioner responds asynchronously", func() {
+			provisioner.IsAsync = true
+			provisioner.OperationData = "some-operation"
+
+			writer := provision("/v2/service_instances/some-guid?accepts_incomplete=true")
+
+			Expect(writer.Code).To(Equal(http.StatusCreated))
+			Expect(writer.Header()).NotTo(HaveKey("Location"))
+			Expect(writer.Body.String()).To(MatchJSON("{}"))
+		})
+
+		It("still provisions other plans asynchronously", func() {
+			handler.Cataloger = StaticCataloger{domain.Catalog{
+				Services: []domain.Service{
+					{
+						ID:    "my-service-id",
+						Plans: []domain.Plan{{ID: "my-plan-id"}},
+					},
+				},
+			}}
+			provisioner.IsAsync = true
+
+			writer := provision("/v2/service_instances/some-guid?accepts_incomplete=true")
+
+			Expect(writer.Code).To(Equal(http.StatusAccepted))
+			Expect(provisioner.WasCalledWith.AcceptsIncomplete).To(BeTrue())
+		})
+	})
+
+	Context("when the plan is declared asynchronous-only", func() {
+		provision := func(path string) *httptest.ResponseRecorder {
+			reqBody, err := json.Marshal(map[string]string{
+				"service_id":        "my-service-id",
+				"plan_id":           "my-plan-id",
+				"organization_guid": "my-organization-guid",
+				"space_guid":        "my-space-guid",
+			})
+			if err != nil {
+				panic(err)
+			}
+
+			request, err := http.NewRequest("PUT", path, bytes.NewBuffer(reqBody))
 			if err != nil {
 				panic(err)
 			}
 
+			writer := httptest.NewRecorder()
 			handler.ServeHTTP(writer, request)
 
+			return writer
+		}
+
+		BeforeEach(func() {
+			handler.Cataloger = StaticCataloger{domain.Catalog{
+				Services: []domain.Service{
+					{
+						ID:    "my-service-id",
+						Plans: []domain.Plan{{ID: "my-plan-id", AsyncOnly: true}},
+					},
+				},
+			}}
+			provisioner.IsAsync = true
+			provisioner.OperationData = "some-operation"
+		})
+
+		It("returns a 422 AsyncRequired without calling the provisioner when the client does not accept incomplete operations", func() {
+			writer := provision("/v2/service_instances/some-guid")
+
+			Expect(writer.Code).To(Equal(http.StatusUnprocessableEntity))
+			Expect(writer.Body.String()).To(MatchJSON(`{
+				"error": "AsyncRequired",
+				"description": "plan \"my-plan-id\" can only be provisioned asynchronously"
+			}`))
 			Expect(provisioner.WasCalled).To(BeFalse())
 		})
 
-		It("should return a 400 and an error message", func() {
+		It("provisions asynchronously when the client accepts incomplete operations", func() {
+			writer := provision("/v2/service_instances/some-guid?accepts_incomplete=true")
+
+			Expect(writer.Code).To(Equal(http.StatusAccepted))
+			Expect(writer.Body.String()).To(MatchJSON(`{"operation": "some-operation"}`))
+			Expect(provisioner.WasCalledWith.AcceptsIncomplete).To(BeTrue())
+		})
+	})
+
+	Context("when the provisioner requires an asynchronous provision", func() {
+		BeforeEach(func() {
+			provisioner.Error = domain.AsyncRequiredError("this plan can only be provisioned asynchronously")
+		})
+
+		It("returns a 422 and an AsyncRequired error", func() {
 			writer := httptest.NewRecorder()
+			reqBody, err := json.Marshal(map[string]string{
+				"service_id":        "my-service-id",
+				"plan_id":           "my-plan-id",
+				"organization_guid": "my-organization-guid",
+				"space_guid":        "my-space-guid",
+			})
+			if err != nil {
+				panic(err)
+			}
 
-			request, err := http.NewRequest("PUT", "/v2/service_instances/a-guid", strings.NewReader("{}"))
+			request, err := http.NewRequest("PUT", "/v2/service_instances/some-guid", bytes.NewBuffer(reqBody))
 			if err != nil {
 				panic(err)
 			}
 
 			handler.ServeHTTP(writer, request)
 
-			Expect(writer.Code).To(Equal(http.StatusBadRequest))
+			Expect(writer.Code).To(Equal(http.StatusUnprocessableEntity))
 			Expect(writer.Header()["Content-Type"]).To(Equal([]string{"application/json"}))
+			Expect(writer.Body.String()).To(MatchJSON(`{
+				"error": "AsyncRequired",
+				"description": "this plan can only be provisioned asynchronously"
+			}`))
+		})
+	})
 
-			var msg struct {
-				Description string `json:"description"`
+	Context("when the request body includes a context", func() {
+		It("passes the context to the provisioner", func() {
+			reqBody, err := json.Marshal(map[string]interface{}{
+				"service_id":        "my-service-id",
+				"plan_id":           "my-plan-id",
+				"organization_guid": "my-organization-guid",
+				"space_guid":        "my-space-guid",
+				"context": map[string]interface{}{
+					"platform":          "cloudfoundry",
+					"organization_name": "my-organization",
+				},
+			})
+			if err != nil {
+				panic(err)
 			}
-			Expect(json.Unmarshal(writer.Body.Bytes(), &msg)).To(Succeed())
-			Expect(msg.Description).To(ContainSubstring("missing required field"))
+
+			request, err := http.NewRequest("PUT", "/v2/service_instances/some-guid", bytes.NewBuffer(reqBody))
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(httptest.NewRecorder(), request)
+
+			Expect(provisioner.WasCalledWith.Context).To(Equal(map[string]interface{}{
+				"platform":          "cloudfoundry",
+				"organization_name": "my-organization",
+			}))
+		})
+	})
+
+	Context("when the request body includes a large parameters object", func() {
+		It("passes the parameters to the provisioner", func() {
+			parameters := map[string]interface{}{}
+			for i := 0; i < 10000; i++ {
+				parameters[fmt.Sprintf("key-%d", i)] = strings.Repeat("v", 100)
+			}
+
+			reqBody, err := json.Marshal(map[string]interface{}{
+				"service_id":        "my-service-id",
+				"plan_id":           "my-plan-id",
+				"organization_guid": "my-organization-guid",
+				"space_guid":        "my-space-guid",
+				"parameters":        parameters,
+			})
+			if err != nil {
+				panic(err)
+			}
+
+			request, err := http.NewRequest("PUT", "/v2/service_instances/some-guid", bytes.NewBuffer(reqBody))
+			if err != nil {
+				panic(err)
+			}
+
+			writer := httptest.NewRecorder()
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusCreated))
+			Expect(provisioner.WasCalledWith.Parameters).To(Equal(parameters))
+		})
+	})
+
+	Context("when the request body is shorter than its Content-Length", func() {
+		body := `{"service_id":"my-service-id","plan_id":"my-plan-id","organization_guid":"org","space_guid":"space"}`
+
+		It("returns a 400 without calling the provisioner, even if the JSON object is complete", func() {
+			writer := httptest.NewRecorder()
+
+			request, err := http.NewRequest("PUT", "/v2/service_instances/a-guid", strings.NewReader(body))
+			if err != nil {
+				panic(err)
+			}
+			request.ContentLength = int64(len(body) + 20)
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusBadRequest))
+			Expect(writer.Body.String()).To(MatchJSON(`{"description":"request body is shorter than its Content-Length"}`))
+			Expect(provisioner.WasCalled).To(BeFalse())
+		})
+
+		It("returns a 400 when the body is cut off in the middle of the JSON object", func() {
+			writer := httptest.NewRecorder()
+
+			request, err := http.NewRequest("PUT", "/v2/service_instances/a-guid", strings.NewReader(body[:20]))
+			if err != nil {
+				panic(err)
+			}
+			request.ContentLength = int64(len(body))
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusBadRequest))
+			Expect(writer.Body.String()).To(MatchJSON(`{"description":"request body is shorter than its Content-Length"}`))
+		})
+
+		It("accepts a body that matches its Content-Length", func() {
+			writer := httptest.NewRecorder()
+
+			request, err := http.NewRequest("PUT", "/v2/service_instances/a-guid", strings.NewReader(body+"\n"))
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusCreated))
+		})
+	})
+
+	Context("when the request body is a JSON array", func() {
+		It("returns a 400 without calling the provisioner", func() {
+			writer := httptest.NewRecorder()
+
+			request, err := http.NewRequest("PUT", "/v2/service_instances/a-guid", strings.NewReader("\n\t[{\"service_id\":\"my-service-id\"}]"))
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusBadRequest))
+			Expect(writer.Body.String()).To(MatchJSON(`{"description":"request body must be a JSON object, not an array"}`))
+			Expect(provisioner.WasCalled).To(BeFalse())
+		})
+	})
+
+	Context("when the request body is a JSON object", func() {
+		It("provisions the instance", func() {
+			writer := httptest.NewRecorder()
+
+			request, err := http.NewRequest("PUT", "/v2/service_instances/a-guid", strings.NewReader(`  {
+				"service_id": "my-service-id",
+				"plan_id": "my-plan-id",
+				"organization_guid": "my-organization-guid",
+				"space_guid": "my-space-guid"
+			}`))
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusCreated))
+			Expect(provisioner.WasCalled).To(BeTrue())
+		})
+	})
+
+	Context("when the request body is not valid UTF-8", func() {
+		It("returns a 400 with the offset of the invalid byte", func() {
+			writer := httptest.NewRecorder()
+
+			request, err := http.NewRequest("PUT", "/v2/service_instances/a-guid", strings.NewReader("{\"service_id\":\xff\"my-service-id\"}"))
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusBadRequest))
+			Expect(writer.Body.String()).To(MatchJSON(`{"description":"request body must be valid UTF-8: invalid byte 0xff at offset 14"}`))
+			Expect(provisioner.WasCalled).To(BeFalse())
+		})
+
+		It("accepts multi-byte characters split across reads", func() {
+			writer := httptest.NewRecorder()
+
+			body := `{
+				"service_id": "my-service-id",
+				"plan_id": "my-plan-id",
+				"organization_guid": "my-organization-guid",
+				"space_guid": "my-space-guid",
+				"parameters": {"name": "café ☃"}
+			}`
+			request, err := http.NewRequest("PUT", "/v2/service_instances/a-guid", iotest.OneByteReader(strings.NewReader(body)))
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusCreated))
+			Expect(provisioner.WasCalledWith.Parameters).To(Equal(map[string]interface{}{"name": "café ☃"}))
+		})
+	})
+
+	Context("when the Content-Type declares a charset", func() {
+		provision := func(contentType string) *httptest.ResponseRecorder {
+			writer := httptest.NewRecorder()
+
+			request, err := http.NewRequest("PUT", "/v2/service_instances/a-guid", strings.NewReader(`{
+				"service_id": "my-service-id",
+				"plan_id": "my-plan-id",
+				"organization_guid": "my-organization-guid",
+				"space_guid": "my-space-guid"
+			}`))
+			if err != nil {
+				panic(err)
+			}
+			request.Header.Set("Content-Type", contentType)
+
+			handler.ServeHTTP(writer, request)
+
+			return writer
+		}
+
+		It("accepts a utf-8 charset", func() {
+			writer := provision("application/json; charset=UTF-8")
+
+			Expect(writer.Code).To(Equal(http.StatusCreated))
+			Expect(provisioner.WasCalled).To(BeTrue())
+		})
+
+		It("accepts a Content-Type without a charset", func() {
+			writer := provision("application/json")
+
+			Expect(writer.Code).To(Equal(http.StatusCreated))
+			Expect(provisioner.WasCalled).To(BeTrue())
+		})
+
+		It("returns a 415 for any other charset without calling the provisioner", func() {
+			writer := provision("application/json; charset=utf-16")
+
+			Expect(writer.Code).To(Equal(http.StatusUnsupportedMediaType))
+			Expect(writer.Body.String()).To(MatchJSON(`{"description":"request body must be JSON encoded as UTF-8; the charset in the Content-Type is not supported"}`))
+			Expect(provisioner.WasCalled).To(BeFalse())
+		})
+	})
+
+	Context("when the request body has data after the JSON object", func() {
+		It("returns a 400 and an informative error message", func() {
+			writer := httptest.NewRecorder()
+
+			request, err := http.NewRequest("PUT", "/v2/service_instances/a-guid", strings.NewReader(`{"service_id":"my-service-id"} {}`))
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusBadRequest))
+			Expect(writer.Body.String()).To(MatchJSON(`{"description":"request body must be a JSON object: unexpected data after the object"}`))
+			Expect(provisioner.WasCalled).To(BeFalse())
+		})
+	})
+
+	Context("when unrecognized parameters are warned about", func() {
+		provisionWith := func(parameters map[string]interface{}) *httptest.ResponseRecorder {
+			reqBody, err := json.Marshal(map[string]interface{}{
+				"service_id":        "my-service-id",
+				"plan_id":           "my-plan-id",
+				"organization_guid": "my-organization-guid",
+				"space_guid":        "my-space-guid",
+				"parameters":        parameters,
+			})
+			if err != nil {
+				panic(err)
+			}
+
+			request, err := http.NewRequest("PUT", "/v2/service_instances/some-guid", bytes.NewBuffer(reqBody))
+			if err != nil {
+				panic(err)
+			}
+
+			writer := httptest.NewRecorder()
+			handler.ServeHTTP(writer, request)
+
+			return writer
+		}
+
+		BeforeEach(func() {
+			handler.WarnUnrecognizedParameters = true
+			handler.Cataloger = StaticCataloger{domain.Catalog{
+				Services: []domain.Service{
+					{
+						ID: "my-service-id",
+						Plans: []domain.Plan{
+							{
+								ID: "my-plan-id",
+								Schemas: &domain.Schemas{
+									ServiceInstance: &domain.ServiceInstanceSchema{
+										Create: &domain.InputParametersSchema{
+											Parameters: map[string]interface{}{
+												"type": "object",
+												"properties": map[string]interface{}{
+													"size": map[string]interface{}{"type": "string"},
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			}}
+		})
+
+		It("provisions with a Warning header listing the unrecognized parameter keys", func() {
+			writer := provisionWith(map[string]interface{}{"size": "large", "zize": "large", "colour": "blue"})
+
+			Expect(writer.Code).To(Equal(http.StatusCreated))
+			Expect(writer.Header()["Warning"]).To(Equal([]string{`299 - "unrecognized parameters: colour, zize"`}))
+			Expect(provisioner.WasCalledWith.Parameters).To(HaveKey("zize"))
+		})
+
+		It("does not warn when every parameter is recognized", func() {
+			writer := provisionWith(map[string]interface{}{"size": "large"})
+
+			Expect(writer.Code).To(Equal(http.StatusCreated))
+			Expect(writer.Header()).NotTo(HaveKey("Warning"))
+		})
+
+		It("does not warn unless asked to", func() {
+			handler.WarnUnrecognizedParameters = false
+			writer := provisionWith(map[string]interface{}{"zize": "large"})
+
+			Expect(writer.Code).To(Equal(http.StatusCreated))
+			Expect(writer.Header()).NotTo(HaveKey("Warning"))
+		})
+	})
+
+	Context("when the plan declares maintenance info", func() {
+		provisionWith := func(maintenanceInfo interface{}) *httptest.ResponseRecorder {
+			params := map[string]interface{}{
+				"service_id":        "my-service-id",
+				"plan_id":           "my-plan-id",
+				"organization_guid": "my-organization-guid",
+				"space_guid":        "my-space-guid",
+			}
+			if maintenanceInfo != nil {
+				params["maintenance_info"] = maintenanceInfo
+			}
+
+			reqBody, err := json.Marshal(params)
+			if err != nil {
+				panic(err)
+			}
+
+			request, err := http.NewRequest("PUT", "/v2/service_instances/some-guid", bytes.NewBuffer(reqBody))
+			if err != nil {
+				panic(err)
+			}
+
+			writer := httptest.NewRecorder()
+			handler.ServeHTTP(writer, request)
+
+			return writer
+		}
+
+		BeforeEach(func() {
+			handler.Cataloger = StaticCataloger{domain.Catalog{
+				Services: []domain.Service{
+					{
+						ID: "my-service-id",
+						Plans: []domain.Plan{
+							{
+								ID:              "my-plan-id",
+								MaintenanceInfo: &domain.MaintenanceInfo{Version: "1.2.3"},
+							},
+						},
+					},
+				},
+			}}
+		})
+
+		It("provisions when the maintenance info matches", func() {
+			writer := provisionWith(map[string]string{"version": "1.2.3"})
+
+			Expect(writer.Code).To(Equal(http.StatusCreated))
+			Expect(provisioner.WasCalledWith.MaintenanceInfo).To(Equal(&domain.MaintenanceInfo{Version: "1.2.3"}))
+		})
+
+		It("provisions when the maintenance info is omitted", func() {
+			writer := provisionWith(nil)
+
+			Expect(writer.Code).To(Equal(http.StatusCreated))
+			Expect(provisioner.WasCalled).To(BeTrue())
+		})
+
+		It("returns a 422 MaintenanceInfoConflict when the maintenance info does not match", func() {
+			writer := provisionWith(map[string]string{"version": "1.0.0"})
+
+			Expect(writer.Code).To(Equal(http.StatusUnprocessableEntity))
+			Expect(writer.Header()["Content-Type"]).To(Equal([]string{"application/json"}))
+
+			var msg struct {
+				Error string `json:"error"`
+			}
+			Expect(json.Unmarshal(writer.Body.Bytes(), &msg)).To(Succeed())
+			Expect(msg.Error).To(Equal("MaintenanceInfoConflict"))
+			Expect(provisioner.WasCalled).To(BeFalse())
+		})
+
+		It("includes the expected maintenance info version in the 422 body", func() {
+			writer := provisionWith(map[string]string{"version": "1.0.0"})
+
+			Expect(writer.Code).To(Equal(http.StatusUnprocessableEntity))
+			Expect(writer.Body.String()).To(MatchJSON(`{
+				"error": "MaintenanceInfoConflict",
+				"description": "passed maintenance_info does not match the catalog maintenance_info: expected version \"1.2.3\""
+			}`))
+		})
+	})
+
+	Context("when validating plans against the catalog", func() {
+		provisionPlan := func(planID string) *httptest.ResponseRecorder {
+			reqBody, err := json.Marshal(map[string]string{
+				"service_id":        "my-service-id",
+				"plan_id":           planID,
+				"organization_guid": "my-organization-guid",
+				"space_guid":        "my-space-guid",
+			})
+			if err != nil {
+				panic(err)
+			}
+
+			request, err := http.NewRequest("PUT", "/v2/service_instances/some-guid", bytes.NewBuffer(reqBody))
+			if err != nil {
+				panic(err)
+			}
+
+			writer := httptest.NewRecorder()
+			handler.ServeHTTP(writer, request)
+
+			return writer
+		}
+
+		BeforeEach(func() {
+			handler.Cataloger = StaticCataloger{domain.Catalog{
+				Services: []domain.Service{
+					{ID: "my-service-id", Plans: []domain.Plan{{ID: "my-plan-id"}}},
+				},
+			}}
+		})
+
+		It("passes unknown plans to the provisioner by default", func() {
+			writer := provisionPlan("unknown-plan-id")
+
+			Expect(writer.Code).To(Equal(http.StatusCreated))
+			Expect(provisioner.WasCalled).To(BeTrue())
+		})
+
+		Context("when unknown plans are rejected", func() {
+			BeforeEach(func() {
+				handler.RejectUnknownPlans = true
+			})
+
+			It("provisions a known plan", func() {
+				writer := provisionPlan("my-plan-id")
+
+				Expect(writer.Code).To(Equal(http.StatusCreated))
+				Expect(provisioner.WasCalled).To(BeTrue())
+			})
+
+			It("returns a 422 with a description for an unknown plan", func() {
+				writer := provisionPlan("unknown-plan-id")
+
+				Expect(writer.Code).To(Equal(http.StatusUnprocessableEntity))
+				Expect(writer.Body.String()).To(MatchJSON(`{
+					"description": "plan \"unknown-plan-id\" of service \"my-service-id\" is not in the catalog"
+				}`))
+				Expect(provisioner.WasCalled).To(BeFalse())
+			})
+		})
+	})
+
+	Context("when the plan ID is missing", func() {
+		var request *http.Request
+
+		BeforeEach(func() {
+			reqBody, err := json.Marshal(map[string]string{
+				"service_id":        "my-service-id",
+				"organization_guid": "my-organization-guid",
+				"space_guid":        "my-space-guid",
+			})
+			if err != nil {
+				panic(err)
+			}
+
+			request, err = http.NewRequest("PUT", "/v2/service_instances/some-guid", bytes.NewBuffer(reqBody))
+			if err != nil {
+				panic(err)
+			}
+		})
+
+		It("returns a 400 when no default plan is configured", func() {
+			writer := httptest.NewRecorder()
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusBadRequest))
+			Expect(writer.Body.String()).To(MatchJSON(`{"description":"missing required field"}`))
+			Expect(provisioner.WasCalled).To(BeFalse())
+		})
+
+		Context("when a default plan is configured", func() {
+			BeforeEach(func() {
+				handler.DefaultPlanID = "default-plan-id"
+			})
+
+			It("provisions the default plan", func() {
+				writer := httptest.NewRecorder()
+
+				handler.ServeHTTP(writer, request)
+
+				Expect(writer.Code).To(Equal(http.StatusCreated))
+				Expect(provisioner.WasCalledWith.PlanID).To(Equal("default-plan-id"))
+			})
+		})
+	})
+
+	Context("when the organization and space GUIDs are missing", func() {
+		var request *http.Request
+
+		BeforeEach(func() {
+			reqBody, err := json.Marshal(map[string]string{
+				"service_id": "my-service-id",
+				"plan_id":    "my-plan-id",
+			})
+			if err != nil {
+				panic(err)
+			}
+
+			request, err = http.NewRequest("PUT", "/v2/service_instances/some-guid", bytes.NewBuffer(reqBody))
+			if err != nil {
+				panic(err)
+			}
+		})
+
+		It("returns a 400 naming the missing fields", func() {
+			writer := httptest.NewRecorder()
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusBadRequest))
+			Expect(writer.Body.String()).To(ContainSubstring("organization_guid"))
+			Expect(writer.Body.String()).To(ContainSubstring("space_guid"))
+			Expect(provisioner.WasCalled).To(BeFalse())
+		})
+
+		Context("when the handler allows them to be missing", func() {
+			BeforeEach(func() {
+				handler.AllowMissingSpace = true
+			})
+
+			It("provisions without them", func() {
+				writer := httptest.NewRecorder()
+
+				handler.ServeHTTP(writer, request)
+
+				Expect(writer.Code).To(Equal(http.StatusCreated))
+				Expect(provisioner.WasCalledWith).To(Equal(domain.ProvisionRequest{
+					InstanceID: "some-guid",
+					ServiceID:  "my-service-id",
+					PlanID:     "my-plan-id",
+				}))
+			})
+		})
+	})
+
+	Context("when the request body is not valid JSON", func() {
+		It("should not call the provisioner", func() {
+			writer := httptest.NewRecorder()
+
+			request, err := http.NewRequest("PUT", "/v2/service_instances/a-guid", strings.NewReader("{"))
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(provisioner.WasCalled).To(BeFalse())
+		})
+
+		It("should return a 400 and an error message", func() {
+			writer := httptest.NewRecorder()
+
+			request, err := http.NewRequest("PUT", "/v2/service_instances/a-guid", strings.NewReader("{"))
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusBadRequest))
+			Expect(writer.Header()["Content-Type"]).To(Equal([]string{"application/json"}))
+
+			var msg struct {
+				Description string `json:"description"`
+			}
+			Expect(json.Unmarshal(writer.Body.Bytes(), &msg)).To(Succeed())
+			Expect(msg.Description).To(ContainSubstring("JSON"))
+		})
+	})
+
+	Context("when the request body is missing a required field", func() {
+		It("should not call the provisioner", func() {
+			writer := httptest.NewRecorder()
+
+			request, err := http.NewRequest("PUT", "/v2/service_instances/a-guid", strings.NewReader("{}"))
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(provisioner.WasCalled).To(BeFalse())
+		})
+
+		It("should return a 400 and an error message", func() {
+			writer := httptest.NewRecorder()
+
+			request, err := http.NewRequest("PUT", "/v2/service_instances/a-guid", strings.NewReader("{}"))
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusBadRequest))
+			Expect(writer.Header()["Content-Type"]).To(Equal([]string{"application/json"}))
+
+			var msg struct {
+				Description string `json:"description"`
+			}
+			Expect(json.Unmarshal(writer.Body.Bytes(), &msg)).To(Succeed())
+			Expect(msg.Description).To(ContainSubstring("missing required field"))
+		})
+	})
+
+	Context("when the request body is not read before the timeout", func() {
+		var bodyWriter *io.PipeWriter
+		var request *http.Request
+
+		BeforeEach(func() {
+			handler.BodyReadTimeout = 10 * time.Millisecond
+
+			var bodyReader *io.PipeReader
+			bodyReader, bodyWriter = io.Pipe()
+
+			var err error
+			request, err = http.NewRequest("PUT", "/v2/service_instances/a-guid", bodyReader)
+			if err != nil {
+				panic(err)
+			}
+		})
+
+		AfterEach(func() {
+			bodyWriter.Close()
+		})
+
+		It("should not call the provisioner", func() {
+			handler.ServeHTTP(httptest.NewRecorder(), request)
+
+			Expect(provisioner.WasCalled).To(BeFalse())
+		})
+
+		It("should return a 408 and an error message", func() {
+			writer := httptest.NewRecorder()
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusRequestTimeout))
+			Expect(writer.Header()["Content-Type"]).To(Equal([]string{"application/json"}))
+			Expect(writer.Body.String()).To(MatchJSON(`{"description":"timed out reading request body"}`))
+		})
+
+		It("stops reading the body before returning", func() {
+			goroutines := runtime.NumGoroutine()
+
+			handler.ServeHTTP(httptest.NewRecorder(), request)
+
+			_, err := bodyWriter.Write([]byte(`{"service_id":"my-service-id"}`))
+			Expect(err).To(Equal(io.ErrClosedPipe))
+			Expect(runtime.NumGoroutine()).To(BeNumerically("<=", goroutines))
+		})
+
+		It("interrupts a read from a client connection", func() {
+			server := httptest.NewServer(handler)
+			defer server.Close()
+
+			conn, err := net.Dial("tcp", server.Listener.Addr().String())
+			Expect(err).NotTo(HaveOccurred())
+			defer conn.Close()
+
+			_, err = conn.Write([]byte("PUT /v2/service_instances/a-guid HTTP/1.1\r\nHost: localhost\r\nContent-Length: 100\r\n\r\n{\"service_id\""))
+			Expect(err).NotTo(HaveOccurred())
+
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			response, err := http.ReadResponse(bufio.NewReader(conn), nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(response.StatusCode).To(Equal(http.StatusRequestTimeout))
 		})
 	})
 })
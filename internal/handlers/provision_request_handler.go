@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/pivotal-cf-experimental/envoy/domain"
+)
+
+type provisionRequestFinder interface {
+	Find(instanceID string) (domain.ProvisionRequest, bool)
+}
+
+// ProvisionRequestHandler serves the last successful provision request for
+// a service instance, including its parameters, to aid troubleshooting.
+type ProvisionRequestHandler struct {
+	provisionRequestFinder
+}
+
+func NewProvisionRequestHandler(finder provisionRequestFinder) ProvisionRequestHandler {
+	return ProvisionRequestHandler{
+		provisionRequestFinder: finder,
+	}
+}
+
+func (handler ProvisionRequestHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	expression := regexp.MustCompile(`^/debug/service_instances/(.*)/provision_request$`)
+	matches := expression.FindStringSubmatch(req.URL.Path)
+	if matches == nil {
+		respond(w, http.StatusNotFound, EmptyJSON)
+		return
+	}
+
+	request, ok := handler.provisionRequestFinder.Find(matches[1])
+	if !ok {
+		respond(w, http.StatusNotFound, EmptyJSON)
+		return
+	}
+
+	respond(w, http.StatusOK, struct {
+		InstanceID        string                  `json:"instance_id"`
+		ServiceID         string                  `json:"service_id"`
+		PlanID            string                  `json:"plan_id"`
+		OrganizationGUID  string                  `json:"organization_guid,omitempty"`
+		SpaceGUID         string                  `json:"space_guid,omitempty"`
+		AcceptsIncomplete bool                    `json:"accepts_incomplete"`
+		MaintenanceInfo   *domain.MaintenanceInfo `json:"maintenance_info,omitempty"`
+		Context           map[string]interface{}  `json:"context,omitempty"`
+		Parameters        map[string]interface{}  `json:"parameters,omitempty"`
+	}{
+		InstanceID:        request.InstanceID,
+		ServiceID:         request.ServiceID,
+		PlanID:            request.PlanID,
+		OrganizationGUID:  request.OrganizationGUID,
+		SpaceGUID:         request.SpaceGUID,
+		AcceptsIncomplete: request.AcceptsIncomplete,
+		MaintenanceInfo:   request.MaintenanceInfo,
+		Context:           request.Context,
+		Parameters:        request.Parameters,
+	})
+}
@@ -0,0 +1,72 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/pivotal-cf-experimental/envoy/domain"
+	"github.com/pivotal-cf-experimental/envoy/internal/handlers"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ProvisionRequestHandler", func() {
+	var requests *handlers.ProvisionRequests
+	var handler handlers.ProvisionRequestHandler
+
+	BeforeEach(func() {
+		requests = handlers.NewProvisionRequests()
+		handler = handlers.NewProvisionRequestHandler(requests)
+	})
+
+	fetch := func(instanceID string) *httptest.ResponseRecorder {
+		request, err := http.NewRequest("GET", "/debug/service_instances/"+instanceID+"/provision_request", nil)
+		if err != nil {
+			panic(err)
+		}
+
+		writer := httptest.NewRecorder()
+		handler.ServeHTTP(writer, request)
+
+		return writer
+	}
+
+	It("returns the recorded provision request, including its parameters", func() {
+		requests.Record(domain.ProvisionRequest{
+			InstanceID:       "instance-id",
+			ServiceID:        "service-id",
+			PlanID:           "plan-id",
+			OrganizationGUID: "organization-guid",
+			SpaceGUID:        "space-guid",
+			Parameters:       map[string]interface{}{"size": "large"},
+		})
+
+		writer := fetch("instance-id")
+
+		Expect(writer.Code).To(Equal(http.StatusOK))
+		Expect(writer.Body.String()).To(MatchJSON(`{
+			"instance_id": "instance-id",
+			"service_id": "service-id",
+			"plan_id": "plan-id",
+			"organization_guid": "organization-guid",
+			"space_guid": "space-guid",
+			"accepts_incomplete": false,
+			"parameters": {"size": "large"}
+		}`))
+	})
+
+	It("returns a 404 for an instance without a recorded request", func() {
+		writer := fetch("unknown-id")
+
+		Expect(writer.Code).To(Equal(http.StatusNotFound))
+		Expect(writer.Body.String()).To(MatchJSON(`{}`))
+	})
+
+	It("returns a 404 once the request has been forgotten", func() {
+		requests.Record(domain.ProvisionRequest{InstanceID: "instance-id"})
+		requests.Forget("instance-id")
+
+		Expect(fetch("instance-id").Code).To(Equal(http.StatusNotFound))
+	})
+})
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"sync"
+
+	"github.com/pivotal-cf-experimental/envoy/domain"
+)
+
+// ProvisionRequests remembers the last successful provision request for
+// each service instance, so that it can be returned for troubleshooting.
+// Requests are kept in memory until the instance is deprovisioned or the
+// broker restarts. It is safe for concurrent use.
+type ProvisionRequests struct {
+	mutex    sync.Mutex
+	requests map[string]domain.ProvisionRequest
+}
+
+func NewProvisionRequests() *ProvisionRequests {
+	return &ProvisionRequests{
+		requests: map[string]domain.ProvisionRequest{},
+	}
+}
+
+func (r *ProvisionRequests) Record(request domain.ProvisionRequest) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.requests[request.InstanceID] = request
+}
+
+func (r *ProvisionRequests) Forget(instanceID string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.requests, instanceID)
+}
+
+func (r *ProvisionRequests) Find(instanceID string) (domain.ProvisionRequest, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	request, ok := r.requests[instanceID]
+	return request, ok
+}
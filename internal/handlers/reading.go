@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	errBodyReadTimeout = errors.New("timed out reading request body")
+	errShortBody       = errors.New("request body is shorter than its Content-Length")
+	errArrayBody       = errors.New("request body must be a JSON object, not an array")
+
+	errUnsupportedCharset = errors.New("request body must be JSON encoded as UTF-8; the charset in the Content-Type is not supported")
+)
+
+// decodeBody decodes the JSON object in the body of the request into v as
+// the body is read, rather than buffering the whole body first. When the
+// timeout is positive and the body has not been decoded before it expires,
+// errBodyReadTimeout is returned. When the request declares a
+// Content-Length, the rest of the body is read once it has been decoded,
+// and errShortBody is returned if it ends early, rather than proceeding
+// with a truncated body. A body that is a JSON array is rejected with
+// errArrayBody before any of it is decoded. A Content-Type that declares a
+// charset other than UTF-8 is rejected with errUnsupportedCharset without
+// reading the body. When the timeout expires, the read of the body is
+// interrupted with interruptBody, and decodeBody waits for it to stop, so
+// that a slow client does not keep the read going, or v being written,
+// after decodeBody has returned.
+func decodeBody(req *http.Request, timeout time.Duration, v interface{}) error {
+	if !acceptsCharset(req.Header.Get("Content-Type")) {
+		return errUnsupportedCharset
+	}
+
+	var body io.Reader = req.Body
+	if req.ContentLength > 0 {
+		body = &lengthReader{reader: req.Body, remaining: req.ContentLength}
+	}
+
+	if timeout <= 0 {
+		return decode(body, v)
+	}
+
+	results := make(chan error, 1)
+	go func() {
+		results <- decode(body, v)
+	}()
+
+	select {
+	case err := <-results:
+		return err
+	case <-time.After(timeout):
+		interruptBody(req)
+		<-results
+		return errBodyReadTimeout
+	}
+}
+
+type bodyInterrupterKey struct{}
+
+// withBodyInterrupter returns the request with a controller for the
+// connection that the ResponseWriter writes to, so that interruptBody can
+// set a deadline on reading the body.
+func withBodyInterrupter(w http.ResponseWriter, req *http.Request) *http.Request {
+	ctx := context.WithValue(req.Context(), bodyInterrupterKey{}, http.NewResponseController(w))
+	return req.WithContext(ctx)
+}
+
+// interruptBody stops any read of the request body that is in progress. A
+// read from the connection is interrupted by setting a read deadline in the
+// past, when the request came from withBodyInterrupter and the connection
+// supports deadlines, since closing the body of a server request waits for
+// the read to finish. The body is then closed, which interrupts reads from
+// other bodies, such as pipes.
+func interruptBody(req *http.Request) {
+	if controller, ok := req.Context().Value(bodyInterrupterKey{}).(*http.ResponseController); ok {
+		controller.SetReadDeadline(time.Now())
+	}
+
+	req.Body.Close()
+}
+
+func decode(body io.Reader, v interface{}) error {
+	if jsonUnmarshaler != nil {
+		return unmarshal(body, v)
+	}
+
+	buffered := bufio.NewReader(body)
+	if isArray(buffered) {
+		return errArrayBody
+	}
+
+	checked := &utf8Checker{reader: buffered, invalidAt: -1}
+	decoder := json.NewDecoder(checked)
+	if err := decoder.Decode(v); err != nil {
+		if err == errShortBody {
+			return err
+		}
+		if checked.invalidAt >= 0 {
+			return invalidUTF8Error(checked.invalidAt, checked.invalidByte)
+		}
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return fmt.Errorf("request body must be a JSON object: %s", err)
+	}
+
+	more := decoder.More()
+	if _, ok := body.(*lengthReader); ok {
+		if _, err := io.Copy(ioutil.Discard, body); err == errShortBody {
+			return err
+		}
+	}
+
+	if more {
+		return errors.New("request body must be a JSON object: unexpected data after the object")
+	}
+
+	return nil
+}
+
+// unmarshal reads the whole body so that it can be passed to a replacement
+// unmarshaler, which does not support streaming.
+func unmarshal(body io.Reader, v interface{}) error {
+	data, err := ioutil.ReadAll(body)
+	if err == errShortBody {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("request body must be a JSON object: %s", err)
+	}
+
+	if trimmed := bytes.TrimLeft(data, " \t\r\n"); len(trimmed) > 0 && trimmed[0] == '[' {
+		return errArrayBody
+	}
+
+	if err := jsonUnmarshaler.Unmarshal(data, v); err != nil {
+		if offset := invalidUTF8Offset(data, true); offset >= 0 {
+			return invalidUTF8Error(int64(offset), data[offset])
+		}
+		return fmt.Errorf("request body must be a JSON object: %s", err)
+	}
+
+	return nil
+}
+
+// lengthReader reads a body that declared its length, returning
+// errShortBody if the body ends before that many bytes have been read.
+type lengthReader struct {
+	reader    io.Reader
+	remaining int64
+}
+
+func (r *lengthReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.remaining -= int64(n)
+
+	if err == io.EOF && r.remaining > 0 {
+		return n, errShortBody
+	}
+	if err == io.ErrUnexpectedEOF {
+		return n, errShortBody
+	}
+
+	return n, err
+}
+
+// isArray reports whether the body is a JSON array, by peeking past any
+// leading whitespace without consuming it, so that it can be rejected
+// before its fields are decoded. Anything else is left to the decoder to
+// report.
+func isArray(body *bufio.Reader) bool {
+	for n := 1; ; n++ {
+		peeked, err := body.Peek(n)
+		if err != nil {
+			return false
+		}
+
+		switch peeked[n-1] {
+		case ' ', '\t', '\r', '\n':
+		default:
+			return peeked[n-1] == '['
+		}
+	}
+}
+
+// utf8Checker records the offset of the first byte of the body that is not
+// valid UTF-8 as it is read, so that a body that cannot be decoded because
+// of it can be reported clearly. The bytes read are passed on unchanged.
+type utf8Checker struct {
+	reader      io.Reader
+	offset      int64
+	pending     []byte
+	invalidAt   int64
+	invalidByte byte
+}
+
+func (c *utf8Checker) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	if c.invalidAt >= 0 {
+		return n, err
+	}
+
+	data := append(c.pending, p[:n]...)
+	start := c.offset - int64(len(c.pending))
+	c.offset += int64(n)
+	c.pending = nil
+
+	if offset := invalidUTF8Offset(data, err != nil); offset >= 0 {
+		c.invalidAt = start + int64(offset)
+		c.invalidByte = data[offset]
+		return n, err
+	}
+
+	if tail := incompleteRuneStart(data); tail >= 0 && err == nil {
+		c.pending = append([]byte(nil), data[tail:]...)
+	}
+
+	return n, err
+}
+
+// invalidUTF8Offset returns the offset of the first byte of data that is
+// not valid UTF-8, or -1 if there is none. A rune that is cut off at the
+// end of data is only treated as invalid when data is final.
+func invalidUTF8Offset(data []byte, final bool) int {
+	for i := 0; i < len(data); {
+		if data[i] < utf8.RuneSelf {
+			i++
+			continue
+		}
+
+		if !final && !utf8.FullRune(data[i:]) {
+			return -1
+		}
+
+		r, size := utf8.DecodeRune(data[i:])
+		if r == utf8.RuneError && size == 1 {
+			return i
+		}
+		i += size
+	}
+
+	return -1
+}
+
+// incompleteRuneStart returns the offset of a rune that is cut off at the
+// end of data, or -1 if the last rune is complete.
+func incompleteRuneStart(data []byte) int {
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				return i
+			}
+			return -1
+		}
+	}
+
+	return -1
+}
+
+func invalidUTF8Error(offset int64, b byte) error {
+	return fmt.Errorf("request body must be valid UTF-8: invalid byte 0x%02x at offset %d", b, offset)
+}
+
+// acceptsCharset reports whether the charset parameter of the content type
+// is UTF-8. A content type without a charset, or one that cannot be parsed,
+// is accepted, since the body is decoded as UTF-8 JSON regardless.
+func acceptsCharset(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return true
+	}
+
+	charset, ok := params["charset"]
+	return !ok || strings.EqualFold(charset, "utf-8")
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"sync"
+
+	"github.com/pivotal-cf-experimental/envoy/domain"
+)
+
+// RecordedExchanges keeps the most recent exchanges recorded, up to its
+// size, discarding the oldest when it is full, so that they can be returned
+// for troubleshooting. It is safe for concurrent use.
+type RecordedExchanges struct {
+	mutex     sync.Mutex
+	exchanges []domain.RecordedExchange
+	next      int
+	full      bool
+}
+
+func NewRecordedExchanges(size int) *RecordedExchanges {
+	return &RecordedExchanges{
+		exchanges: make([]domain.RecordedExchange, size),
+	}
+}
+
+func (r *RecordedExchanges) Record(exchange domain.RecordedExchange) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if len(r.exchanges) == 0 {
+		return
+	}
+
+	r.exchanges[r.next] = exchange
+	r.next = (r.next + 1) % len(r.exchanges)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// All returns the recorded exchanges, oldest first.
+func (r *RecordedExchanges) All() []domain.RecordedExchange {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !r.full {
+		return append([]domain.RecordedExchange(nil), r.exchanges[:r.next]...)
+	}
+
+	return append(append([]domain.RecordedExchange(nil), r.exchanges[r.next:]...), r.exchanges[:r.next]...)
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pivotal-cf-experimental/envoy/domain"
+)
+
+type recordedExchangeLister interface {
+	All() []domain.RecordedExchange
+}
+
+// RecordedExchangesHandler serves the recently recorded requests and their
+// responses, oldest first, to aid troubleshooting.
+type RecordedExchangesHandler struct {
+	recordedExchangeLister
+}
+
+func NewRecordedExchangesHandler(lister recordedExchangeLister) RecordedExchangesHandler {
+	return RecordedExchangesHandler{
+		recordedExchangeLister: lister,
+	}
+}
+
+type recordedExchange struct {
+	Time         time.Time `json:"time"`
+	Method       string    `json:"method"`
+	Path         string    `json:"path"`
+	Status       int       `json:"status"`
+	RequestBody  string    `json:"request_body,omitempty"`
+	ResponseBody string    `json:"response_body,omitempty"`
+}
+
+func (handler RecordedExchangesHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	exchanges := []recordedExchange{}
+	for _, exchange := range handler.recordedExchangeLister.All() {
+		exchanges = append(exchanges, recordedExchange{
+			Time:         exchange.Time,
+			Method:       exchange.Method,
+			Path:         exchange.Path,
+			Status:       exchange.Status,
+			RequestBody:  exchange.RequestBody,
+			ResponseBody: exchange.ResponseBody,
+		})
+	}
+
+	respond(w, http.StatusOK, struct {
+		Exchanges []recordedExchange `json:"exchanges"`
+	}{
+		Exchanges: exchanges,
+	})
+}
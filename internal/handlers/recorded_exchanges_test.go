@@ -0,0 +1,36 @@
+package handlers_test
+
+import (
+	"github.com/pivotal-cf-experimental/envoy/domain"
+	"github.com/pivotal-cf-experimental/envoy/internal/handlers"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RecordedExchanges", func() {
+	paths := func(exchanges []domain.RecordedExchange) []string {
+		var paths []string
+		for _, exchange := range exchanges {
+			paths = append(paths, exchange.Path)
+		}
+		return paths
+	}
+
+	It("returns the recorded exchanges, oldest first", func() {
+		exchanges := handlers.NewRecordedExchanges(3)
+		exchanges.Record(domain.RecordedExchange{Path: "/1"})
+		exchanges.Record(domain.RecordedExchange{Path: "/2"})
+
+		Expect(paths(exchanges.All())).To(Equal([]string{"/1", "/2"}))
+	})
+
+	It("discards the oldest exchanges once it is full", func() {
+		exchanges := handlers.NewRecordedExchanges(3)
+		for _, path := range []string{"/1", "/2", "/3", "/4", "/5"} {
+			exchanges.Record(domain.RecordedExchange{Path: path})
+		}
+
+		Expect(paths(exchanges.All())).To(Equal([]string{"/3", "/4", "/5"}))
+	})
+})
@@ -1,23 +1,84 @@
 package handlers
 
 import (
-	"encoding/json"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+
+	"github.com/pivotal-cf-experimental/envoy/domain"
 )
 
+// Logger is the structured logger that the handlers write to. It has the
+// same methods as envoy.Logger, which NewBrokerHandler passes in, and is
+// declared here so that this package need not import the root package.
+type Logger interface {
+	Info(message string, data map[string]interface{})
+	Error(message string, data map[string]interface{})
+}
+
 type Failure struct {
+	Error       string `json:"error,omitempty"`
 	Description string `json:"description"`
 }
 
 var EmptyJSON = map[string]interface{}{}
 
 func respond(w http.ResponseWriter, code int, response interface{}) {
-	body, err := json.Marshal(response)
+	body, err := jsonMarshaler.Marshal(response)
 	if err != nil {
 		panic(err)
 	}
 
+	respondWithBody(w, code, body)
+}
+
+// respondWithBody writes a response with a body that has already been
+// marshaled as JSON.
+func respondWithBody(w http.ResponseWriter, code int, body []byte) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
 	w.Write(body)
 }
+
+// respondWithInternalError writes a 500 response describing the error. When
+// a logger is available, the error is also logged along with a generated
+// reference that is included in the description, so that operators can find
+// the log line for a failed request reported by a user.
+func respondWithInternalError(w http.ResponseWriter, logger Logger, err error) {
+	description := err.Error()
+	if logger != nil {
+		ref := newReference()
+		logger.Error("request.internal-error", map[string]interface{}{
+			"ref":   ref,
+			"error": err.Error(),
+		})
+		description = fmt.Sprintf("%s (ref: %s)", description, ref)
+	}
+
+	respond(w, http.StatusInternalServerError, Failure{
+		Description: description,
+	})
+}
+
+// respondUnavailable writes a 503 response, including a Retry-After header
+// when the error says how long the client should wait.
+func respondUnavailable(w http.ResponseWriter, err domain.ServiceUnavailableError) {
+	if err.RetryAfter > 0 {
+		seconds := int64(math.Ceil(err.RetryAfter.Seconds()))
+		w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	}
+
+	respond(w, http.StatusServiceUnavailable, Failure{Description: err.Error()})
+}
+
+func newReference() string {
+	bytes := make([]byte, 6)
+	if _, err := rand.Read(bytes); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(bytes)
+}
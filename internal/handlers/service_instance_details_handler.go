@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/pivotal-cf-experimental/envoy/domain"
+)
+
+type serviceInstanceDetailer interface {
+	ServiceInstanceDetails(domain.ServiceInstanceDetailsRequest) (domain.ServiceInstanceDetails, error)
+}
+
+type ServiceInstanceDetailsHandler struct {
+	serviceInstanceDetailer
+	Logger           Logger
+	DescribeNotFound bool
+}
+
+func NewServiceInstanceDetailsHandler(serviceInstanceDetailer serviceInstanceDetailer) ServiceInstanceDetailsHandler {
+	return ServiceInstanceDetailsHandler{
+		serviceInstanceDetailer: serviceInstanceDetailer,
+	}
+}
+
+func (handler ServiceInstanceDetailsHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	request := handler.Parse(req)
+
+	details, err := handler.serviceInstanceDetailer.ServiceInstanceDetails(request)
+	if err != nil {
+		switch err.(type) {
+		case domain.ServiceInstanceNotFoundError:
+			if handler.DescribeNotFound {
+				respond(w, http.StatusNotFound, Failure{Description: err.Error()})
+			} else {
+				respond(w, http.StatusNotFound, EmptyJSON)
+			}
+		case domain.ServiceInstanceGoneError:
+			respond(w, http.StatusGone, EmptyJSON)
+		default:
+			respondWithInternalError(w, handler.Logger, err)
+		}
+		return
+	}
+
+	respond(w, http.StatusOK, details)
+}
+
+func (handler ServiceInstanceDetailsHandler) Parse(req *http.Request) domain.ServiceInstanceDetailsRequest {
+	expression := regexp.MustCompile(`^/v2/service_instances/(.*)$`)
+	matches := expression.FindStringSubmatch(req.URL.Path)
+
+	return domain.ServiceInstanceDetailsRequest{
+		InstanceID: matches[1],
+	}
+}
@@ -0,0 +1,213 @@
+package handlers_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/pivotal-cf-experimental/envoy/domain"
+	"github.com/pivotal-cf-experimental/envoy/internal/handlers"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type ServiceInstanceDetailer struct {
+	WasCalledWith domain.ServiceInstanceDetailsRequest
+	Details       domain.ServiceInstanceDetails
+	Error         error
+}
+
+func NewServiceInstanceDetailer() *ServiceInstanceDetailer {
+	return &ServiceInstanceDetailer{}
+}
+
+func (d *ServiceInstanceDetailer) ServiceInstanceDetails(req domain.ServiceInstanceDetailsRequest) (domain.ServiceInstanceDetails, error) {
+	d.WasCalledWith = req
+	return d.Details, d.Error
+}
+
+var _ = Describe("ServiceInstanceDetailsHandler", func() {
+	var detailer *ServiceInstanceDetailer
+	var handler handlers.ServiceInstanceDetailsHandler
+
+	BeforeEach(func() {
+		detailer = NewServiceInstanceDetailer()
+		handler = handlers.NewServiceInstanceDetailsHandler(detailer)
+	})
+
+	It("calls the detailer ServiceInstanceDetails method with the correct values", func() {
+		request, err := http.NewRequest("GET", "/v2/service_instances/service-instance-id", nil)
+		if err != nil {
+			panic(err)
+		}
+
+		handler.ServeHTTP(httptest.NewRecorder(), request)
+
+		Expect(detailer.WasCalledWith).To(Equal(domain.ServiceInstanceDetailsRequest{
+			InstanceID: "service-instance-id",
+		}))
+	})
+
+	It("returns a 200 with the service instance details", func() {
+		detailer.Details = domain.ServiceInstanceDetails{
+			ServiceID:    "service-id",
+			PlanID:       "plan-id",
+			DashboardURL: "http://dashboard.example.com",
+		}
+
+		writer := httptest.NewRecorder()
+		request, err := http.NewRequest("GET", "/v2/service_instances/service-instance-id", nil)
+		if err != nil {
+			panic(err)
+		}
+
+		handler.ServeHTTP(writer, request)
+
+		Expect(writer.Code).To(Equal(http.StatusOK))
+		Expect(writer.Header()["Content-Type"]).To(Equal([]string{"application/json"}))
+		Expect(writer.Body.String()).To(MatchJSON(`{
+			"service_id": "service-id",
+			"plan_id": "plan-id",
+			"dashboard_url": "http://dashboard.example.com"
+		}`))
+	})
+
+	Context("when the details include the last operation", func() {
+		It("returns the last operation in the response body", func() {
+			detailer.Details = domain.ServiceInstanceDetails{
+				ServiceID: "service-id",
+				PlanID:    "plan-id",
+				LastOperation: &domain.InstanceLastOperation{
+					State:       domain.LastOperationSucceeded,
+					Description: "upgraded to 1.2.3",
+					UpdatedAt:   time.Date(2020, time.March, 4, 5, 6, 7, 0, time.UTC),
+				},
+			}
+
+			writer := httptest.NewRecorder()
+			request, err := http.NewRequest("GET", "/v2/service_instances/service-instance-id", nil)
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusOK))
+			Expect(writer.Body.String()).To(MatchJSON(`{
+				"service_id": "service-id",
+				"plan_id": "plan-id",
+				"last_operation": {
+					"state": "succeeded",
+					"description": "upgraded to 1.2.3",
+					"updated_at": "2020-03-04T05:06:07Z"
+				}
+			}`))
+		})
+	})
+
+	Context("when the details include the provisioning context", func() {
+		It("returns the context in the response body", func() {
+			detailer.Details = domain.ServiceInstanceDetails{
+				ServiceID: "service-id",
+				PlanID:    "plan-id",
+				Context: map[string]interface{}{
+					"organization_name": "my-organization",
+					"space_name":        "my-space",
+				},
+			}
+
+			writer := httptest.NewRecorder()
+			request, err := http.NewRequest("GET", "/v2/service_instances/service-instance-id", nil)
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusOK))
+			Expect(writer.Body.String()).To(MatchJSON(`{
+				"service_id": "service-id",
+				"plan_id": "plan-id",
+				"context": {
+					"organization_name": "my-organization",
+					"space_name": "my-space"
+				}
+			}`))
+		})
+	})
+
+	Context("when the service instance never existed", func() {
+		It("returns a 404 with JSON {}", func() {
+			detailer.Error = domain.ServiceInstanceNotFoundError("no such instance")
+
+			writer := httptest.NewRecorder()
+			request, err := http.NewRequest("GET", "/v2/service_instances/unknown-instance-id", nil)
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusNotFound))
+			Expect(writer.Header()["Content-Type"]).To(Equal([]string{"application/json"}))
+			Expect(writer.Body.String()).To(MatchJSON("{}"))
+		})
+
+		Context("when the handler describes missing instances", func() {
+			BeforeEach(func() {
+				handler.DescribeNotFound = true
+			})
+
+			It("returns a 404 with the error as the description", func() {
+				detailer.Error = domain.ServiceInstanceNotFoundError("no such instance")
+
+				writer := httptest.NewRecorder()
+				request, err := http.NewRequest("GET", "/v2/service_instances/unknown-instance-id", nil)
+				if err != nil {
+					panic(err)
+				}
+
+				handler.ServeHTTP(writer, request)
+
+				Expect(writer.Code).To(Equal(http.StatusNotFound))
+				Expect(writer.Body.String()).To(MatchJSON(`{"description":"no such instance"}`))
+			})
+		})
+	})
+
+	Context("when the service instance has been deprovisioned", func() {
+		It("returns a 410 Gone with JSON {}", func() {
+			detailer.Error = domain.ServiceInstanceGoneError("instance was deprovisioned")
+
+			writer := httptest.NewRecorder()
+			request, err := http.NewRequest("GET", "/v2/service_instances/deleted-instance-id", nil)
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusGone))
+			Expect(writer.Body.String()).To(MatchJSON("{}"))
+		})
+	})
+
+	Context("when the detailer fails", func() {
+		It("returns a 500 error with the message", func() {
+			detailer.Error = errors.New("my database failed somehow!")
+
+			writer := httptest.NewRecorder()
+			request, err := http.NewRequest("GET", "/v2/service_instances/service-instance-id", nil)
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusInternalServerError))
+			Expect(writer.Body.String()).To(MatchJSON(`{"description": "my database failed somehow!"}`))
+		})
+	})
+})
@@ -14,6 +14,9 @@ type unbinder interface {
 
 type UnbindHandler struct {
 	unbinder
+	Logger                  Logger
+	MissingInstanceNotFound bool
+	WarnSameIDs             bool
 }
 
 func NewUnbindHandler(unbinder unbinder) UnbindHandler {
@@ -25,19 +28,32 @@ func NewUnbindHandler(unbinder unbinder) UnbindHandler {
 func (handler UnbindHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	request, err := handler.Parse(req)
 	if err != nil {
-		respond(w, http.StatusBadRequest, Failure{err.Error()})
+		respond(w, http.StatusBadRequest, Failure{Description: err.Error()})
 		return
 	}
 
+	if handler.WarnSameIDs {
+		warnSameIDs(w, request.InstanceID, request.BindingID)
+	}
+
 	err = handler.unbinder.Unbind(request)
 	if err != nil {
-		switch err.(type) {
-		case domain.ServiceBindingNotFoundError:
+		switch e := err.(type) {
+		case domain.ServiceBindingNotFoundError, domain.ServiceInstanceGoneError:
 			respond(w, http.StatusGone, EmptyJSON)
+		case domain.ServiceInstanceNotFoundError:
+			// The spec only allows a 410 Gone when there is nothing to
+			// unbind, but some platforms expect a 404 Not Found when the
+			// service instance itself does not exist.
+			if handler.MissingInstanceNotFound {
+				respond(w, http.StatusNotFound, EmptyJSON)
+			} else {
+				respond(w, http.StatusGone, EmptyJSON)
+			}
+		case domain.ServiceUnavailableError:
+			respondUnavailable(w, e)
 		default:
-			respond(w, http.StatusInternalServerError, Failure{
-				Description: err.Error(),
-			})
+			respondWithInternalError(w, handler.Logger, err)
 		}
 		return
 	}
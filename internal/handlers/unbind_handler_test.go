@@ -62,6 +62,24 @@ var _ = Describe("UnbindHandler", func() {
 		}))
 	})
 
+	Context("when same IDs are warned about and the binding ID is the same as the instance ID", func() {
+		It("unbinds with a Warning header", func() {
+			handler.WarnSameIDs = true
+
+			writer := httptest.NewRecorder()
+			request, err := http.NewRequest("DELETE", "/v2/service_instances/same-guid/service_bindings/same-guid?plan_id=plan-id&service_id=service-id", nil)
+			if err != nil {
+				panic(err)
+			}
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusOK))
+			Expect(writer.Header().Get("Warning")).To(ContainSubstring("is the same as the instance_id"))
+			Expect(unbinder.WasCalled).To(BeTrue())
+		})
+	})
+
 	Context("when the unbinder succeeds", func() {
 		It("returns a 200 status code with an empty JSON body", func() {
 			writer := httptest.NewRecorder()
@@ -112,6 +130,52 @@ var _ = Describe("UnbindHandler", func() {
 		})
 	})
 
+	Context("when the binding or its service instance is missing", func() {
+		unbindWith := func(unbindError error) int {
+			writer := httptest.NewRecorder()
+			request, err := http.NewRequest("DELETE",
+				"/v2/service_instances/service-instance-id/service_bindings/service-binding-id?plan_id=some-plan-id&service_id=some-service-id",
+				nil)
+			if err != nil {
+				panic(err)
+			}
+
+			unbinder.UnbindError = unbindError
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Body.String()).To(MatchJSON("{}"))
+			return writer.Code
+		}
+
+		Context("by default", func() {
+			It("returns a 410 when the binding is missing", func() {
+				Expect(unbindWith(domain.ServiceBindingNotFoundError("missing"))).To(Equal(http.StatusGone))
+			})
+
+			It("returns a 410 when the service instance is missing", func() {
+				Expect(unbindWith(domain.ServiceInstanceNotFoundError("missing"))).To(Equal(http.StatusGone))
+			})
+		})
+
+		Context("when a missing service instance is reported as not found", func() {
+			BeforeEach(func() {
+				handler.MissingInstanceNotFound = true
+			})
+
+			It("returns a 410 when the binding is missing", func() {
+				Expect(unbindWith(domain.ServiceBindingNotFoundError("missing"))).To(Equal(http.StatusGone))
+			})
+
+			It("returns a 404 when the service instance is missing", func() {
+				Expect(unbindWith(domain.ServiceInstanceNotFoundError("missing"))).To(Equal(http.StatusNotFound))
+			})
+
+			It("returns a 410 when the service instance has been deprovisioned", func() {
+				Expect(unbindWith(domain.ServiceInstanceGoneError("gone"))).To(Equal(http.StatusGone))
+			})
+		})
+	})
+
 	Context("when the unbinder fails", func() {
 		It("returns a 500 error with the message", func() {
 			writer := httptest.NewRecorder()
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/pivotal-cf-experimental/envoy/domain"
+)
+
+type updater interface {
+	Update(domain.UpdateRequest) (domain.UpdateResponse, error)
+}
+
+type updateValidator interface {
+	ValidateTransition(from, to string) error
+}
+
+type UpdateHandler struct {
+	updater
+	BodyReadTimeout            time.Duration
+	Logger                     Logger
+	Validator                  updateValidator
+	Cataloger                  cataloger
+	WarnUnrecognizedParameters bool
+	Signer                     operationSigner
+}
+
+func NewUpdateHandler(updater updater) UpdateHandler {
+	return UpdateHandler{
+		updater: updater,
+	}
+}
+
+func (handler UpdateHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	request, err := handler.Parse(withBodyInterrupter(w, req))
+	if err != nil {
+		switch err {
+		case errBodyReadTimeout:
+			respond(w, http.StatusRequestTimeout, Failure{Description: err.Error()})
+		case errUnsupportedCharset:
+			respond(w, http.StatusUnsupportedMediaType, Failure{Description: err.Error()})
+		default:
+			respond(w, http.StatusBadRequest, Failure{Description: err.Error()})
+		}
+		return
+	}
+
+	if err := handler.Validate(request); err != nil {
+		respond(w, http.StatusUnprocessableEntity, Failure{Description: err.Error()})
+		return
+	}
+
+	if request.IsContextOnly() && !handler.allowsContextUpdates(request.ServiceID) {
+		respond(w, http.StatusUnprocessableEntity, Failure{
+			Description: fmt.Sprintf("service %q does not allow context updates", request.ServiceID),
+		})
+		return
+	}
+
+	// An update that does not change the plan is made to the instance's
+	// current plan.
+	planID := request.PlanID
+	if planID == "" {
+		planID = request.PreviousPlanID
+	}
+
+	if !request.AcceptsIncomplete && handler.Cataloger != nil && handler.Cataloger.Catalog().IsAsyncOnly(request.ServiceID, planID) {
+		respond(w, http.StatusUnprocessableEntity, Failure{
+			Error:       "AsyncRequired",
+			Description: fmt.Sprintf("plan %q can only be updated asynchronously", planID),
+		})
+		return
+	}
+
+	syncOnly := handler.Cataloger != nil && handler.Cataloger.Catalog().IsSyncOnly(request.ServiceID, planID)
+	if syncOnly {
+		request.AcceptsIncomplete = false
+	}
+
+	if handler.WarnUnrecognizedParameters && handler.Cataloger != nil {
+		if plan, ok := handler.Cataloger.Catalog().FindPlan(request.ServiceID, planID); ok {
+			warnUnrecognizedParameters(w, plan.Schemas.InstanceUpdate(), request.Parameters)
+		}
+	}
+
+	response, err := handler.updater.Update(request)
+	if err != nil {
+		switch e := err.(type) {
+		case domain.AsyncRequiredError:
+			respond(w, http.StatusUnprocessableEntity, Failure{
+				Error:       "AsyncRequired",
+				Description: err.Error(),
+			})
+		case domain.ServiceUnavailableError:
+			respondUnavailable(w, e)
+		default:
+			respondWithInternalError(w, handler.Logger, err)
+		}
+		return
+	}
+
+	body := struct {
+		DashboardURL string `json:"dashboard_url,omitempty"`
+		Operation    string `json:"operation,omitempty"`
+	}{
+		DashboardURL: response.DashboardURL,
+	}
+
+	if response.IsAsync && !syncOnly {
+		body.Operation = signOperation(handler.Signer, response.OperationData)
+		w.Header().Set("Location", LastOperationURL(request.InstanceID, request.ServiceID, planID, body.Operation))
+		respond(w, http.StatusAccepted, body)
+		return
+	}
+
+	respond(w, http.StatusOK, body)
+}
+
+func (handler UpdateHandler) Parse(req *http.Request) (domain.UpdateRequest, error) {
+	var params struct {
+		ServiceID      string `json:"service_id"`
+		PlanID         string `json:"plan_id"`
+		PreviousValues struct {
+			PlanID string `json:"plan_id"`
+		} `json:"previous_values"`
+		Context         map[string]interface{}  `json:"context"`
+		Parameters      map[string]interface{}  `json:"parameters"`
+		MaintenanceInfo *domain.MaintenanceInfo `json:"maintenance_info"`
+	}
+	if err := decodeBody(req, handler.BodyReadTimeout, &params); err != nil {
+		return domain.UpdateRequest{}, err
+	}
+
+	expression := regexp.MustCompile(`^/v2/service_instances/(.*)$`)
+	instanceID := expression.FindStringSubmatch(req.URL.Path)[1]
+
+	if len(instanceID) == 0 || len(params.ServiceID) == 0 {
+		return domain.UpdateRequest{}, errors.New("missing required field")
+	}
+
+	return domain.UpdateRequest{
+		InstanceID:        instanceID,
+		ServiceID:         params.ServiceID,
+		PlanID:            params.PlanID,
+		PreviousPlanID:    params.PreviousValues.PlanID,
+		AcceptsIncomplete: req.URL.Query().Get("accepts_incomplete") == "true",
+		Context:           params.Context,
+		Parameters:        params.Parameters,
+		MaintenanceInfo:   params.MaintenanceInfo,
+	}, nil
+}
+
+// Validate checks that the plan change requested by the update is allowed
+// by the catalog and by the validator, when they are available to the
+// handler.
+func (handler UpdateHandler) Validate(request domain.UpdateRequest) error {
+	if request.PlanID == "" || request.PreviousPlanID == "" {
+		return nil
+	}
+
+	if request.PlanID == request.PreviousPlanID {
+		return nil
+	}
+
+	if handler.Cataloger != nil {
+		catalog := handler.Cataloger.Catalog()
+		service, serviceFound := catalog.FindService(request.ServiceID)
+		plan, planFound := catalog.FindPlan(request.ServiceID, request.PreviousPlanID)
+		if serviceFound && planFound && !plan.EffectiveUpdateable(service) {
+			return fmt.Errorf("plan %q of service %q cannot be updated to a different plan", request.PreviousPlanID, request.ServiceID)
+		}
+	}
+
+	if handler.Validator == nil {
+		return nil
+	}
+
+	return handler.Validator.ValidateTransition(request.PreviousPlanID, request.PlanID)
+}
+
+// allowsContextUpdates reports whether the service declares that it allows
+// context-only updates in the catalog. Services that are not in the catalog
+// are assumed to allow them.
+func (handler UpdateHandler) allowsContextUpdates(serviceID string) bool {
+	if handler.Cataloger == nil {
+		return true
+	}
+
+	service, ok := handler.Cataloger.Catalog().FindService(serviceID)
+	if !ok {
+		return true
+	}
+
+	return service.AllowContextUpdates
+}
@@ -0,0 +1,483 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/pivotal-cf-experimental/envoy/domain"
+	"github.com/pivotal-cf-experimental/envoy/internal/handlers"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type Updater struct {
+	WasCalledWith domain.UpdateRequest
+	WasCalled     bool
+	Error         error
+	IsAsync       bool
+	OperationData string
+	DashboardURL  string
+}
+
+func NewUpdater() *Updater {
+	return &Updater{}
+}
+
+func (u *Updater) Update(req domain.UpdateRequest) (domain.UpdateResponse, error) {
+	u.WasCalledWith = req
+	u.WasCalled = true
+	return domain.UpdateResponse{
+		DashboardURL:  u.DashboardURL,
+		IsAsync:       u.IsAsync,
+		OperationData: u.OperationData,
+	}, u.Error
+}
+
+type TransitionValidator struct {
+	Forbidden map[string]string
+}
+
+func (v TransitionValidator) ValidateTransition(from, to string) error {
+	if v.Forbidden[from] == to {
+		return fmt.Errorf("cannot change plan from %s to %s", from, to)
+	}
+
+	return nil
+}
+
+var _ = Describe("UpdateHandler", func() {
+	var handler handlers.UpdateHandler
+	var updater *Updater
+
+	BeforeEach(func() {
+		updater = NewUpdater()
+		handler = handlers.NewUpdateHandler(updater)
+	})
+
+	update := func(path string, params map[string]interface{}) *httptest.ResponseRecorder {
+		reqBody, err := json.Marshal(params)
+		if err != nil {
+			panic(err)
+		}
+
+		request, err := http.NewRequest("PATCH", path, bytes.NewBuffer(reqBody))
+		if err != nil {
+			panic(err)
+		}
+
+		writer := httptest.NewRecorder()
+		handler.ServeHTTP(writer, request)
+
+		return writer
+	}
+
+	It("calls the updater Update method with the correct values", func() {
+		update("/v2/service_instances/some-guid?accepts_incomplete=true", map[string]interface{}{
+			"service_id": "my-service-id",
+			"plan_id":    "my-new-plan-id",
+			"previous_values": map[string]interface{}{
+				"plan_id": "my-old-plan-id",
+			},
+		})
+
+		Expect(updater.WasCalledWith).To(Equal(domain.UpdateRequest{
+			InstanceID:        "some-guid",
+			ServiceID:         "my-service-id",
+			PlanID:            "my-new-plan-id",
+			PreviousPlanID:    "my-old-plan-id",
+			AcceptsIncomplete: true,
+		}))
+	})
+
+	Context("when the update is synchronous", func() {
+		It("returns a 200 with an empty JSON body", func() {
+			writer := update("/v2/service_instances/some-guid", map[string]interface{}{
+				"service_id": "my-service-id",
+				"plan_id":    "my-new-plan-id",
+			})
+
+			Expect(writer.Code).To(Equal(http.StatusOK))
+			Expect(writer.Header()["Content-Type"]).To(Equal([]string{"application/json"}))
+			Expect(writer.Body.String()).To(MatchJSON("{}"))
+			Expect(updater.WasCalledWith.AcceptsIncomplete).To(BeFalse())
+		})
+
+		It("returns the dashboard URL when the plan change changes it", func() {
+			updater.DashboardURL = "https://dashboard.example.com/some-guid"
+
+			writer := update("/v2/service_instances/some-guid", map[string]interface{}{
+				"service_id": "my-service-id",
+				"plan_id":    "my-new-plan-id",
+			})
+
+			Expect(writer.Code).To(Equal(http.StatusOK))
+			Expect(writer.Body.String()).To(MatchJSON(`{"dashboard_url": "https://dashboard.example.com/some-guid"}`))
+		})
+	})
+
+	Context("when unrecognized parameters are warned about", func() {
+		BeforeEach(func() {
+			handler.WarnUnrecognizedParameters = true
+			handler.Cataloger = StaticCataloger{domain.Catalog{
+				Services: []domain.Service{
+					{
+						ID: "my-service-id",
+						Plans: []domain.Plan{
+							{
+								ID: "my-plan-id",
+								Schemas: &domain.Schemas{
+									ServiceInstance: &domain.ServiceInstanceSchema{
+										Update: &domain.InputParametersSchema{
+											Parameters: map[string]interface{}{
+												"properties": map[string]interface{}{
+													"size": map[string]interface{}{"type": "string"},
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			}}
+		})
+
+		It("checks the parameters against the schema of the current plan when the plan is unchanged", func() {
+			writer := update("/v2/service_instances/some-guid", map[string]interface{}{
+				"service_id":      "my-service-id",
+				"parameters":      map[string]interface{}{"zize": "large"},
+				"previous_values": map[string]interface{}{"plan_id": "my-plan-id"},
+			})
+
+			Expect(writer.Code).To(Equal(http.StatusOK))
+			Expect(writer.Header()["Warning"]).To(Equal([]string{`299 - "unrecognized parameters: zize"`}))
+		})
+	})
+
+	Context("when the update is asynchronous", func() {
+		BeforeEach(func() {
+			updater.IsAsync = true
+			updater.OperationData = "some-operation"
+		})
+
+		It("returns a 202 with the operation and the last_operation URL", func() {
+			writer := update("/v2/service_instances/some-guid?accepts_incomplete=true", map[string]interface{}{
+				"service_id": "my-service-id",
+				"plan_id":    "my-new-plan-id",
+			})
+
+			Expect(writer.Code).To(Equal(http.StatusAccepted))
+			Expect(writer.Body.String()).To(MatchJSON(`{"operation": "some-operation"}`))
+			Expect(writer.Header().Get("Location")).To(Equal(
+				"/v2/service_instances/some-guid/last_operation?operation=some-operation&plan_id=my-new-plan-id&service_id=my-service-id"))
+		})
+
+		It("uses the current plan in the last_operation URL when the plan is unchanged", func() {
+			writer := update("/v2/service_instances/some-guid?accepts_incomplete=true", map[string]interface{}{
+				"service_id":      "my-service-id",
+				"parameters":      map[string]interface{}{"size": "large"},
+				"previous_values": map[string]interface{}{"plan_id": "my-plan-id"},
+			})
+
+			Expect(writer.Code).To(Equal(http.StatusAccepted))
+			Expect(writer.Header().Get("Location")).To(Equal(
+				"/v2/service_instances/some-guid/last_operation?operation=some-operation&plan_id=my-plan-id&service_id=my-service-id"))
+		})
+	})
+
+	Context("when the plan is declared asynchronous-only", func() {
+		BeforeEach(func() {
+			handler.Cataloger = StaticCataloger{domain.Catalog{
+				Services: []domain.Service{{
+					ID:    "my-service-id",
+					Plans: []domain.Plan{{ID: "async-plan", AsyncOnly: true}},
+				}},
+			}}
+			updater.IsAsync = true
+			updater.OperationData = "some-operation"
+		})
+
+		It("returns a 422 AsyncRequired without calling the updater when incomplete responses are not accepted", func() {
+			writer := update("/v2/service_instances/some-guid", map[string]interface{}{
+				"service_id": "my-service-id",
+				"plan_id":    "async-plan",
+			})
+
+			Expect(writer.Code).To(Equal(http.StatusUnprocessableEntity))
+			Expect(writer.Body.String()).To(MatchJSON(`{
+				"error": "AsyncRequired",
+				"description": "plan \"async-plan\" can only be updated asynchronously"
+			}`))
+			Expect(updater.WasCalled).To(BeFalse())
+		})
+
+		It("returns a 202 when incomplete responses are accepted", func() {
+			writer := update("/v2/service_instances/some-guid?accepts_incomplete=true", map[string]interface{}{
+				"service_id": "my-service-id",
+				"plan_id":    "async-plan",
+			})
+
+			Expect(writer.Code).To(Equal(http.StatusAccepted))
+		})
+
+		It("returns a 422 AsyncRequired when the update does not change the async-only plan", func() {
+			writer := update("/v2/service_instances/some-guid", map[string]interface{}{
+				"service_id": "my-service-id",
+				"parameters": map[string]interface{}{"size": "large"},
+				"previous_values": map[string]interface{}{
+					"plan_id": "async-plan",
+				},
+			})
+
+			Expect(writer.Code).To(Equal(http.StatusUnprocessableEntity))
+			Expect(writer.Body.String()).To(MatchJSON(`{
+				"error": "AsyncRequired",
+				"description": "plan \"async-plan\" can only be updated asynchronously"
+			}`))
+			Expect(updater.WasCalled).To(BeFalse())
+		})
+	})
+
+	Context("when the plan is declared synchronous-only", func() {
+		BeforeEach(func() {
+			handler.Cataloger = StaticCataloger{domain.Catalog{
+				Services: []domain.Service{
+					{
+						ID:    "my-service-id",
+						Plans: []domain.Plan{{ID: "my-new-plan-id", SyncOnly: true}},
+					},
+				},
+			}}
+			updater.IsAsync = true
+			updater.OperationData = "some-operation"
+		})
+
+		It("updates synchronously even when the client accepts incomplete operations", func() {
+			writer := update("/v2/service_instances/some-guid?accepts_incomplete=true", map[string]interface{}{
+				"service_id": "my-service-id",
+				"plan_id":    "my-new-plan-id",
+			})
+
+			Expect(writer.Code).To(Equal(http.StatusOK))
+			Expect(writer.Header()).NotTo(HaveKey("Location"))
+			Expect(writer.Body.String()).To(MatchJSON("{}"))
+			Expect(updater.WasCalledWith.AcceptsIncomplete).To(BeFalse())
+		})
+
+		It("updates synchronously when the update does not change the sync-only plan", func() {
+			writer := update("/v2/service_instances/some-guid?accepts_incomplete=true", map[string]interface{}{
+				"service_id": "my-service-id",
+				"parameters": map[string]interface{}{"size": "large"},
+				"previous_values": map[string]interface{}{
+					"plan_id": "my-new-plan-id",
+				},
+			})
+
+			Expect(writer.Code).To(Equal(http.StatusOK))
+			Expect(writer.Header()).NotTo(HaveKey("Location"))
+			Expect(updater.WasCalledWith.AcceptsIncomplete).To(BeFalse())
+		})
+	})
+
+	Context("when the update only changes the context", func() {
+		contextUpdate := map[string]interface{}{
+			"service_id": "my-service-id",
+			"previous_values": map[string]interface{}{
+				"plan_id": "my-plan-id",
+			},
+			"context": map[string]interface{}{
+				"platform":   "cloudfoundry",
+				"space_name": "renamed-space",
+			},
+		}
+
+		It("passes the context to the updater when the service allows context updates", func() {
+			handler.Cataloger = StaticCataloger{domain.Catalog{
+				Services: []domain.Service{{ID: "my-service-id", AllowContextUpdates: true}},
+			}}
+
+			writer := update("/v2/service_instances/some-guid", contextUpdate)
+
+			Expect(writer.Code).To(Equal(http.StatusOK))
+			Expect(updater.WasCalledWith.Context).To(Equal(map[string]interface{}{
+				"platform":   "cloudfoundry",
+				"space_name": "renamed-space",
+			}))
+			Expect(updater.WasCalledWith.IsContextOnly()).To(BeTrue())
+		})
+
+		It("returns a 422 without calling the updater when the service does not allow context updates", func() {
+			handler.Cataloger = StaticCataloger{domain.Catalog{
+				Services: []domain.Service{{ID: "my-service-id"}},
+			}}
+
+			writer := update("/v2/service_instances/some-guid", contextUpdate)
+
+			Expect(writer.Code).To(Equal(http.StatusUnprocessableEntity))
+			Expect(writer.Body.String()).To(MatchJSON(`{"description": "service \"my-service-id\" does not allow context updates"}`))
+			Expect(updater.WasCalled).To(BeFalse())
+		})
+
+		It("still accepts updates that change parameters along with the context", func() {
+			handler.Cataloger = StaticCataloger{domain.Catalog{
+				Services: []domain.Service{{ID: "my-service-id"}},
+			}}
+
+			writer := update("/v2/service_instances/some-guid", map[string]interface{}{
+				"service_id": "my-service-id",
+				"context":    map[string]interface{}{"platform": "cloudfoundry"},
+				"parameters": map[string]interface{}{"size": "large"},
+			})
+
+			Expect(writer.Code).To(Equal(http.StatusOK))
+			Expect(updater.WasCalledWith.Parameters).To(Equal(map[string]interface{}{"size": "large"}))
+		})
+
+		It("still accepts upgrades that send maintenance_info along with the context", func() {
+			handler.Cataloger = StaticCataloger{domain.Catalog{
+				Services: []domain.Service{{ID: "my-service-id"}},
+			}}
+
+			writer := update("/v2/service_instances/some-guid", map[string]interface{}{
+				"service_id":       "my-service-id",
+				"context":          map[string]interface{}{"platform": "cloudfoundry"},
+				"maintenance_info": map[string]interface{}{"version": "2.0.0"},
+				"previous_values": map[string]interface{}{
+					"plan_id": "my-plan-id",
+				},
+			})
+
+			Expect(writer.Code).To(Equal(http.StatusOK))
+			Expect(updater.WasCalledWith.MaintenanceInfo).To(Equal(&domain.MaintenanceInfo{Version: "2.0.0"}))
+			Expect(updater.WasCalledWith.IsContextOnly()).To(BeFalse())
+		})
+	})
+
+	Context("when the updater requires an asynchronous update", func() {
+		BeforeEach(func() {
+			updater.Error = domain.AsyncRequiredError("this plan can only be updated asynchronously")
+		})
+
+		It("returns a 422 and an AsyncRequired error", func() {
+			writer := update("/v2/service_instances/some-guid", map[string]interface{}{
+				"service_id": "my-service-id",
+				"plan_id":    "my-new-plan-id",
+			})
+
+			Expect(writer.Code).To(Equal(http.StatusUnprocessableEntity))
+			Expect(writer.Body.String()).To(MatchJSON(`{
+				"error": "AsyncRequired",
+				"description": "this plan can only be updated asynchronously"
+			}`))
+		})
+	})
+
+	Context("when a transition validator is provided", func() {
+		BeforeEach(func() {
+			handler.Validator = TransitionValidator{
+				Forbidden: map[string]string{"large-plan": "small-plan"},
+			}
+		})
+
+		It("calls the updater when the transition is allowed", func() {
+			writer := update("/v2/service_instances/some-guid", map[string]interface{}{
+				"service_id": "my-service-id",
+				"plan_id":    "large-plan",
+				"previous_values": map[string]interface{}{
+					"plan_id": "small-plan",
+				},
+			})
+
+			Expect(writer.Code).To(Equal(http.StatusOK))
+			Expect(updater.WasCalled).To(BeTrue())
+		})
+
+		It("returns a 422 with the validation message when the transition is forbidden", func() {
+			writer := update("/v2/service_instances/some-guid", map[string]interface{}{
+				"service_id": "my-service-id",
+				"plan_id":    "small-plan",
+				"previous_values": map[string]interface{}{
+					"plan_id": "large-plan",
+				},
+			})
+
+			Expect(writer.Code).To(Equal(http.StatusUnprocessableEntity))
+			Expect(writer.Body.String()).To(MatchJSON(`{"description":"cannot change plan from large-plan to small-plan"}`))
+			Expect(updater.WasCalled).To(BeFalse())
+		})
+	})
+
+	Context("when the catalog declares whether plans are updateable", func() {
+		BeforeEach(func() {
+			notUpdateable := false
+			handler.Cataloger = StaticCataloger{domain.Catalog{
+				Services: []domain.Service{{
+					ID:             "my-service-id",
+					PlanUpdateable: true,
+					Plans: []domain.Plan{
+						{ID: "small-plan"},
+						{ID: "fixed-plan", PlanUpdateable: &notUpdateable},
+					},
+				}},
+			}}
+		})
+
+		It("allows changing from a plan that inherits plan_updateable from the service", func() {
+			writer := update("/v2/service_instances/some-guid", map[string]interface{}{
+				"service_id": "my-service-id",
+				"plan_id":    "fixed-plan",
+				"previous_values": map[string]interface{}{
+					"plan_id": "small-plan",
+				},
+			})
+
+			Expect(writer.Code).To(Equal(http.StatusOK))
+			Expect(updater.WasCalled).To(BeTrue())
+		})
+
+		It("returns a 422 when changing from a plan that overrides plan_updateable", func() {
+			writer := update("/v2/service_instances/some-guid", map[string]interface{}{
+				"service_id": "my-service-id",
+				"plan_id":    "small-plan",
+				"previous_values": map[string]interface{}{
+					"plan_id": "fixed-plan",
+				},
+			})
+
+			Expect(writer.Code).To(Equal(http.StatusUnprocessableEntity))
+			Expect(writer.Body.String()).To(MatchJSON(`{"description":"plan \"fixed-plan\" of service \"my-service-id\" cannot be updated to a different plan"}`))
+			Expect(updater.WasCalled).To(BeFalse())
+		})
+	})
+
+	Context("when the updater fails", func() {
+		It("returns a 500 and the error as the body", func() {
+			updater.Error = errors.New("BANG!")
+
+			writer := update("/v2/service_instances/some-guid", map[string]interface{}{
+				"service_id": "my-service-id",
+			})
+
+			Expect(writer.Code).To(Equal(http.StatusInternalServerError))
+			Expect(writer.Body.String()).To(MatchJSON(`{"description":"BANG!"}`))
+		})
+	})
+
+	Context("when the request body is missing the service_id field", func() {
+		It("returns a 400 and does not call the updater", func() {
+			writer := update("/v2/service_instances/some-guid", map[string]interface{}{
+				"plan_id": "my-new-plan-id",
+			})
+
+			Expect(writer.Code).To(Equal(http.StatusBadRequest))
+			Expect(writer.Body.String()).To(MatchJSON(`{"description":"missing required field"}`))
+			Expect(updater.WasCalled).To(BeFalse())
+		})
+	})
+})
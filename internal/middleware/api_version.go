@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type APIVersion struct {
+	Handler http.Handler
+	minimum string
+	maximum string
+}
+
+func NewAPIVersion(handler http.Handler, minimum, maximum string) http.Handler {
+	return APIVersion{
+		Handler: handler,
+		minimum: minimum,
+		maximum: maximum,
+	}
+}
+
+func (v APIVersion) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	requested := req.Header.Get("X-Broker-API-Version")
+	if requested == "" {
+		fail(w, http.StatusPreconditionFailed, fmt.Sprintf("X-Broker-API-Version header is required; this broker supports %s", v.Supported()))
+		return
+	}
+
+	if !v.Accepts(requested) {
+		fail(w, http.StatusPreconditionFailed, fmt.Sprintf("requested %s but this broker supports %s", requested, v.Supported()))
+		return
+	}
+
+	v.Handler.ServeHTTP(w, req)
+}
+
+func (v APIVersion) Accepts(requested string) bool {
+	version, ok := parseVersion(requested)
+	if !ok {
+		return false
+	}
+
+	minimum, ok := parseVersion(v.minimum)
+	if ok && version.lessThan(minimum) {
+		return false
+	}
+
+	maximum, ok := parseVersion(v.maximum)
+	if ok && maximum.lessThan(version) {
+		return false
+	}
+
+	return true
+}
+
+func (v APIVersion) Supported() string {
+	switch {
+	case v.minimum == v.maximum:
+		return v.minimum
+	case v.maximum == "":
+		return fmt.Sprintf("%s or later", v.minimum)
+	case v.minimum == "":
+		return fmt.Sprintf("up to %s", v.maximum)
+	}
+
+	return fmt.Sprintf("%s-%s", v.minimum, v.maximum)
+}
+
+type version struct {
+	major int
+	minor int
+}
+
+func parseVersion(value string) (version, bool) {
+	parts := strings.Split(value, ".")
+	if len(parts) != 2 {
+		return version{}, false
+	}
+
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return version{}, false
+	}
+
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return version{}, false
+	}
+
+	return version{major, minor}, true
+}
+
+func (v version) lessThan(other version) bool {
+	if v.major != other.major {
+		return v.major < other.major
+	}
+
+	return v.minor < other.minor
+}
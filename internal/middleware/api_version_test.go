@@ -0,0 +1,91 @@
+package middleware_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/pivotal-cf-experimental/envoy/internal/middleware"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("APIVersion", func() {
+	Describe("ServeHTTP", func() {
+		var wasCalled bool
+		var apiVersion http.Handler
+		var writer *httptest.ResponseRecorder
+		var request *http.Request
+
+		BeforeEach(func() {
+			var err error
+			wasCalled = false
+			handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				wasCalled = true
+				w.WriteHeader(http.StatusTeapot)
+			})
+			apiVersion = middleware.NewAPIVersion(handler, "2.13", "2.16")
+
+			writer = httptest.NewRecorder()
+			request, err = http.NewRequest("GET", "/v2/catalog", nil)
+			if err != nil {
+				panic(err)
+			}
+		})
+
+		It("delegates to handler when the requested version is supported", func() {
+			request.Header.Set("X-Broker-API-Version", "2.14")
+
+			apiVersion.ServeHTTP(writer, request)
+
+			Expect(wasCalled).To(BeTrue())
+			Expect(writer.Code).To(Equal(http.StatusTeapot))
+		})
+
+		It("accepts the bounds of the supported range", func() {
+			for _, requested := range []string{"2.13", "2.16"} {
+				request.Header.Set("X-Broker-API-Version", requested)
+				writer = httptest.NewRecorder()
+
+				apiVersion.ServeHTTP(writer, request)
+
+				Expect(writer.Code).To(Equal(http.StatusTeapot))
+			}
+		})
+
+		It("returns a 412 describing the requested and supported versions when the version is too old", func() {
+			request.Header.Set("X-Broker-API-Version", "2.10")
+
+			apiVersion.ServeHTTP(writer, request)
+
+			Expect(wasCalled).To(BeFalse())
+			Expect(writer.Code).To(Equal(http.StatusPreconditionFailed))
+			Expect(writer.Header()["Content-Type"]).To(Equal([]string{"application/json"}))
+
+			var msg struct {
+				Description string `json:"description"`
+			}
+			Expect(json.Unmarshal(writer.Body.Bytes(), &msg)).To(Succeed())
+			Expect(msg.Description).To(Equal("requested 2.10 but this broker supports 2.13-2.16"))
+		})
+
+		It("returns a 412 when the version is too new", func() {
+			request.Header.Set("X-Broker-API-Version", "3.0")
+
+			apiVersion.ServeHTTP(writer, request)
+
+			Expect(wasCalled).To(BeFalse())
+			Expect(writer.Code).To(Equal(http.StatusPreconditionFailed))
+			Expect(writer.Body.String()).To(ContainSubstring("requested 3.0"))
+		})
+
+		It("returns a 412 when the version header is missing", func() {
+			apiVersion.ServeHTTP(writer, request)
+
+			Expect(wasCalled).To(BeFalse())
+			Expect(writer.Code).To(Equal(http.StatusPreconditionFailed))
+			Expect(writer.Body.String()).To(ContainSubstring("2.13-2.16"))
+		})
+	})
+})
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pivotal-cf-experimental/envoy/domain"
+)
+
+type AuditLogger interface {
+	Audit(domain.AuditRecord) error
+}
+
+// Auditor writes an audit record before and after each request that it
+// serves. If the record cannot be written before the request, the request
+// is rejected rather than being served without an audit trail.
+type Auditor struct {
+	Handler     http.Handler
+	operation   string
+	auditLogger AuditLogger
+}
+
+func NewAuditor(handler http.Handler, operation string, auditLogger AuditLogger) http.Handler {
+	return Auditor{
+		Handler:     handler,
+		operation:   operation,
+		auditLogger: auditLogger,
+	}
+}
+
+func (a Auditor) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	record := domain.AuditRecord{
+		Time:      time.Now(),
+		Phase:     domain.AuditPhaseBefore,
+		Operation: a.operation,
+		Method:    req.Method,
+		Path:      req.URL.Path,
+		RequestID: RequestIdentityFromContext(req.Context()),
+	}
+
+	if err := a.auditLogger.Audit(record); err != nil {
+		fail(w, http.StatusInternalServerError, "unable to write audit record")
+		return
+	}
+
+	recorder := &statusRecorder{
+		ResponseWriter: w,
+		status:         http.StatusOK,
+	}
+
+	a.Handler.ServeHTTP(recorder, req)
+
+	record.Time = time.Now()
+	record.Phase = domain.AuditPhaseAfter
+	record.Status = recorder.status
+	a.auditLogger.Audit(record)
+}
@@ -0,0 +1,97 @@
+package middleware_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/pivotal-cf-experimental/envoy/domain"
+	"github.com/pivotal-cf-experimental/envoy/internal/middleware"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type AuditLogger struct {
+	Records []domain.AuditRecord
+	Error   error
+}
+
+func (l *AuditLogger) Audit(record domain.AuditRecord) error {
+	if l.Error != nil {
+		return l.Error
+	}
+
+	l.Records = append(l.Records, record)
+	return nil
+}
+
+var _ = Describe("Auditor", func() {
+	Describe("ServeHTTP", func() {
+		var wasCalled bool
+		var auditLogger *AuditLogger
+		var handler http.Handler
+		var writer *httptest.ResponseRecorder
+		var request *http.Request
+
+		BeforeEach(func() {
+			var err error
+			wasCalled = false
+			auditLogger = &AuditLogger{}
+			handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				wasCalled = true
+				Expect(auditLogger.Records).To(HaveLen(1))
+				w.WriteHeader(http.StatusCreated)
+			})
+
+			writer = httptest.NewRecorder()
+			request, err = http.NewRequest("PUT", "/v2/service_instances/instance-id/service_bindings/binding-id", nil)
+			if err != nil {
+				panic(err)
+			}
+		})
+
+		It("writes audit records before and after a bind", func() {
+			middleware.NewAuditor(handler, "bind", auditLogger).ServeHTTP(writer, request)
+
+			Expect(wasCalled).To(BeTrue())
+			Expect(writer.Code).To(Equal(http.StatusCreated))
+			Expect(auditLogger.Records).To(HaveLen(2))
+
+			before, after := auditLogger.Records[0], auditLogger.Records[1]
+			Expect(before.Phase).To(Equal(domain.AuditPhaseBefore))
+			Expect(before.Operation).To(Equal("bind"))
+			Expect(before.Method).To(Equal("PUT"))
+			Expect(before.Path).To(Equal("/v2/service_instances/instance-id/service_bindings/binding-id"))
+			Expect(before.Status).To(BeZero())
+
+			Expect(after.Phase).To(Equal(domain.AuditPhaseAfter))
+			Expect(after.Operation).To(Equal("bind"))
+			Expect(after.Status).To(Equal(http.StatusCreated))
+			Expect(after.Time).NotTo(BeTemporally("<", before.Time))
+		})
+
+		It("includes the request identity when there is one", func() {
+			request.Header.Set(middleware.RequestIdentityHeader, "request-1")
+
+			middleware.NewRequestIdentity(middleware.NewAuditor(handler, "bind", auditLogger)).ServeHTTP(writer, request)
+
+			Expect(auditLogger.Records[0].RequestID).To(Equal("request-1"))
+			Expect(auditLogger.Records[1].RequestID).To(Equal("request-1"))
+		})
+
+		Context("when the audit record cannot be written", func() {
+			BeforeEach(func() {
+				auditLogger.Error = errors.New("disk full")
+			})
+
+			It("rejects the request without serving it", func() {
+				middleware.NewAuditor(handler, "bind", auditLogger).ServeHTTP(writer, request)
+
+				Expect(wasCalled).To(BeFalse())
+				Expect(writer.Code).To(Equal(http.StatusInternalServerError))
+				Expect(writer.Body.String()).To(MatchJSON(`{"description":"unable to write audit record"}`))
+			})
+		})
+	})
+})
@@ -1,25 +1,95 @@
 package middleware
 
 import (
+	"bytes"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
 	"net/http"
 	"regexp"
 	"strings"
+	"time"
+)
+
+// serviceLookupLimit is the largest request body that is read to find the
+// service that a request is for.
+const serviceLookupLimit = 1 << 20
+
+var (
+	errServiceLookupTooLarge = errors.New("request body is too large")
+	errServiceLookupTimeout  = errors.New("timed out reading request body")
+	errDuplicateServiceID    = errors.New("query parameter 'service_id' must not be given more than once")
+	errServiceIDMismatch     = errors.New("query parameter 'service_id' does not match the service_id in the request body")
 )
 
 type Credentialer interface {
 	Credentials() (string, string)
 }
 
+// CredentialsProvider looks up a set of Basic Auth credentials each time a
+// request is authenticated, and may fail to find them.
+type CredentialsProvider interface {
+	ProvideCredentials() (string, string, error)
+}
+
+// ProvidedCredentials returns a Credentialer for the credentials looked up
+// by the given provider. While the provider returns an error, no request is
+// authorized by these credentials.
+func ProvidedCredentials(provider CredentialsProvider) Credentialer {
+	return providedCredentialer{provider: provider}
+}
+
+type providedCredentialer struct {
+	provider CredentialsProvider
+}
+
+func (c providedCredentialer) Credentials() (string, string) {
+	username, password, _ := c.provider.ProvideCredentials()
+	return username, password
+}
+
 type Authenticator struct {
-	Handler      http.Handler
-	credentialer Credentialer
+	Handler              http.Handler
+	credentialers        []Credentialer
+	serviceCredentialers map[string][]Credentialer
+	anyCredentialers     []Credentialer
+	bodyReadTimeout      time.Duration
+}
+
+func NewAuthenticator(handler http.Handler, credentialers ...Credentialer) http.Handler {
+	return Authenticator{
+		Handler:       handler,
+		credentialers: credentialers,
+	}
 }
 
-func NewAuthenticator(handler http.Handler, credentialer Credentialer) http.Handler {
+// NewServiceAuthenticator returns an Authenticator that checks requests
+// for a service with registered credentials against only those
+// credentials. The service is found the same way the handlers find it:
+// from the service_id field of the body of a PUT or PATCH request, and
+// otherwise from the service_id query parameter, falling back to the body
+// when there is none. Requests that give the service_id more than once in
+// the query, or that give a different service_id in the query than in
+// the body of a PUT or PATCH, are rejected with a 400 Bad Request, so that
+// the credentials of one service cannot be used to act on another.
+// Requests for any other service, or for no service at all, are checked
+// against the default credentials. The body is only read once the credentials are
+// known to match one of the sets of credentials, so that unauthenticated
+// clients cannot make the broker read their bodies. It is read up to a
+// limit and, when the timeout is positive, within the timeout.
+func NewServiceAuthenticator(handler http.Handler, serviceCredentialers map[string][]Credentialer, bodyReadTimeout time.Duration, credentialers ...Credentialer) http.Handler {
+	anyCredentialers := append([]Credentialer{}, credentialers...)
+	for _, serviceCredentialers := range serviceCredentialers {
+		anyCredentialers = append(anyCredentialers, serviceCredentialers...)
+	}
+
 	return Authenticator{
-		Handler:      handler,
-		credentialer: credentialer,
+		Handler:              handler,
+		credentialers:        credentialers,
+		serviceCredentialers: serviceCredentialers,
+		anyCredentialers:     anyCredentialers,
+		bodyReadTimeout:      bodyReadTimeout,
 	}
 }
 
@@ -45,8 +115,32 @@ func (a Authenticator) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	username, password := a.credentialer.Credentials()
-	if username != auth[0] || password != auth[1] {
+	credentialers := a.credentialers
+	if len(a.serviceCredentialers) > 0 {
+		if !authorized(a.anyCredentialers, auth[0], auth[1]) {
+			a.Fail(w)
+			return
+		}
+
+		serviceID, err := a.serviceID(w, req)
+		if err != nil {
+			switch err {
+			case errServiceLookupTooLarge:
+				fail(w, http.StatusRequestEntityTooLarge, err.Error())
+			case errServiceLookupTimeout:
+				fail(w, http.StatusRequestTimeout, err.Error())
+			default:
+				fail(w, http.StatusBadRequest, err.Error())
+			}
+			return
+		}
+
+		if serviceCredentialers, ok := a.serviceCredentialers[serviceID]; ok {
+			credentialers = serviceCredentialers
+		}
+	}
+
+	if !authorized(credentialers, auth[0], auth[1]) {
 		a.Fail(w)
 		return
 	}
@@ -54,6 +148,125 @@ func (a Authenticator) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	a.Handler.ServeHTTP(w, req)
 }
 
+func (a Authenticator) Authorized(username, password string) bool {
+	return authorized(a.credentialers, username, password)
+}
+
+func authorized(credentialers []Credentialer, username, password string) bool {
+	for _, credentialer := range credentialers {
+		expectedUsername, expectedPassword, ok := credentialsOf(credentialer)
+		if ok && username == expectedUsername && password == expectedPassword {
+			return true
+		}
+	}
+
+	return false
+}
+
+func credentialsOf(credentialer Credentialer) (string, string, bool) {
+	if provided, ok := credentialer.(providedCredentialer); ok {
+		username, password, err := provided.provider.ProvideCredentials()
+		return username, password, err == nil
+	}
+
+	username, password := credentialer.Credentials()
+	return username, password, true
+}
+
 func (a Authenticator) Fail(w http.ResponseWriter) {
 	w.WriteHeader(http.StatusUnauthorized)
 }
+
+// serviceID finds the service that a request is for, in the same place
+// that the handler for the request will. The body of a PUT or PATCH is
+// always read, since their handlers take the service from the body. For
+// other requests, the body is only read when the query string does not
+// name the service. The body is replaced so that it can still be read by
+// the handler.
+func (a Authenticator) serviceID(w http.ResponseWriter, req *http.Request) (string, error) {
+	queryIDs := req.URL.Query()["service_id"]
+	if len(queryIDs) > 1 {
+		return "", errDuplicateServiceID
+	}
+
+	switch req.Method {
+	case http.MethodPut, http.MethodPatch:
+		bodyID, err := a.bodyServiceID(w, req)
+		if err != nil {
+			return "", err
+		}
+
+		if len(queryIDs) == 1 && queryIDs[0] != bodyID {
+			return "", errServiceIDMismatch
+		}
+
+		return bodyID, nil
+	}
+
+	if len(queryIDs) == 1 {
+		return queryIDs[0], nil
+	}
+
+	return a.bodyServiceID(w, req)
+}
+
+func (a Authenticator) bodyServiceID(w http.ResponseWriter, req *http.Request) (string, error) {
+	if req.Body == nil {
+		return "", nil
+	}
+
+	body, err := readLimitedBody(w, req, a.bodyReadTimeout)
+	if err != nil {
+		return "", err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	var params struct {
+		ServiceID string `json:"service_id"`
+	}
+	json.Unmarshal(body, &params)
+
+	return params.ServiceID, nil
+}
+
+// readLimitedBody reads the request body, failing with
+// errServiceLookupTooLarge once it exceeds serviceLookupLimit, or with
+// errServiceLookupTimeout when the timeout is positive and the body has
+// not been read before it expires. When the timeout expires, the read is
+// interrupted by setting a read deadline in the past on the connection and
+// closing the body, and readLimitedBody waits for it to stop.
+func readLimitedBody(w http.ResponseWriter, req *http.Request, timeout time.Duration) ([]byte, error) {
+	reader := http.MaxBytesReader(w, req.Body, serviceLookupLimit)
+	read := func() ([]byte, error) {
+		body, err := ioutil.ReadAll(reader)
+		if err != nil && len(body) >= serviceLookupLimit {
+			return nil, errServiceLookupTooLarge
+		}
+
+		return body, err
+	}
+
+	if timeout <= 0 {
+		return read()
+	}
+
+	type result struct {
+		body []byte
+		err  error
+	}
+	results := make(chan result, 1)
+	go func() {
+		body, err := read()
+		results <- result{body, err}
+	}()
+
+	select {
+	case r := <-results:
+		return r.body, r.err
+	case <-time.After(timeout):
+		http.NewResponseController(w).SetReadDeadline(time.Now())
+		req.Body.Close()
+		<-results
+		return nil, errServiceLookupTimeout
+	}
+}
@@ -1,8 +1,13 @@
 package middleware_test
 
 import (
+	"errors"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"time"
 
 	"github.com/pivotal-cf-experimental/envoy/internal/middleware"
 
@@ -10,14 +15,43 @@ import (
 	. "github.com/onsi/gomega"
 )
 
-type Credentialer struct{}
+type Credentialer struct {
+	Username string
+	Password string
+}
 
 func NewCredentialer() *Credentialer {
-	return &Credentialer{}
+	return &Credentialer{
+		Username: "username",
+		Password: "password",
+	}
 }
 
 func (c Credentialer) Credentials() (string, string) {
-	return "username", "password"
+	return c.Username, c.Password
+}
+
+type CredentialsProvider struct {
+	Error error
+}
+
+func (p CredentialsProvider) ProvideCredentials() (string, string, error) {
+	return "provided-username", "provided-password", p.Error
+}
+
+// countingReader is an endless request body that counts how much of it has
+// been read.
+type countingReader struct {
+	read int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = ' '
+	}
+	r.read += len(p)
+
+	return len(p), nil
 }
 
 var _ = Describe("Authenticator", func() {
@@ -59,5 +93,261 @@ var _ = Describe("Authenticator", func() {
 			Expect(wasCalled).To(BeFalse())
 			Expect(writer.Code).To(Equal(http.StatusUnauthorized))
 		})
+
+		Context("when configured with more than one set of credentials", func() {
+			BeforeEach(func() {
+				handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+					wasCalled = true
+					w.WriteHeader(http.StatusTeapot)
+				})
+				readOnlyCredentialer := &Credentialer{
+					Username: "reader",
+					Password: "read-only",
+				}
+				authenticator = middleware.NewAuthenticator(handler, NewCredentialer(), readOnlyCredentialer)
+			})
+
+			It("delegates to handler when any of the credentials are valid", func() {
+				request.SetBasicAuth("reader", "read-only")
+
+				authenticator.ServeHTTP(writer, request)
+
+				Expect(wasCalled).To(BeTrue())
+				Expect(writer.Code).To(Equal(http.StatusTeapot))
+			})
+
+			It("returns a 401 when the credentials are mixed between sets", func() {
+				request.SetBasicAuth("reader", "password")
+
+				authenticator.ServeHTTP(writer, request)
+
+				Expect(wasCalled).To(BeFalse())
+				Expect(writer.Code).To(Equal(http.StatusUnauthorized))
+			})
+		})
+
+		Context("when configured with a credentials provider", func() {
+			var provider *CredentialsProvider
+
+			BeforeEach(func() {
+				handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+					wasCalled = true
+					w.WriteHeader(http.StatusTeapot)
+				})
+				provider = &CredentialsProvider{}
+				authenticator = middleware.NewAuthenticator(handler, middleware.ProvidedCredentials(provider))
+			})
+
+			It("delegates to handler when the provided credentials are valid", func() {
+				request.SetBasicAuth("provided-username", "provided-password")
+
+				authenticator.ServeHTTP(writer, request)
+
+				Expect(wasCalled).To(BeTrue())
+				Expect(writer.Code).To(Equal(http.StatusTeapot))
+			})
+
+			It("returns a 401 when the provider fails, even if the credentials match", func() {
+				provider.Error = errors.New("secret store unavailable")
+				request.SetBasicAuth("provided-username", "provided-password")
+
+				authenticator.ServeHTTP(writer, request)
+
+				Expect(wasCalled).To(BeFalse())
+				Expect(writer.Code).To(Equal(http.StatusUnauthorized))
+			})
+		})
+
+		Context("when configured with credentials for individual services", func() {
+			var body []byte
+
+			BeforeEach(func() {
+				handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+					wasCalled = true
+
+					if req.Body != nil {
+						var err error
+						body, err = ioutil.ReadAll(req.Body)
+						if err != nil {
+							panic(err)
+						}
+					}
+
+					w.WriteHeader(http.StatusTeapot)
+				})
+				authenticator = middleware.NewServiceAuthenticator(handler, map[string][]middleware.Credentialer{
+					"service-a": {&Credentialer{Username: "user-a", Password: "password-a"}},
+					"service-b": {&Credentialer{Username: "user-b", Password: "password-b"}},
+				}, time.Second, NewCredentialer())
+			})
+
+			It("checks the service_id query parameter against the credentials for that service", func() {
+				request, err := http.NewRequest("DELETE", "/foo?service_id=service-a", nil)
+				if err != nil {
+					panic(err)
+				}
+				request.SetBasicAuth("user-a", "password-a")
+
+				authenticator.ServeHTTP(writer, request)
+
+				Expect(wasCalled).To(BeTrue())
+				Expect(writer.Code).To(Equal(http.StatusTeapot))
+			})
+
+			It("checks the service_id in the body, leaving the body readable by the handler", func() {
+				request, err := http.NewRequest("PUT", "/foo", strings.NewReader(`{"service_id":"service-b"}`))
+				if err != nil {
+					panic(err)
+				}
+				request.SetBasicAuth("user-b", "password-b")
+
+				authenticator.ServeHTTP(writer, request)
+
+				Expect(wasCalled).To(BeTrue())
+				Expect(writer.Code).To(Equal(http.StatusTeapot))
+				Expect(body).To(MatchJSON(`{"service_id":"service-b"}`))
+			})
+
+			It("takes the service of a PUT from the body, not the query", func() {
+				request, err := http.NewRequest("PUT", "/foo", strings.NewReader(`{"service_id":"service-b"}`))
+				if err != nil {
+					panic(err)
+				}
+				request.SetBasicAuth("user-a", "password-a")
+
+				authenticator.ServeHTTP(writer, request)
+
+				Expect(wasCalled).To(BeFalse())
+				Expect(writer.Code).To(Equal(http.StatusUnauthorized))
+			})
+
+			It("returns a 400 when the query and the body of a PUT name different services", func() {
+				request, err := http.NewRequest("PUT", "/foo?service_id=service-a", strings.NewReader(`{"service_id":"service-b"}`))
+				if err != nil {
+					panic(err)
+				}
+				request.SetBasicAuth("user-a", "password-a")
+
+				authenticator.ServeHTTP(writer, request)
+
+				Expect(wasCalled).To(BeFalse())
+				Expect(writer.Code).To(Equal(http.StatusBadRequest))
+				Expect(writer.Body.String()).To(MatchJSON(`{"description":"query parameter 'service_id' does not match the service_id in the request body"}`))
+			})
+
+			It("accepts a PUT whose query and body name the same service", func() {
+				request, err := http.NewRequest("PUT", "/foo?service_id=service-b", strings.NewReader(`{"service_id":"service-b"}`))
+				if err != nil {
+					panic(err)
+				}
+				request.SetBasicAuth("user-b", "password-b")
+
+				authenticator.ServeHTTP(writer, request)
+
+				Expect(wasCalled).To(BeTrue())
+				Expect(body).To(MatchJSON(`{"service_id":"service-b"}`))
+			})
+
+			It("returns a 400 when the service_id query parameter is given more than once", func() {
+				request, err := http.NewRequest("DELETE", "/foo?service_id=service-a&service_id=service-b", nil)
+				if err != nil {
+					panic(err)
+				}
+				request.SetBasicAuth("user-a", "password-a")
+
+				authenticator.ServeHTTP(writer, request)
+
+				Expect(wasCalled).To(BeFalse())
+				Expect(writer.Code).To(Equal(http.StatusBadRequest))
+				Expect(writer.Body.String()).To(MatchJSON(`{"description":"query parameter 'service_id' must not be given more than once"}`))
+			})
+
+			It("returns a 401 when the credentials belong to a different service", func() {
+				request, err := http.NewRequest("DELETE", "/foo?service_id=service-a", nil)
+				if err != nil {
+					panic(err)
+				}
+				request.SetBasicAuth("user-b", "password-b")
+
+				authenticator.ServeHTTP(writer, request)
+
+				Expect(wasCalled).To(BeFalse())
+				Expect(writer.Code).To(Equal(http.StatusUnauthorized))
+			})
+
+			It("returns a 401 when the default credentials are used for a service with its own credentials", func() {
+				request, err := http.NewRequest("DELETE", "/foo?service_id=service-a", nil)
+				if err != nil {
+					panic(err)
+				}
+				request.SetBasicAuth("username", "password")
+
+				authenticator.ServeHTTP(writer, request)
+
+				Expect(wasCalled).To(BeFalse())
+				Expect(writer.Code).To(Equal(http.StatusUnauthorized))
+			})
+
+			It("uses the default credentials for requests without a registered service", func() {
+				request.SetBasicAuth("username", "password")
+
+				authenticator.ServeHTTP(writer, request)
+
+				Expect(wasCalled).To(BeTrue())
+				Expect(writer.Code).To(Equal(http.StatusTeapot))
+			})
+
+			It("returns a 401 without reading the body when the credentials match no service", func() {
+				body := &countingReader{}
+				request, err := http.NewRequest("PUT", "/foo", body)
+				if err != nil {
+					panic(err)
+				}
+				request.SetBasicAuth("user-a", "wrong-password")
+
+				authenticator.ServeHTTP(writer, request)
+
+				Expect(wasCalled).To(BeFalse())
+				Expect(writer.Code).To(Equal(http.StatusUnauthorized))
+				Expect(body.read).To(BeZero())
+			})
+
+			It("returns a 413 when the body is too large to find the service", func() {
+				body := &countingReader{}
+				request, err := http.NewRequest("PUT", "/foo", body)
+				if err != nil {
+					panic(err)
+				}
+				request.SetBasicAuth("user-a", "password-a")
+
+				authenticator.ServeHTTP(writer, request)
+
+				Expect(wasCalled).To(BeFalse())
+				Expect(writer.Code).To(Equal(http.StatusRequestEntityTooLarge))
+				Expect(body.read).To(BeNumerically("<=", 2<<20))
+			})
+
+			It("returns a 408 when the body is not read before the timeout", func() {
+				authenticator = middleware.NewServiceAuthenticator(http.NotFoundHandler(), map[string][]middleware.Credentialer{
+					"service-a": {&Credentialer{Username: "user-a", Password: "password-a"}},
+				}, time.Millisecond, NewCredentialer())
+
+				body, bodyWriter := io.Pipe()
+				defer bodyWriter.Close()
+
+				request, err := http.NewRequest("PUT", "/foo", body)
+				if err != nil {
+					panic(err)
+				}
+				request.SetBasicAuth("user-a", "password-a")
+
+				authenticator.ServeHTTP(writer, request)
+
+				Expect(writer.Code).To(Equal(http.StatusRequestTimeout))
+
+				_, err = bodyWriter.Write([]byte(`{}`))
+				Expect(err).To(Equal(io.ErrClosedPipe))
+			})
+		})
 	})
 })
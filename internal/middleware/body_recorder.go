@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pivotal-cf-experimental/envoy/domain"
+)
+
+// RedactedValue replaces the values of secrets in recorded bodies.
+const RedactedValue = "[REDACTED]"
+
+type exchangeRecorder interface {
+	Record(domain.RecordedExchange)
+}
+
+// BodyRecorder records each request and the response to it, including
+// their bodies, for troubleshooting. Bodies that are JSON are recorded
+// with the credentials of bindings, and any field whose name mentions a
+// password, secret or token, replaced by RedactedValue. Requests to paths
+// under /debug/ are not recorded, so that reading the recordings does not
+// push them out.
+type BodyRecorder struct {
+	Handler  http.Handler
+	recorder exchangeRecorder
+}
+
+func NewBodyRecorder(handler http.Handler, recorder exchangeRecorder) http.Handler {
+	return BodyRecorder{
+		Handler:  handler,
+		recorder: recorder,
+	}
+}
+
+func (b BodyRecorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if strings.HasPrefix(req.URL.Path, "/debug/") {
+		b.Handler.ServeHTTP(w, req)
+		return
+	}
+
+	start := time.Now()
+
+	var requestBody bytes.Buffer
+	if req.Body != nil {
+		req.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.TeeReader(req.Body, &requestBody), req.Body}
+	}
+
+	recorder := &responseRecorder{
+		ResponseWriter: w,
+		status:         http.StatusOK,
+	}
+
+	b.Handler.ServeHTTP(recorder, req)
+
+	b.recorder.Record(domain.RecordedExchange{
+		Time:         start,
+		Method:       req.Method,
+		Path:         req.URL.Path,
+		Status:       recorder.status,
+		RequestBody:  redactBody(requestBody.Bytes()),
+		ResponseBody: redactBody(recorder.body.Bytes()),
+	})
+}
+
+// redactBody returns the body with its secrets redacted. Bodies that are
+// not JSON are returned unchanged.
+func redactBody(body []byte) string {
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return string(body)
+	}
+
+	redacted, err := json.Marshal(redact(value))
+	if err != nil {
+		return string(body)
+	}
+
+	return string(redacted)
+}
+
+func redact(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if isSecret(key) {
+				v[key] = RedactedValue
+			} else {
+				v[key] = redact(field)
+			}
+		}
+	case []interface{}:
+		for i, element := range v {
+			v[i] = redact(element)
+		}
+	}
+
+	return value
+}
+
+func isSecret(key string) bool {
+	key = strings.ToLower(key)
+	if key == "credentials" {
+		return true
+	}
+
+	for _, word := range []string{"password", "secret", "token"} {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,89 @@
+package middleware_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/pivotal-cf-experimental/envoy/domain"
+	"github.com/pivotal-cf-experimental/envoy/internal/middleware"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type ExchangeRecorder struct {
+	Exchanges []domain.RecordedExchange
+}
+
+func (r *ExchangeRecorder) Record(exchange domain.RecordedExchange) {
+	r.Exchanges = append(r.Exchanges, exchange)
+}
+
+var _ = Describe("BodyRecorder", func() {
+	Describe("ServeHTTP", func() {
+		var (
+			recorder    *ExchangeRecorder
+			handler     http.Handler
+			requestBody string
+		)
+
+		serve := func(method, path, body string) *httptest.ResponseRecorder {
+			request, err := http.NewRequest(method, path, strings.NewReader(body))
+			if err != nil {
+				panic(err)
+			}
+
+			writer := httptest.NewRecorder()
+			handler.ServeHTTP(writer, request)
+
+			return writer
+		}
+
+		BeforeEach(func() {
+			recorder = &ExchangeRecorder{}
+			handler = middleware.NewBodyRecorder(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				body, err := ioutil.ReadAll(req.Body)
+				if err != nil {
+					panic(err)
+				}
+				requestBody = string(body)
+
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte(`{"credentials":{"username":"admin","password":"hunter2"},"syslog_drain_url":"syslog://example.com"}`))
+			}), recorder)
+		})
+
+		It("records the request and response, redacting the password in the bind response", func() {
+			writer := serve("PUT", "/v2/service_instances/instance-id/service_bindings/binding-id", `{"service_id":"service-id","parameters":{"admin_password":"letmein","size":"large"}}`)
+
+			Expect(writer.Code).To(Equal(http.StatusCreated))
+			Expect(writer.Body.String()).To(ContainSubstring("hunter2"))
+			Expect(requestBody).To(ContainSubstring("letmein"))
+
+			Expect(recorder.Exchanges).To(HaveLen(1))
+			exchange := recorder.Exchanges[0]
+			Expect(exchange.Method).To(Equal("PUT"))
+			Expect(exchange.Path).To(Equal("/v2/service_instances/instance-id/service_bindings/binding-id"))
+			Expect(exchange.Status).To(Equal(http.StatusCreated))
+			Expect(exchange.Time).NotTo(BeZero())
+
+			Expect(exchange.RequestBody).To(MatchJSON(`{"service_id":"service-id","parameters":{"admin_password":"[REDACTED]","size":"large"}}`))
+			Expect(exchange.ResponseBody).To(MatchJSON(`{"credentials":"[REDACTED]","syslog_drain_url":"syslog://example.com"}`))
+			Expect(exchange.ResponseBody).NotTo(ContainSubstring("hunter2"))
+		})
+
+		It("records bodies that are not JSON unchanged", func() {
+			serve("PUT", "/v2/service_instances/instance-id", "not json")
+
+			Expect(recorder.Exchanges[0].RequestBody).To(Equal("not json"))
+		})
+
+		It("does not record requests to debug endpoints", func() {
+			serve("GET", "/debug/exchanges", "")
+
+			Expect(recorder.Exchanges).To(BeEmpty())
+		})
+	})
+})
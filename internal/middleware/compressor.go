@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type Encoder func(io.Writer) io.WriteCloser
+
+type Encoding struct {
+	Name    string
+	Encoder Encoder
+}
+
+var GzipEncoding = Encoding{
+	Name: "gzip",
+	Encoder: func(w io.Writer) io.WriteCloser {
+		return gzip.NewWriter(w)
+	},
+}
+
+type Compressor struct {
+	Handler   http.Handler
+	encodings []Encoding
+}
+
+// NewCompressor returns a handler that compresses responses using the first
+// of the given encodings, in order of preference, that the client accepts.
+func NewCompressor(handler http.Handler, encodings ...Encoding) http.Handler {
+	return Compressor{
+		Handler:   handler,
+		encodings: encodings,
+	}
+}
+
+func (c Compressor) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	encoding, ok := c.Negotiate(req.Header.Get("Accept-Encoding"))
+	if !ok {
+		c.Handler.ServeHTTP(w, req)
+		return
+	}
+
+	w.Header().Set("Content-Encoding", encoding.Name)
+	writer := encoding.Encoder(w)
+	defer writer.Close()
+
+	c.Handler.ServeHTTP(compressedResponseWriter{
+		ResponseWriter: w,
+		writer:         writer,
+	}, req)
+}
+
+func (c Compressor) Negotiate(acceptEncoding string) (Encoding, bool) {
+	accepted := map[string]bool{}
+	for _, value := range strings.Split(acceptEncoding, ",") {
+		parts := strings.Split(value, ";")
+		name := strings.ToLower(strings.TrimSpace(parts[0]))
+		if name == "" {
+			continue
+		}
+
+		accepted[name] = true
+		for _, parameter := range parts[1:] {
+			parameter = strings.TrimSpace(parameter)
+			if !strings.HasPrefix(parameter, "q=") {
+				continue
+			}
+
+			quality, err := strconv.ParseFloat(strings.TrimPrefix(parameter, "q="), 64)
+			if err == nil && quality == 0 {
+				accepted[name] = false
+			}
+		}
+	}
+
+	for _, encoding := range c.encodings {
+		if accepted[encoding.Name] {
+			return encoding, true
+		}
+	}
+
+	return Encoding{}, false
+}
+
+type compressedResponseWriter struct {
+	http.ResponseWriter
+	writer io.Writer
+}
+
+func (w compressedResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w compressedResponseWriter) WriteHeader(status int) {
+	w.ResponseWriter.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w compressedResponseWriter) Write(body []byte) (int, error) {
+	return w.writer.Write(body)
+}
@@ -0,0 +1,100 @@
+package middleware_test
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/pivotal-cf-experimental/envoy/internal/middleware"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// brEncoding stands in for a Brotli encoder so that negotiation can be
+// tested without depending on a Brotli implementation.
+var brEncoding = middleware.Encoding{
+	Name: "br",
+	Encoder: func(w io.Writer) io.WriteCloser {
+		writer, err := flate.NewWriter(w, flate.DefaultCompression)
+		if err != nil {
+			panic(err)
+		}
+
+		return writer
+	},
+}
+
+var _ = Describe("Compressor", func() {
+	Describe("ServeHTTP", func() {
+		var compressor http.Handler
+		var writer *httptest.ResponseRecorder
+		var request *http.Request
+
+		BeforeEach(func() {
+			var err error
+			handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(`{"services":[]}`))
+			})
+			compressor = middleware.NewCompressor(handler, brEncoding, middleware.GzipEncoding)
+
+			writer = httptest.NewRecorder()
+			request, err = http.NewRequest("GET", "/v2/catalog", nil)
+			if err != nil {
+				panic(err)
+			}
+		})
+
+		It("prefers br when the client advertises it", func() {
+			request.Header.Set("Accept-Encoding", "gzip, deflate, br")
+
+			compressor.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusOK))
+			Expect(writer.Header().Get("Content-Encoding")).To(Equal("br"))
+			Expect(writer.Header().Get("Vary")).To(Equal("Accept-Encoding"))
+
+			body, err := ioutil.ReadAll(flate.NewReader(writer.Body))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(body).To(MatchJSON(`{"services":[]}`))
+		})
+
+		It("falls back to gzip when the client does not advertise br", func() {
+			request.Header.Set("Accept-Encoding", "gzip")
+
+			compressor.ServeHTTP(writer, request)
+
+			Expect(writer.Header().Get("Content-Encoding")).To(Equal("gzip"))
+			Expect(writer.Header().Get("Vary")).To(Equal("Accept-Encoding"))
+
+			reader, err := gzip.NewReader(writer.Body)
+			Expect(err).NotTo(HaveOccurred())
+			body, err := ioutil.ReadAll(reader)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(body).To(MatchJSON(`{"services":[]}`))
+		})
+
+		It("falls back to gzip when the client refuses br", func() {
+			request.Header.Set("Accept-Encoding", "br;q=0, gzip;q=0.8")
+
+			compressor.ServeHTTP(writer, request)
+
+			Expect(writer.Header().Get("Content-Encoding")).To(Equal("gzip"))
+		})
+
+		It("does not compress the response when the client advertises neither", func() {
+			request.Header.Set("Accept-Encoding", "identity")
+
+			compressor.ServeHTTP(writer, request)
+
+			Expect(writer.Header()).NotTo(HaveKey("Content-Encoding"))
+			Expect(writer.Header().Get("Vary")).To(Equal("Accept-Encoding"))
+			Expect(writer.Body.String()).To(MatchJSON(`{"services":[]}`))
+		})
+	})
+})
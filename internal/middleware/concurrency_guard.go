@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/pivotal-cf-experimental/envoy/domain"
+)
+
+type OperationGetter interface {
+	Get(instanceID string) (domain.OperationRecord, error)
+}
+
+var instancePath = regexp.MustCompile(`^/v2/service_instances/([^/]+)`)
+
+// ConcurrencyGuard rejects requests to change a service instance while an
+// asynchronous operation on it is in progress, according to the operation
+// store, with a 422 ConcurrencyError. Once the operation is no longer in
+// progress, requests are served again. Requests for instances without a
+// recorded operation are always served.
+type ConcurrencyGuard struct {
+	Handler    http.Handler
+	operations OperationGetter
+}
+
+func NewConcurrencyGuard(handler http.Handler, operations OperationGetter) http.Handler {
+	return ConcurrencyGuard{
+		Handler:    handler,
+		operations: operations,
+	}
+}
+
+func (g ConcurrencyGuard) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if matches := instancePath.FindStringSubmatch(req.URL.Path); matches != nil {
+		record, err := g.operations.Get(matches[1])
+		if err == nil && record.State == domain.LastOperationInProgress {
+			failWithError(w, http.StatusUnprocessableEntity, "ConcurrencyError",
+				fmt.Sprintf("another operation on service instance %q is in progress", matches[1]))
+			return
+		}
+	}
+
+	g.Handler.ServeHTTP(w, req)
+}
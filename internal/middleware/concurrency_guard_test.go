@@ -0,0 +1,94 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/pivotal-cf-experimental/envoy/domain"
+	"github.com/pivotal-cf-experimental/envoy/internal/middleware"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ConcurrencyGuard", func() {
+	var (
+		calls   int
+		store   *domain.MemoryOperationStore
+		handler http.Handler
+	)
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		request, err := http.NewRequest(method, path, nil)
+		if err != nil {
+			panic(err)
+		}
+
+		writer := httptest.NewRecorder()
+		handler.ServeHTTP(writer, request)
+
+		return writer
+	}
+
+	BeforeEach(func() {
+		calls = 0
+		store = domain.NewMemoryOperationStore()
+		handler = middleware.NewConcurrencyGuard(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusAccepted)
+		}), store)
+	})
+
+	It("serves requests for instances without a recorded operation", func() {
+		writer := serve("PATCH", "/v2/service_instances/instance-id")
+
+		Expect(writer.Code).To(Equal(http.StatusAccepted))
+		Expect(calls).To(Equal(1))
+	})
+
+	Context("when an operation on the instance is in progress", func() {
+		BeforeEach(func() {
+			Expect(store.Create("instance-id", domain.OperationRecord{
+				ID:    "update-1",
+				State: domain.LastOperationInProgress,
+			})).To(Succeed())
+		})
+
+		It("rejects requests to change the instance with a 422 ConcurrencyError", func() {
+			writer := serve("PATCH", "/v2/service_instances/instance-id")
+
+			Expect(writer.Code).To(Equal(http.StatusUnprocessableEntity))
+			Expect(writer.Body.String()).To(MatchJSON(`{
+				"error": "ConcurrencyError",
+				"description": "another operation on service instance \"instance-id\" is in progress"
+			}`))
+			Expect(calls).To(BeZero())
+		})
+
+		It("rejects requests to change bindings of the instance", func() {
+			writer := serve("PUT", "/v2/service_instances/instance-id/service_bindings/binding-id")
+
+			Expect(writer.Code).To(Equal(http.StatusUnprocessableEntity))
+			Expect(calls).To(BeZero())
+		})
+
+		It("serves requests for other instances", func() {
+			writer := serve("DELETE", "/v2/service_instances/other-instance-id")
+
+			Expect(writer.Code).To(Equal(http.StatusAccepted))
+			Expect(calls).To(Equal(1))
+		})
+
+		It("serves requests again once the operation has completed", func() {
+			Expect(store.Update("instance-id", domain.OperationRecord{
+				ID:    "update-1",
+				State: domain.LastOperationSucceeded,
+			})).To(Succeed())
+
+			writer := serve("PATCH", "/v2/service_instances/instance-id")
+
+			Expect(writer.Code).To(Equal(http.StatusAccepted))
+			Expect(calls).To(Equal(1))
+		})
+	})
+})
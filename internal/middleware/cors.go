@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+)
+
+// CORSPolicy describes the cross-origin requests that a CORS handler
+// allows.
+type CORSPolicy struct {
+	// Paths are the request paths that the policy applies to.
+	Paths []string
+
+	// AllowedOrigins are the origins that may make requests. The origin
+	// "*" allows any origin, but only for requests without credentials,
+	// since browsers would otherwise let any page read the responses
+	// using the broker's credentials.
+	AllowedOrigins []string
+
+	// AllowedMethods are the methods that may be used in requests.
+	AllowedMethods []string
+
+	// AllowedHeaders are the request headers that may be sent.
+	AllowedHeaders []string
+}
+
+type CORS struct {
+	Handler http.Handler
+	policy  CORSPolicy
+}
+
+// NewCORS returns a handler that adds the headers allowing cross-origin
+// requests from browsers to the paths of the policy. Preflight requests
+// from allowed origins are answered directly, since browsers send them
+// without credentials. All other requests are passed to the handler, so
+// they must still be authenticated.
+func NewCORS(handler http.Handler, policy CORSPolicy) http.Handler {
+	return CORS{
+		Handler: handler,
+		policy:  policy,
+	}
+}
+
+func (c CORS) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !contains(c.policy.Paths, req.URL.Path) {
+		c.Handler.ServeHTTP(w, req)
+		return
+	}
+
+	w.Header().Add("Vary", "Origin")
+
+	origin := req.Header.Get("Origin")
+	if origin == "" || !c.Allowed(origin) {
+		c.Handler.ServeHTTP(w, req)
+		return
+	}
+
+	if contains(c.policy.AllowedOrigins, origin) {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	} else {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	}
+
+	if req.Method == http.MethodOptions && req.Header.Get("Access-Control-Request-Method") != "" {
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(c.policy.AllowedMethods, ", "))
+		if len(c.policy.AllowedHeaders) > 0 {
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(c.policy.AllowedHeaders, ", "))
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	c.Handler.ServeHTTP(w, req)
+}
+
+func (c CORS) Allowed(origin string) bool {
+	return contains(c.policy.AllowedOrigins, "*") || contains(c.policy.AllowedOrigins, origin)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,117 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/pivotal-cf-experimental/envoy/internal/middleware"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CORS", func() {
+	Describe("ServeHTTP", func() {
+		var wasCalled bool
+		var handler http.Handler
+		var writer *httptest.ResponseRecorder
+
+		BeforeEach(func() {
+			wasCalled = false
+			handler = middleware.NewCORS(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				wasCalled = true
+				w.WriteHeader(http.StatusTeapot)
+			}), middleware.CORSPolicy{
+				Paths:          []string{"/v2/catalog"},
+				AllowedOrigins: []string{"https://dashboard.example.com"},
+				AllowedMethods: []string{"GET"},
+				AllowedHeaders: []string{"Authorization", "X-Broker-API-Version"},
+			})
+
+			writer = httptest.NewRecorder()
+		})
+
+		newRequest := func(method, path, origin string) *http.Request {
+			request, err := http.NewRequest(method, path, nil)
+			if err != nil {
+				panic(err)
+			}
+			if origin != "" {
+				request.Header.Set("Origin", origin)
+			}
+
+			return request
+		}
+
+		It("answers a preflight request from an allowed origin", func() {
+			request := newRequest("OPTIONS", "/v2/catalog", "https://dashboard.example.com")
+			request.Header.Set("Access-Control-Request-Method", "GET")
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(wasCalled).To(BeFalse())
+			Expect(writer.Code).To(Equal(http.StatusNoContent))
+			Expect(writer.Header().Get("Access-Control-Allow-Origin")).To(Equal("https://dashboard.example.com"))
+			Expect(writer.Header().Get("Access-Control-Allow-Methods")).To(Equal("GET"))
+			Expect(writer.Header().Get("Access-Control-Allow-Headers")).To(Equal("Authorization, X-Broker-API-Version"))
+			Expect(writer.Header().Get("Access-Control-Allow-Credentials")).To(Equal("true"))
+		})
+
+		It("adds the allowed origin to an actual request and delegates to the handler", func() {
+			request := newRequest("GET", "/v2/catalog", "https://dashboard.example.com")
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(wasCalled).To(BeTrue())
+			Expect(writer.Code).To(Equal(http.StatusTeapot))
+			Expect(writer.Header().Get("Access-Control-Allow-Origin")).To(Equal("https://dashboard.example.com"))
+			Expect(writer.Header()["Vary"]).To(ContainElement("Origin"))
+		})
+
+		It("does not allow other origins", func() {
+			request := newRequest("OPTIONS", "/v2/catalog", "https://evil.example.com")
+			request.Header.Set("Access-Control-Request-Method", "GET")
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(wasCalled).To(BeTrue())
+			Expect(writer.Header()).NotTo(HaveKey("Access-Control-Allow-Origin"))
+		})
+
+		It("does not apply to other paths", func() {
+			request := newRequest("GET", "/v2/service_instances/some-id", "https://dashboard.example.com")
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(wasCalled).To(BeTrue())
+			Expect(writer.Header()).NotTo(HaveKey("Access-Control-Allow-Origin"))
+			Expect(writer.Header()).NotTo(HaveKey("Vary"))
+		})
+
+		It("allows any origin without credentials when configured with *", func() {
+			handler = middleware.NewCORS(handler, middleware.CORSPolicy{
+				Paths:          []string{"/v2/catalog"},
+				AllowedOrigins: []string{"*"},
+			})
+			request := newRequest("GET", "/v2/catalog", "https://anywhere.example.com")
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Header().Get("Access-Control-Allow-Origin")).To(Equal("*"))
+			Expect(writer.Header()).NotTo(HaveKey("Access-Control-Allow-Credentials"))
+		})
+
+		It("allows credentials for listed origins when also configured with *", func() {
+			handler = middleware.NewCORS(handler, middleware.CORSPolicy{
+				Paths:          []string{"/v2/catalog"},
+				AllowedOrigins: []string{"*", "https://dashboard.example.com"},
+			})
+			request := newRequest("GET", "/v2/catalog", "https://dashboard.example.com")
+
+			handler.ServeHTTP(writer, request)
+
+			Expect(writer.Header().Get("Access-Control-Allow-Origin")).To(Equal("https://dashboard.example.com"))
+			Expect(writer.Header().Get("Access-Control-Allow-Credentials")).To(Equal("true"))
+		})
+	})
+})
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+)
+
+type HTTPSEnforcer struct {
+	Handler             http.Handler
+	trustForwardedProto bool
+}
+
+func NewHTTPSEnforcer(handler http.Handler, trustForwardedProto bool) http.Handler {
+	return HTTPSEnforcer{
+		Handler:             handler,
+		trustForwardedProto: trustForwardedProto,
+	}
+}
+
+func (e HTTPSEnforcer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !e.Secure(req) {
+		e.Fail(w)
+		return
+	}
+
+	e.Handler.ServeHTTP(w, req)
+}
+
+func (e HTTPSEnforcer) Secure(req *http.Request) bool {
+	if req.TLS != nil {
+		return true
+	}
+
+	if e.trustForwardedProto {
+		return strings.EqualFold(req.Header.Get("X-Forwarded-Proto"), "https")
+	}
+
+	return false
+}
+
+func (e HTTPSEnforcer) Fail(w http.ResponseWriter) {
+	fail(w, http.StatusForbidden, "requests to this service broker must be made over HTTPS")
+}
@@ -0,0 +1,85 @@
+package middleware_test
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/pivotal-cf-experimental/envoy/internal/middleware"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HTTPSEnforcer", func() {
+	Describe("ServeHTTP", func() {
+		var wasCalled bool
+		var handler http.Handler
+		var writer *httptest.ResponseRecorder
+		var request *http.Request
+
+		BeforeEach(func() {
+			var err error
+			wasCalled = false
+			handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				wasCalled = true
+				w.WriteHeader(http.StatusTeapot)
+			})
+
+			writer = httptest.NewRecorder()
+			request, err = http.NewRequest("GET", "/v2/catalog", nil)
+			if err != nil {
+				panic(err)
+			}
+		})
+
+		It("delegates to handler when the request was made over HTTPS", func() {
+			request.TLS = &tls.ConnectionState{}
+
+			middleware.NewHTTPSEnforcer(handler, false).ServeHTTP(writer, request)
+
+			Expect(wasCalled).To(BeTrue())
+			Expect(writer.Code).To(Equal(http.StatusTeapot))
+		})
+
+		It("returns a 403 when the request was made over plaintext HTTP", func() {
+			middleware.NewHTTPSEnforcer(handler, false).ServeHTTP(writer, request)
+
+			Expect(wasCalled).To(BeFalse())
+			Expect(writer.Code).To(Equal(http.StatusForbidden))
+			Expect(writer.Header()["Content-Type"]).To(Equal([]string{"application/json"}))
+			Expect(writer.Body.String()).To(MatchJSON(`{
+				"description": "requests to this service broker must be made over HTTPS"
+			}`))
+		})
+
+		Context("when the request was forwarded over HTTPS by a load balancer", func() {
+			BeforeEach(func() {
+				request.Header.Set("X-Forwarded-Proto", "https")
+			})
+
+			It("delegates to handler when the forwarded header is trusted", func() {
+				middleware.NewHTTPSEnforcer(handler, true).ServeHTTP(writer, request)
+
+				Expect(wasCalled).To(BeTrue())
+				Expect(writer.Code).To(Equal(http.StatusTeapot))
+			})
+
+			It("returns a 403 when the forwarded header is not trusted", func() {
+				middleware.NewHTTPSEnforcer(handler, false).ServeHTTP(writer, request)
+
+				Expect(wasCalled).To(BeFalse())
+				Expect(writer.Code).To(Equal(http.StatusForbidden))
+			})
+		})
+
+		It("returns a 403 when a trusted forwarded header reports plaintext HTTP", func() {
+			request.Header.Set("X-Forwarded-Proto", "http")
+
+			middleware.NewHTTPSEnforcer(handler, true).ServeHTTP(writer, request)
+
+			Expect(wasCalled).To(BeFalse())
+			Expect(writer.Code).To(Equal(http.StatusForbidden))
+		})
+	})
+})
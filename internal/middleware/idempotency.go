@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+
+	"github.com/pivotal-cf-experimental/envoy/domain"
+)
+
+// IdempotencyKeyHeader is the header a client sets to identify retries of
+// the same mutating request.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+type IdempotencyStore interface {
+	Get(key string) (domain.IdempotentResponse, bool)
+	Put(key string, response domain.IdempotentResponse)
+}
+
+// Idempotency replays the stored response to a request that repeats the
+// Idempotency-Key of an earlier request to the same method and path, rather
+// than serving it again. Requests without the header are always served.
+// Responses to requests that failed with a 5xx status are not stored, so
+// that they can be retried.
+type Idempotency struct {
+	Handler  http.Handler
+	store    IdempotencyStore
+	inFlight *inFlightKeys
+}
+
+type inFlightKeys struct {
+	mutex sync.Mutex
+	keys  map[string]bool
+}
+
+func NewIdempotency(handler http.Handler, store IdempotencyStore) http.Handler {
+	return Idempotency{
+		Handler: handler,
+		store:   store,
+		inFlight: &inFlightKeys{
+			keys: map[string]bool{},
+		},
+	}
+}
+
+func (i Idempotency) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	key := req.Header.Get(IdempotencyKeyHeader)
+	if key == "" {
+		i.Handler.ServeHTTP(w, req)
+		return
+	}
+	key = req.Method + " " + req.URL.Path + " " + key
+
+	if response, ok := i.store.Get(key); ok {
+		replay(w, response)
+		return
+	}
+
+	if !i.inFlight.start(key) {
+		fail(w, http.StatusConflict, "a request with the same Idempotency-Key is already in progress")
+		return
+	}
+	defer i.inFlight.finish(key)
+
+	outer := w.Header().Clone()
+	recorder := &responseRecorder{
+		ResponseWriter: w,
+		status:         http.StatusOK,
+	}
+
+	i.Handler.ServeHTTP(recorder, req)
+
+	if recorder.status >= http.StatusInternalServerError {
+		return
+	}
+
+	i.store.Put(key, domain.IdempotentResponse{
+		Status: recorder.status,
+		Header: handlerHeaders(outer, w.Header()),
+		Body:   recorder.body.Bytes(),
+	})
+}
+
+// handlerHeaders returns the headers that were set by the handler, leaving
+// out those that were set before it was called, such as the request
+// identity, which must not be replayed.
+func handlerHeaders(outer, all http.Header) http.Header {
+	headers := http.Header{}
+	for name, values := range all {
+		if _, ok := outer[name]; !ok {
+			headers[name] = append([]string(nil), values...)
+		}
+	}
+
+	return headers
+}
+
+func replay(w http.ResponseWriter, response domain.IdempotentResponse) {
+	for name, values := range response.Header {
+		w.Header()[name] = values
+	}
+
+	w.WriteHeader(response.Status)
+	w.Write(response.Body)
+}
+
+func (k *inFlightKeys) start(key string) bool {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if k.keys[key] {
+		return false
+	}
+
+	k.keys[key] = true
+	return true
+}
+
+func (k *inFlightKeys) finish(key string) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	delete(k.keys, key)
+}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	r.body.Write(p)
+	return r.ResponseWriter.Write(p)
+}
@@ -0,0 +1,112 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/pivotal-cf-experimental/envoy/domain"
+	"github.com/pivotal-cf-experimental/envoy/internal/middleware"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type IdempotencyStore struct {
+	Responses map[string]domain.IdempotentResponse
+}
+
+func (s *IdempotencyStore) Get(key string) (domain.IdempotentResponse, bool) {
+	response, ok := s.Responses[key]
+	return response, ok
+}
+
+func (s *IdempotencyStore) Put(key string, response domain.IdempotentResponse) {
+	s.Responses[key] = response
+}
+
+var _ = Describe("Idempotency", func() {
+	Describe("ServeHTTP", func() {
+		var (
+			calls   int
+			status  int
+			store   *IdempotencyStore
+			handler http.Handler
+		)
+
+		serve := func(method, path, key string) *httptest.ResponseRecorder {
+			request, err := http.NewRequest(method, path, nil)
+			if err != nil {
+				panic(err)
+			}
+			if key != "" {
+				request.Header.Set(middleware.IdempotencyKeyHeader, key)
+			}
+
+			writer := httptest.NewRecorder()
+			writer.Header().Set("X-Outer", "set-before-the-handler")
+			handler.ServeHTTP(writer, request)
+
+			return writer
+		}
+
+		BeforeEach(func() {
+			calls = 0
+			status = http.StatusCreated
+			store = &IdempotencyStore{Responses: map[string]domain.IdempotentResponse{}}
+			handler = middleware.NewIdempotency(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				calls++
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(status)
+				w.Write([]byte(`{"dashboard_url":"http://example.com"}`))
+			}), store)
+		})
+
+		It("replays the response to a request with a repeated key", func() {
+			first := serve("PUT", "/v2/service_instances/some-id", "key-1")
+			second := serve("PUT", "/v2/service_instances/some-id", "key-1")
+
+			Expect(calls).To(Equal(1))
+			Expect(second.Code).To(Equal(http.StatusCreated))
+			Expect(second.Header().Get("Content-Type")).To(Equal("application/json"))
+			Expect(second.Body.String()).To(Equal(first.Body.String()))
+		})
+
+		It("does not store headers that were set before the handler", func() {
+			serve("PUT", "/v2/service_instances/some-id", "key-1")
+
+			Expect(store.Responses).To(HaveLen(1))
+			for _, response := range store.Responses {
+				Expect(response.Header).To(HaveKey("Content-Type"))
+				Expect(response.Header).NotTo(HaveKey("X-Outer"))
+			}
+		})
+
+		It("serves requests with different keys or paths", func() {
+			serve("PUT", "/v2/service_instances/some-id", "key-1")
+			serve("PUT", "/v2/service_instances/some-id", "key-2")
+			serve("PUT", "/v2/service_instances/other-id", "key-1")
+			serve("DELETE", "/v2/service_instances/some-id", "key-1")
+
+			Expect(calls).To(Equal(4))
+		})
+
+		It("always serves requests without a key", func() {
+			serve("PUT", "/v2/service_instances/some-id", "")
+			serve("PUT", "/v2/service_instances/some-id", "")
+
+			Expect(calls).To(Equal(2))
+			Expect(store.Responses).To(BeEmpty())
+		})
+
+		It("does not store server errors, so that they can be retried", func() {
+			status = http.StatusServiceUnavailable
+			serve("PUT", "/v2/service_instances/some-id", "key-1")
+
+			status = http.StatusCreated
+			writer := serve("PUT", "/v2/service_instances/some-id", "key-1")
+
+			Expect(calls).To(Equal(2))
+			Expect(writer.Code).To(Equal(http.StatusCreated))
+		})
+	})
+})
@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pivotal-cf-experimental/envoy/domain"
+)
+
+// IdentityStore remembers the requests seen with each request identity, so
+// that repeats of a request can be recognized. One store is shared by the
+// ReplayGuard and the RetryLogger, each of which looks back over its own
+// window. Requests are forgotten once they have not been seen for the
+// retention period, which should be at least as long as either window. It
+// is safe for concurrent use.
+type IdentityStore struct {
+	mutex     sync.Mutex
+	retention time.Duration
+	entries   map[string]identityEntry
+}
+
+type identityEntry struct {
+	attempts    int
+	attemptedAt time.Time
+	response    *domain.IdempotentResponse
+	completedAt time.Time
+}
+
+func NewIdentityStore(retention time.Duration) *IdentityStore {
+	return &IdentityStore{
+		retention: retention,
+		entries:   map[string]identityEntry{},
+	}
+}
+
+// identityKey returns the key under which a request is stored, which
+// includes its method and path so that the same identity sent to
+// different endpoints is not confused. An empty key is returned for a
+// request without an identity.
+func identityKey(req *http.Request) string {
+	identity := req.Header.Get(RequestIdentityHeader)
+	if identity == "" {
+		return ""
+	}
+
+	return req.Method + " " + req.URL.Path + " " + identity
+}
+
+// attempt records an attempt at the request and returns how many attempts
+// have been made, including this one, since the request was last
+// attempted more than the window ago.
+func (s *IdentityStore) attempt(key string, window time.Duration) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.forgetExpired()
+
+	entry := s.entries[key]
+	if time.Since(entry.attemptedAt) >= window {
+		entry.attempts = 0
+	}
+	entry.attempts++
+	entry.attemptedAt = time.Now()
+	s.entries[key] = entry
+
+	return entry.attempts
+}
+
+// response returns the response stored for the request, if it completed
+// within the window.
+func (s *IdentityStore) response(key string, window time.Duration) (domain.IdempotentResponse, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok || entry.response == nil || time.Since(entry.completedAt) >= window {
+		return domain.IdempotentResponse{}, false
+	}
+
+	return *entry.response, true
+}
+
+// complete stores the response to the request.
+func (s *IdentityStore) complete(key string, response domain.IdempotentResponse) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.forgetExpired()
+
+	entry := s.entries[key]
+	entry.response = &response
+	entry.completedAt = time.Now()
+	s.entries[key] = entry
+}
+
+// forgetExpired forgets any requests that have been neither attempted nor
+// completed within the retention period, so that the store does not grow
+// without bound. The mutex must be held.
+func (s *IdentityStore) forgetExpired() {
+	for key, entry := range s.entries {
+		if time.Since(entry.attemptedAt) >= s.retention && time.Since(entry.completedAt) >= s.retention {
+			delete(s.entries, key)
+		}
+	}
+}
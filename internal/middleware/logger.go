@@ -0,0 +1,190 @@
+package middleware
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Logger is the structured logger that the middleware writes to. Like
+// handlers.Logger, it mirrors envoy.Logger without importing the root
+// package.
+type Logger interface {
+	Info(message string, data map[string]interface{})
+	Error(message string, data map[string]interface{})
+}
+
+type RequestLogger struct {
+	Handler        http.Handler
+	logger         Logger
+	accessLog      io.Writer
+	trustedProxies []*net.IPNet
+}
+
+// NewRequestLogger returns a RequestLogger that logs each request to the
+// logger. When the request comes from one of the trusted proxies, the
+// client IP is taken from the X-Forwarded-For header.
+func NewRequestLogger(handler http.Handler, logger Logger, trustedProxies ...*net.IPNet) http.Handler {
+	return RequestLogger{
+		Handler:        handler,
+		logger:         logger,
+		trustedProxies: trustedProxies,
+	}
+}
+
+// NewAccessLogger returns a RequestLogger that also writes a line in the
+// Common Log Format to the access log for each request. When the logger is
+// nil, only the access log is written.
+func NewAccessLogger(handler http.Handler, logger Logger, accessLog io.Writer, trustedProxies ...*net.IPNet) http.Handler {
+	return RequestLogger{
+		Handler:        handler,
+		logger:         logger,
+		accessLog:      accessLog,
+		trustedProxies: trustedProxies,
+	}
+}
+
+func (l RequestLogger) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+	recorder := &statusRecorder{
+		ResponseWriter: w,
+		status:         http.StatusOK,
+	}
+
+	l.Handler.ServeHTTP(recorder, req)
+
+	clientIP := ClientIP(req, l.trustedProxies)
+	if l.accessLog != nil {
+		fmt.Fprintln(l.accessLog, CommonLogFormat(req, clientIP, start, recorder.status, recorder.bytes))
+	}
+
+	if l.logger == nil {
+		return
+	}
+
+	data := map[string]interface{}{
+		"method":   req.Method,
+		"path":     req.URL.Path,
+		"status":   recorder.status,
+		"duration": time.Since(start).String(),
+	}
+
+	if clientIP != "" {
+		data["client_ip"] = clientIP
+	}
+
+	if identity := RequestIdentityFromContext(req.Context()); identity != "" {
+		data["request_id"] = identity
+	}
+
+	if recorder.status >= http.StatusInternalServerError {
+		l.logger.Error("request.failed", data)
+		return
+	}
+
+	l.logger.Info("request.served", data)
+}
+
+// ClientIP returns the address of the client that made the request. When
+// the direct peer is one of the trusted proxies, the X-Forwarded-For header
+// is read from right to left, and the first address that is not a trusted
+// proxy is returned. Otherwise, the address of the direct peer is returned.
+func ClientIP(req *http.Request, trustedProxies []*net.IPNet) string {
+	peer, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		peer = req.RemoteAddr
+	}
+
+	if !trusted(peer, trustedProxies) {
+		return peer
+	}
+
+	var forwarded []string
+	for _, header := range req.Header["X-Forwarded-For"] {
+		for _, address := range strings.Split(header, ",") {
+			if address = strings.TrimSpace(address); address != "" {
+				forwarded = append(forwarded, address)
+			}
+		}
+	}
+
+	client := peer
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		client = forwarded[i]
+		if !trusted(client, trustedProxies) {
+			break
+		}
+	}
+
+	return client
+}
+
+func trusted(address string, trustedProxies []*net.IPNet) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CommonLogFormat returns the line describing a request from the given
+// client IP in the Common Log Format used by the Apache HTTP Server, such as:
+//
+//	127.0.0.1 - admin [10/Oct/2000:13:55:36 -0700] "GET /v2/catalog HTTP/1.1" 200 2326
+func CommonLogFormat(req *http.Request, clientIP string, start time.Time, status, bytes int) string {
+	host := clientIP
+	if host == "" {
+		host = "-"
+	}
+
+	user := "-"
+	if username, _, ok := req.BasicAuth(); ok && username != "" {
+		user = username
+	}
+
+	size := "-"
+	if bytes > 0 {
+		size = strconv.Itoa(bytes)
+	}
+
+	return fmt.Sprintf("%s - %s [%s] %q %d %s",
+		host,
+		user,
+		start.Format("02/Jan/2006:15:04:05 -0700"),
+		fmt.Sprintf("%s %s %s", req.Method, req.URL.RequestURI(), req.Proto),
+		status,
+		size,
+	)
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(p)
+	r.bytes += n
+	return n, err
+}
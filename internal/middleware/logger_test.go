@@ -0,0 +1,212 @@
+package middleware_test
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/pivotal-cf-experimental/envoy/internal/middleware"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type LogEntry struct {
+	Level   string
+	Message string
+	Data    map[string]interface{}
+}
+
+type Logger struct {
+	Entries []LogEntry
+}
+
+func NewLogger() *Logger {
+	return &Logger{}
+}
+
+func (l *Logger) Info(message string, data map[string]interface{}) {
+	l.Entries = append(l.Entries, LogEntry{"info", message, data})
+}
+
+func (l *Logger) Error(message string, data map[string]interface{}) {
+	l.Entries = append(l.Entries, LogEntry{"error", message, data})
+}
+
+var _ = Describe("RequestLogger", func() {
+	Describe("ServeHTTP", func() {
+		var status int
+		var logger *Logger
+		var requestLogger http.Handler
+		var writer *httptest.ResponseRecorder
+		var request *http.Request
+
+		BeforeEach(func() {
+			var err error
+			status = http.StatusTeapot
+			handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(status)
+			})
+			logger = NewLogger()
+			requestLogger = middleware.NewRequestLogger(handler, logger)
+
+			writer = httptest.NewRecorder()
+			request, err = http.NewRequest("GET", "/v2/catalog", nil)
+			if err != nil {
+				panic(err)
+			}
+		})
+
+		It("delegates to the handler, but doesn't change the status code", func() {
+			requestLogger.ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusTeapot))
+		})
+
+		It("logs the request as info", func() {
+			requestLogger.ServeHTTP(writer, request)
+
+			Expect(logger.Entries).To(HaveLen(1))
+			Expect(logger.Entries[0].Level).To(Equal("info"))
+			Expect(logger.Entries[0].Message).To(Equal("request.served"))
+			Expect(logger.Entries[0].Data).To(HaveKeyWithValue("method", "GET"))
+			Expect(logger.Entries[0].Data).To(HaveKeyWithValue("path", "/v2/catalog"))
+			Expect(logger.Entries[0].Data).To(HaveKeyWithValue("status", http.StatusTeapot))
+			Expect(logger.Entries[0].Data).To(HaveKey("duration"))
+		})
+
+		It("includes the request identity when there is one", func() {
+			middleware.NewRequestIdentity(requestLogger).ServeHTTP(writer, request)
+
+			Expect(logger.Entries).To(HaveLen(1))
+			Expect(logger.Entries[0].Data).To(HaveKeyWithValue("request_id", writer.Header().Get(middleware.RequestIdentityHeader)))
+		})
+
+		Context("when the handler fails", func() {
+			BeforeEach(func() {
+				status = http.StatusInternalServerError
+			})
+
+			It("logs the request as an error", func() {
+				requestLogger.ServeHTTP(writer, request)
+
+				Expect(logger.Entries).To(HaveLen(1))
+				Expect(logger.Entries[0].Level).To(Equal("error"))
+				Expect(logger.Entries[0].Message).To(Equal("request.failed"))
+				Expect(logger.Entries[0].Data).To(HaveKeyWithValue("status", http.StatusInternalServerError))
+			})
+		})
+
+		Context("when an access log is configured", func() {
+			var accessLog *bytes.Buffer
+
+			BeforeEach(func() {
+				accessLog = &bytes.Buffer{}
+				handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+					w.WriteHeader(http.StatusOK)
+					w.Write([]byte(`{"services":[]}`))
+				})
+				requestLogger = middleware.NewAccessLogger(handler, logger, accessLog)
+
+				request.RemoteAddr = "10.0.0.1:54321"
+				request.SetBasicAuth("admin", "secret")
+			})
+
+			It("writes a line in the Common Log Format", func() {
+				requestLogger.ServeHTTP(writer, request)
+
+				Expect(accessLog.String()).To(MatchRegexp(
+					`^10\.0\.0\.1 - admin \[\d{2}/[A-Z][a-z]{2}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "GET /v2/catalog HTTP/1\.1" 200 15\n$`))
+			})
+
+			It("also writes the structured log", func() {
+				requestLogger.ServeHTTP(writer, request)
+
+				Expect(logger.Entries).To(HaveLen(1))
+				Expect(logger.Entries[0].Message).To(Equal("request.served"))
+			})
+
+			It("only writes the access log when there is no logger", func() {
+				requestLogger = middleware.NewAccessLogger(requestLogger.(middleware.RequestLogger).Handler, nil, accessLog)
+
+				requestLogger.ServeHTTP(writer, request)
+
+				Expect(accessLog.String()).To(ContainSubstring(`"GET /v2/catalog HTTP/1.1" 200 15`))
+			})
+		})
+	})
+
+	Describe("CommonLogFormat", func() {
+		It("uses dashes for unknown fields", func() {
+			request, err := http.NewRequest("DELETE", "/v2/service_instances/some-id?plan_id=plan-id", nil)
+			if err != nil {
+				panic(err)
+			}
+
+			start := time.Date(2000, time.October, 10, 13, 55, 36, 0, time.FixedZone("", -7*60*60))
+
+			Expect(middleware.CommonLogFormat(request, "", start, http.StatusGone, 0)).To(Equal(
+				`- - - [10/Oct/2000:13:55:36 -0700] "DELETE /v2/service_instances/some-id?plan_id=plan-id HTTP/1.1" 410 -`))
+		})
+	})
+
+	Describe("ClientIP", func() {
+		var request *http.Request
+		var trustedProxies []*net.IPNet
+
+		BeforeEach(func() {
+			var err error
+			request, err = http.NewRequest("GET", "/v2/catalog", nil)
+			if err != nil {
+				panic(err)
+			}
+
+			_, network, err := net.ParseCIDR("10.0.0.0/8")
+			if err != nil {
+				panic(err)
+			}
+			trustedProxies = []*net.IPNet{network}
+
+			request.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.2")
+		})
+
+		It("reads the client IP from X-Forwarded-For when the peer is a trusted proxy", func() {
+			request.RemoteAddr = "10.0.0.1:54321"
+
+			Expect(middleware.ClientIP(request, trustedProxies)).To(Equal("203.0.113.7"))
+		})
+
+		It("ignores X-Forwarded-For when the peer is not a trusted proxy", func() {
+			request.RemoteAddr = "198.51.100.9:54321"
+
+			Expect(middleware.ClientIP(request, trustedProxies)).To(Equal("198.51.100.9"))
+		})
+
+		It("ignores X-Forwarded-For when no proxies are trusted", func() {
+			request.RemoteAddr = "10.0.0.1:54321"
+
+			Expect(middleware.ClientIP(request, nil)).To(Equal("10.0.0.1"))
+		})
+
+		It("does not trust addresses that a client prepended to X-Forwarded-For", func() {
+			request.RemoteAddr = "10.0.0.1:54321"
+			request.Header.Set("X-Forwarded-For", "10.0.0.3, 198.51.100.9, 10.0.0.2")
+
+			Expect(middleware.ClientIP(request, trustedProxies)).To(Equal("198.51.100.9"))
+		})
+
+		It("logs the client IP", func() {
+			request.RemoteAddr = "10.0.0.1:54321"
+			logger := NewLogger()
+			accessLog := &bytes.Buffer{}
+
+			middleware.NewAccessLogger(http.NotFoundHandler(), logger, accessLog, trustedProxies...).ServeHTTP(httptest.NewRecorder(), request)
+
+			Expect(logger.Entries).To(HaveLen(1))
+			Expect(logger.Entries[0].Data).To(HaveKeyWithValue("client_ip", "203.0.113.7"))
+			Expect(accessLog.String()).To(HavePrefix("203.0.113.7 - - ["))
+		})
+	})
+})
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// MessageAlias copies the description of each JSON error response into a
+// message field, for clients that expect errors to be described there.
+type MessageAlias struct {
+	Handler http.Handler
+}
+
+func NewMessageAlias(handler http.Handler) http.Handler {
+	return MessageAlias{
+		Handler: handler,
+	}
+}
+
+func (a MessageAlias) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	writer := &aliasWriter{ResponseWriter: w}
+	a.Handler.ServeHTTP(writer, req)
+
+	if !writer.buffering {
+		return
+	}
+
+	body := writer.body.Bytes()
+	if aliased, ok := aliasMessage(body); ok {
+		body = aliased
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	}
+
+	w.WriteHeader(writer.status)
+	w.Write(body)
+}
+
+func aliasMessage(body []byte) ([]byte, bool) {
+	var document map[string]interface{}
+	if err := json.Unmarshal(body, &document); err != nil {
+		return nil, false
+	}
+
+	description, ok := document["description"]
+	if !ok {
+		return nil, false
+	}
+
+	if _, ok := document["message"]; ok {
+		return nil, false
+	}
+
+	document["message"] = description
+
+	aliased, err := json.Marshal(document)
+	if err != nil {
+		return nil, false
+	}
+
+	return aliased, true
+}
+
+// aliasWriter passes successful responses straight through, and buffers
+// error responses so that their body can be rewritten.
+type aliasWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+	buffering   bool
+	status      int
+	body        bytes.Buffer
+}
+
+func (w *aliasWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *aliasWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	if status >= http.StatusBadRequest {
+		w.buffering = true
+		w.status = status
+		return
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *aliasWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if w.buffering {
+		return w.body.Write(p)
+	}
+
+	return w.ResponseWriter.Write(p)
+}
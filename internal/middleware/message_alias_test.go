@@ -0,0 +1,70 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/pivotal-cf-experimental/envoy/internal/middleware"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MessageAlias", func() {
+	Describe("ServeHTTP", func() {
+		var writer *httptest.ResponseRecorder
+		var request *http.Request
+
+		BeforeEach(func() {
+			var err error
+			writer = httptest.NewRecorder()
+			request, err = http.NewRequest("GET", "/v2/catalog", nil)
+			if err != nil {
+				panic(err)
+			}
+		})
+
+		serve := func(code int, body string) {
+			handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(code)
+				w.Write([]byte(body))
+			})
+
+			middleware.NewMessageAlias(handler).ServeHTTP(writer, request)
+		}
+
+		It("adds a message alongside the description of an error response", func() {
+			serve(http.StatusBadRequest, `{"error":"BadRequest","description":"missing required field"}`)
+
+			Expect(writer.Code).To(Equal(http.StatusBadRequest))
+			Expect(writer.Header()["Content-Type"]).To(Equal([]string{"application/json"}))
+			Expect(writer.Body.String()).To(MatchJSON(`{
+				"error": "BadRequest",
+				"description": "missing required field",
+				"message": "missing required field"
+			}`))
+		})
+
+		It("does not change successful responses", func() {
+			serve(http.StatusOK, `{"description":"not an error"}`)
+
+			Expect(writer.Code).To(Equal(http.StatusOK))
+			Expect(writer.Body.String()).To(MatchJSON(`{"description":"not an error"}`))
+		})
+
+		It("does not change error responses without a description", func() {
+			serve(http.StatusConflict, `{}`)
+
+			Expect(writer.Code).To(Equal(http.StatusConflict))
+			Expect(writer.Body.String()).To(MatchJSON(`{}`))
+		})
+
+		It("does not change error responses that are not JSON", func() {
+			serve(http.StatusNotFound, "404 page not found\n")
+
+			Expect(writer.Code).To(Equal(http.StatusNotFound))
+			Expect(writer.Body.String()).To(Equal("404 page not found\n"))
+		})
+	})
+})
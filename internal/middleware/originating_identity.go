@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const OriginatingIdentityHeader = "X-Broker-API-Originating-Identity"
+
+type OriginatingIdentity struct {
+	Handler http.Handler
+	strict  bool
+}
+
+func NewOriginatingIdentity(handler http.Handler, strict bool) http.Handler {
+	return OriginatingIdentity{
+		Handler: handler,
+		strict:  strict,
+	}
+}
+
+func (o OriginatingIdentity) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	header := req.Header.Get(OriginatingIdentityHeader)
+	if header == "" {
+		o.Handler.ServeHTTP(w, req)
+		return
+	}
+
+	if err := ValidateOriginatingIdentity(header); err != nil {
+		if o.strict {
+			fail(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		req.Header.Del(OriginatingIdentityHeader)
+	}
+
+	o.Handler.ServeHTTP(w, req)
+}
+
+// ValidateOriginatingIdentity checks that the header value is made up of a
+// platform name followed by a base64 encoded JSON object.
+func ValidateOriginatingIdentity(header string) error {
+	parts := strings.SplitN(header, " ", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return errors.New("originating identity must be a platform followed by an encoded value")
+	}
+
+	value, err := decodeBase64(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return errors.New("originating identity value must be base64 encoded")
+	}
+
+	var identity map[string]interface{}
+	if err := json.Unmarshal(value, &identity); err != nil || identity == nil {
+		return errors.New("originating identity value must be a JSON object")
+	}
+
+	return nil
+}
+
+func decodeBase64(value string) ([]byte, error) {
+	encodings := []*base64.Encoding{
+		base64.StdEncoding,
+		base64.URLEncoding,
+		base64.RawStdEncoding,
+		base64.RawURLEncoding,
+	}
+
+	var err error
+	for _, encoding := range encodings {
+		var decoded []byte
+		decoded, err = encoding.DecodeString(value)
+		if err == nil {
+			return decoded, nil
+		}
+	}
+
+	return nil, err
+}
@@ -0,0 +1,114 @@
+package middleware_test
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/pivotal-cf-experimental/envoy/internal/middleware"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("OriginatingIdentity", func() {
+	Describe("ServeHTTP", func() {
+		var wasCalled bool
+		var receivedHeader string
+		var handler http.Handler
+		var writer *httptest.ResponseRecorder
+		var request *http.Request
+
+		BeforeEach(func() {
+			var err error
+			wasCalled = false
+			receivedHeader = ""
+			handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				wasCalled = true
+				receivedHeader = req.Header.Get("X-Broker-API-Originating-Identity")
+				w.WriteHeader(http.StatusTeapot)
+			})
+
+			writer = httptest.NewRecorder()
+			request, err = http.NewRequest("PUT", "/v2/service_instances/some-instance", nil)
+			if err != nil {
+				panic(err)
+			}
+		})
+
+		It("delegates to the handler when no header is present", func() {
+			middleware.NewOriginatingIdentity(handler, true).ServeHTTP(writer, request)
+
+			Expect(wasCalled).To(BeTrue())
+			Expect(writer.Code).To(Equal(http.StatusTeapot))
+		})
+
+		Context("when the header is valid", func() {
+			var header string
+
+			BeforeEach(func() {
+				header = "cloudfoundry " + base64.URLEncoding.EncodeToString([]byte(`{"user_id":"683ea748-3092-4ff4-b656-39cacc4d5360"}`))
+				request.Header.Set("X-Broker-API-Originating-Identity", header)
+			})
+
+			It("delegates to the handler with the header intact", func() {
+				middleware.NewOriginatingIdentity(handler, true).ServeHTTP(writer, request)
+
+				Expect(wasCalled).To(BeTrue())
+				Expect(receivedHeader).To(Equal(header))
+			})
+		})
+
+		Context("when the value is not valid base64", func() {
+			BeforeEach(func() {
+				request.Header.Set("X-Broker-API-Originating-Identity", "cloudfoundry !!not-base64!!")
+			})
+
+			It("ignores the header by default", func() {
+				middleware.NewOriginatingIdentity(handler, false).ServeHTTP(writer, request)
+
+				Expect(wasCalled).To(BeTrue())
+				Expect(receivedHeader).To(BeEmpty())
+			})
+
+			It("returns a 400 in strict mode", func() {
+				middleware.NewOriginatingIdentity(handler, true).ServeHTTP(writer, request)
+
+				Expect(wasCalled).To(BeFalse())
+				Expect(writer.Code).To(Equal(http.StatusBadRequest))
+				Expect(writer.Body.String()).To(MatchJSON(`{"description":"originating identity value must be base64 encoded"}`))
+			})
+		})
+
+		Context("when the decoded value is not JSON", func() {
+			BeforeEach(func() {
+				value := base64.StdEncoding.EncodeToString([]byte("user_id=683ea748"))
+				request.Header.Set("X-Broker-API-Originating-Identity", "cloudfoundry "+value)
+			})
+
+			It("ignores the header by default", func() {
+				middleware.NewOriginatingIdentity(handler, false).ServeHTTP(writer, request)
+
+				Expect(wasCalled).To(BeTrue())
+				Expect(receivedHeader).To(BeEmpty())
+			})
+
+			It("returns a 400 in strict mode", func() {
+				middleware.NewOriginatingIdentity(handler, true).ServeHTTP(writer, request)
+
+				Expect(wasCalled).To(BeFalse())
+				Expect(writer.Code).To(Equal(http.StatusBadRequest))
+				Expect(writer.Body.String()).To(MatchJSON(`{"description":"originating identity value must be a JSON object"}`))
+			})
+		})
+
+		It("returns a 400 in strict mode when the platform is missing", func() {
+			request.Header.Set("X-Broker-API-Originating-Identity", base64.StdEncoding.EncodeToString([]byte(`{}`)))
+
+			middleware.NewOriginatingIdentity(handler, true).ServeHTTP(writer, request)
+
+			Expect(wasCalled).To(BeFalse())
+			Expect(writer.Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+})
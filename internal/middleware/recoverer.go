@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+)
+
+type Recoverer struct {
+	Handler http.Handler
+	logger  Logger
+}
+
+func NewRecoverer(handler http.Handler, logger Logger) http.Handler {
+	return Recoverer{
+		Handler: handler,
+		logger:  logger,
+	}
+}
+
+// ServeHTTP recovers from a panic in the handler, logging it and writing a
+// 500 when the handler had not yet written a response. A panic with
+// http.ErrAbortHandler is passed on, so that the server aborts the response
+// as the handler intended.
+func (r Recoverer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	writer := &writeTracker{ResponseWriter: w}
+
+	defer func() {
+		recovered := recover()
+		if recovered == nil {
+			return
+		}
+
+		if recovered == http.ErrAbortHandler {
+			panic(recovered)
+		}
+
+		if r.logger != nil {
+			r.logger.Error("request.panic", map[string]interface{}{
+				"method": req.Method,
+				"path":   req.URL.Path,
+				"panic":  fmt.Sprintf("%v", recovered),
+			})
+		}
+
+		if !writer.wrote {
+			fail(w, http.StatusInternalServerError, "internal server error")
+		}
+	}()
+
+	r.Handler.ServeHTTP(writer, req)
+}
+
+// writeTracker records whether a response has been started, since a
+// response cannot be replaced once its header has been written.
+type writeTracker struct {
+	http.ResponseWriter
+	wrote bool
+}
+
+func (t *writeTracker) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
+
+func (t *writeTracker) WriteHeader(status int) {
+	t.wrote = true
+	t.ResponseWriter.WriteHeader(status)
+}
+
+func (t *writeTracker) Write(p []byte) (int, error) {
+	t.wrote = true
+	return t.ResponseWriter.Write(p)
+}
@@ -0,0 +1,100 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/pivotal-cf-experimental/envoy/internal/middleware"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Recoverer", func() {
+	Describe("ServeHTTP", func() {
+		var writer *httptest.ResponseRecorder
+		var request *http.Request
+
+		BeforeEach(func() {
+			var err error
+			writer = httptest.NewRecorder()
+			request, err = http.NewRequest("PUT", "/v2/service_instances/some-instance", nil)
+			if err != nil {
+				panic(err)
+			}
+		})
+
+		It("delegates to handler, but doesn't change the status code", func() {
+			handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(http.StatusTeapot)
+			})
+
+			middleware.NewRecoverer(handler, nil).ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusTeapot))
+		})
+
+		Context("when the handler panics", func() {
+			var handler http.Handler
+
+			BeforeEach(func() {
+				handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+					panic("something went terribly wrong")
+				})
+			})
+
+			It("returns a 500 with a JSON error", func() {
+				middleware.NewRecoverer(handler, nil).ServeHTTP(writer, request)
+
+				Expect(writer.Code).To(Equal(http.StatusInternalServerError))
+				Expect(writer.Header()["Content-Type"]).To(Equal([]string{"application/json"}))
+				Expect(writer.Body.String()).To(MatchJSON(`{"description":"internal server error"}`))
+			})
+
+			It("logs the panic when a logger is provided", func() {
+				logger := NewLogger()
+
+				middleware.NewRecoverer(handler, logger).ServeHTTP(writer, request)
+
+				Expect(logger.Entries).To(HaveLen(1))
+				Expect(logger.Entries[0].Level).To(Equal("error"))
+				Expect(logger.Entries[0].Message).To(Equal("request.panic"))
+				Expect(logger.Entries[0].Data).To(HaveKeyWithValue("panic", "something went terribly wrong"))
+				Expect(logger.Entries[0].Data).To(HaveKeyWithValue("path", "/v2/service_instances/some-instance"))
+			})
+		})
+
+		Context("when the handler panics after writing a response", func() {
+			It("logs the panic without writing a 500", func() {
+				handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+					w.WriteHeader(http.StatusCreated)
+					w.Write([]byte(`{"dashboard_url":`))
+					panic("something went terribly wrong")
+				})
+				logger := NewLogger()
+
+				middleware.NewRecoverer(handler, logger).ServeHTTP(writer, request)
+
+				Expect(writer.Code).To(Equal(http.StatusCreated))
+				Expect(writer.Body.String()).To(Equal(`{"dashboard_url":`))
+				Expect(logger.Entries).To(HaveLen(1))
+				Expect(logger.Entries[0].Message).To(Equal("request.panic"))
+			})
+		})
+
+		Context("when the handler aborts the response", func() {
+			It("passes the panic on without logging or writing a response", func() {
+				handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+					panic(http.ErrAbortHandler)
+				})
+				logger := NewLogger()
+
+				Expect(func() {
+					middleware.NewRecoverer(handler, logger).ServeHTTP(writer, request)
+				}).To(PanicWith(http.ErrAbortHandler))
+				Expect(logger.Entries).To(BeEmpty())
+				Expect(writer.Body.String()).To(BeEmpty())
+			})
+		})
+	})
+})
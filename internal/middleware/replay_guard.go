@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pivotal-cf-experimental/envoy/domain"
+)
+
+// ReplayGuard returns the stored response to a request that repeats the
+// X-Broker-API-Request-Identity of a request to the same method and path
+// that completed within the window, rather than serving it again, so that
+// a platform retrying an asynchronous request does not cause duplicate side
+// effects. Requests without the header are always served. Responses to
+// requests that failed with a 5xx status are not stored, so that they can
+// be retried.
+type ReplayGuard struct {
+	Handler    http.Handler
+	identities *IdentityStore
+	window     time.Duration
+}
+
+func NewReplayGuard(handler http.Handler, identities *IdentityStore, window time.Duration) http.Handler {
+	return ReplayGuard{
+		Handler:    handler,
+		identities: identities,
+		window:     window,
+	}
+}
+
+func (g ReplayGuard) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	key := identityKey(req)
+	if key == "" {
+		g.Handler.ServeHTTP(w, req)
+		return
+	}
+
+	if response, ok := g.identities.response(key, g.window); ok {
+		replay(w, response)
+		return
+	}
+
+	outer := w.Header().Clone()
+	recorder := &responseRecorder{
+		ResponseWriter: w,
+		status:         http.StatusOK,
+	}
+
+	g.Handler.ServeHTTP(recorder, req)
+
+	if recorder.status >= http.StatusInternalServerError {
+		return
+	}
+
+	g.identities.complete(key, domain.IdempotentResponse{
+		Status: recorder.status,
+		Header: handlerHeaders(outer, w.Header()),
+		Body:   recorder.body.Bytes(),
+	})
+}
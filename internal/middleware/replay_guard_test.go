@@ -0,0 +1,135 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/pivotal-cf-experimental/envoy/internal/middleware"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ReplayGuard", func() {
+	Describe("ServeHTTP", func() {
+		var (
+			calls   int
+			status  int
+			window  time.Duration
+			handler http.Handler
+		)
+
+		serve := func(method, path, identity string) *httptest.ResponseRecorder {
+			request, err := http.NewRequest(method, path, nil)
+			if err != nil {
+				panic(err)
+			}
+			if identity != "" {
+				request.Header.Set(middleware.RequestIdentityHeader, identity)
+			}
+
+			writer := httptest.NewRecorder()
+			handler.ServeHTTP(writer, request)
+
+			return writer
+		}
+
+		BeforeEach(func() {
+			calls = 0
+			status = http.StatusAccepted
+			window = time.Minute
+		})
+
+		JustBeforeEach(func() {
+			handler = middleware.NewReplayGuard(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				calls++
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(status)
+				w.Write([]byte(`{"operation":"task-1"}`))
+			}), middleware.NewIdentityStore(window), window)
+		})
+
+		It("returns the prior response to a provision replayed within the window", func() {
+			first := serve("PUT", "/v2/service_instances/some-id", "identity-1")
+			second := serve("PUT", "/v2/service_instances/some-id", "identity-1")
+
+			Expect(calls).To(Equal(1))
+			Expect(second.Code).To(Equal(http.StatusAccepted))
+			Expect(second.Header().Get("Content-Type")).To(Equal("application/json"))
+			Expect(second.Body.String()).To(Equal(first.Body.String()))
+		})
+
+		Context("when the window has passed", func() {
+			BeforeEach(func() {
+				window = 10 * time.Millisecond
+			})
+
+			It("serves a provision replayed outside the window again", func() {
+				serve("PUT", "/v2/service_instances/some-id", "identity-1")
+				time.Sleep(2 * window)
+				serve("PUT", "/v2/service_instances/some-id", "identity-1")
+
+				Expect(calls).To(Equal(2))
+			})
+		})
+
+		It("serves requests with a different identity, method or path", func() {
+			serve("PUT", "/v2/service_instances/some-id", "identity-1")
+			serve("PUT", "/v2/service_instances/some-id", "identity-2")
+			serve("PATCH", "/v2/service_instances/some-id", "identity-1")
+			serve("PUT", "/v2/service_instances/other-id", "identity-1")
+
+			Expect(calls).To(Equal(4))
+		})
+
+		It("does not replay the response to an identity for another method or path", func() {
+			first := serve("PUT", "/v2/service_instances/some-id", "identity-1")
+			status = http.StatusOK
+			second := serve("PUT", "/v2/service_instances/other-id", "identity-1")
+			third := serve("DELETE", "/v2/service_instances/some-id", "identity-1")
+
+			Expect(calls).To(Equal(3))
+			Expect(first.Code).To(Equal(http.StatusAccepted))
+			Expect(second.Code).To(Equal(http.StatusOK))
+			Expect(third.Code).To(Equal(http.StatusOK))
+		})
+
+		It("shares its store with a retry logger", func() {
+			logger := NewLogger()
+			identities := middleware.NewIdentityStore(time.Minute)
+			handler = middleware.NewRetryLogger(middleware.NewReplayGuard(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				calls++
+				w.WriteHeader(http.StatusAccepted)
+			}), identities, time.Minute), logger, identities, time.Minute)
+
+			serve("PUT", "/v2/service_instances/some-id", "identity-1")
+			second := serve("PUT", "/v2/service_instances/some-id", "identity-1")
+
+			Expect(calls).To(Equal(1))
+			Expect(second.Code).To(Equal(http.StatusAccepted))
+			Expect(logger.Entries).To(HaveLen(1))
+			Expect(logger.Entries[0].Message).To(Equal("request.retry-detected"))
+		})
+
+		It("always serves requests without an identity", func() {
+			serve("PUT", "/v2/service_instances/some-id", "")
+			serve("PUT", "/v2/service_instances/some-id", "")
+
+			Expect(calls).To(Equal(2))
+		})
+
+		Context("when the request fails with a server error", func() {
+			BeforeEach(func() {
+				status = http.StatusInternalServerError
+			})
+
+			It("serves the replay again", func() {
+				serve("PUT", "/v2/service_instances/some-id", "identity-1")
+				serve("PUT", "/v2/service_instances/some-id", "identity-1")
+
+				Expect(calls).To(Equal(2))
+			})
+		})
+	})
+})
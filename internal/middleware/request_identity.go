@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+)
+
+const RequestIdentityHeader = "X-Broker-API-Request-Identity"
+
+type requestIdentityKey struct{}
+
+// RequestIdentity ensures that every request has an identity, so that log
+// lines for the same request can be correlated. The identity sent by the
+// platform is used when present, otherwise a UUID is generated.
+type RequestIdentity struct {
+	Handler http.Handler
+}
+
+func NewRequestIdentity(handler http.Handler) http.Handler {
+	return RequestIdentity{
+		Handler: handler,
+	}
+}
+
+func (i RequestIdentity) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	identity := req.Header.Get(RequestIdentityHeader)
+	if identity == "" {
+		identity = newUUID()
+		req.Header.Set(RequestIdentityHeader, identity)
+	}
+
+	w.Header().Set(RequestIdentityHeader, identity)
+
+	ctx := context.WithValue(req.Context(), requestIdentityKey{}, identity)
+	i.Handler.ServeHTTP(w, req.WithContext(ctx))
+}
+
+// RequestIdentityFromContext returns the identity stored in the context by
+// RequestIdentity, or an empty string if there is none.
+func RequestIdentityFromContext(ctx context.Context) string {
+	identity, _ := ctx.Value(requestIdentityKey{}).(string)
+	return identity
+}
+
+func newUUID() string {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		panic(err)
+	}
+
+	bytes[6] = (bytes[6] & 0x0f) | 0x40
+	bytes[8] = (bytes[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", bytes[0:4], bytes[4:6], bytes[6:8], bytes[8:10], bytes[10:])
+}
@@ -0,0 +1,64 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/pivotal-cf-experimental/envoy/internal/middleware"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RequestIdentity", func() {
+	Describe("ServeHTTP", func() {
+		var contextIdentity string
+		var headerIdentity string
+		var handler http.Handler
+		var writer *httptest.ResponseRecorder
+		var request *http.Request
+
+		BeforeEach(func() {
+			var err error
+			handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				contextIdentity = middleware.RequestIdentityFromContext(req.Context())
+				headerIdentity = req.Header.Get(middleware.RequestIdentityHeader)
+				w.WriteHeader(http.StatusTeapot)
+			})
+
+			writer = httptest.NewRecorder()
+			request, err = http.NewRequest("GET", "/v2/catalog", nil)
+			if err != nil {
+				panic(err)
+			}
+		})
+
+		It("generates an identity when the platform does not send one", func() {
+			middleware.NewRequestIdentity(handler).ServeHTTP(writer, request)
+
+			Expect(writer.Code).To(Equal(http.StatusTeapot))
+			Expect(contextIdentity).To(MatchRegexp(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`))
+			Expect(headerIdentity).To(Equal(contextIdentity))
+			Expect(writer.Header().Get(middleware.RequestIdentityHeader)).To(Equal(contextIdentity))
+		})
+
+		It("generates a different identity for each request", func() {
+			middleware.NewRequestIdentity(handler).ServeHTTP(writer, request)
+			first := contextIdentity
+
+			request.Header.Del(middleware.RequestIdentityHeader)
+			middleware.NewRequestIdentity(handler).ServeHTTP(httptest.NewRecorder(), request)
+
+			Expect(contextIdentity).NotTo(Equal(first))
+		})
+
+		It("uses the identity sent by the platform", func() {
+			request.Header.Set(middleware.RequestIdentityHeader, "platform-request-id")
+
+			middleware.NewRequestIdentity(handler).ServeHTTP(writer, request)
+
+			Expect(contextIdentity).To(Equal("platform-request-id"))
+			Expect(writer.Header().Get(middleware.RequestIdentityHeader)).To(Equal("platform-request-id"))
+		})
+	})
+})
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+func fail(w http.ResponseWriter, code int, description string) {
+	failWithError(w, code, "", description)
+}
+
+// failWithError writes a failure that includes an error code, such as
+// "ConcurrencyError", which clients use to decide how to handle it.
+func failWithError(w http.ResponseWriter, code int, errorCode, description string) {
+	body, err := json.Marshal(struct {
+		Error       string `json:"error,omitempty"`
+		Description string `json:"description"`
+	}{errorCode, description})
+	if err != nil {
+		panic(err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(body)
+}
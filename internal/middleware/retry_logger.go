@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+)
+
+// RetryLogger logs each request whose X-Broker-API-Request-Identity
+// repeats that of a request to the same method and path seen within the
+// window, so that operators can see how often the platform retries
+// requests. Requests are always served, and requests without the header
+// are never treated as retries.
+type RetryLogger struct {
+	Handler    http.Handler
+	logger     Logger
+	identities *IdentityStore
+	window     time.Duration
+}
+
+func NewRetryLogger(handler http.Handler, logger Logger, identities *IdentityStore, window time.Duration) http.Handler {
+	return RetryLogger{
+		Handler:    handler,
+		logger:     logger,
+		identities: identities,
+		window:     window,
+	}
+}
+
+func (l RetryLogger) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if key := identityKey(req); key != "" {
+		if attempts := l.identities.attempt(key, l.window); attempts > 1 {
+			l.logger.Info("request.retry-detected", map[string]interface{}{
+				"identity": req.Header.Get(RequestIdentityHeader),
+				"method":   req.Method,
+				"path":     req.URL.Path,
+				"attempts": attempts,
+			})
+		}
+	}
+
+	l.Handler.ServeHTTP(w, req)
+}
@@ -0,0 +1,102 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/pivotal-cf-experimental/envoy/internal/middleware"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RetryLogger", func() {
+	Describe("ServeHTTP", func() {
+		var (
+			calls   int
+			logger  *Logger
+			handler http.Handler
+		)
+
+		serveTo := func(method, path, identity string) *httptest.ResponseRecorder {
+			request, err := http.NewRequest(method, path, nil)
+			if err != nil {
+				panic(err)
+			}
+			if identity != "" {
+				request.Header.Set(middleware.RequestIdentityHeader, identity)
+			}
+
+			writer := httptest.NewRecorder()
+			handler.ServeHTTP(writer, request)
+
+			return writer
+		}
+
+		serve := func(identity string) *httptest.ResponseRecorder {
+			return serveTo("PUT", "/v2/service_instances/instance-id", identity)
+		}
+
+		BeforeEach(func() {
+			calls = 0
+			logger = NewLogger()
+			handler = middleware.NewRetryLogger(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				calls++
+				w.WriteHeader(http.StatusCreated)
+			}), logger, middleware.NewIdentityStore(time.Minute), time.Minute)
+		})
+
+		It("logs a retry when the same request identity is seen again", func() {
+			Expect(serve("request-1").Code).To(Equal(http.StatusCreated))
+			Expect(logger.Entries).To(BeEmpty())
+
+			Expect(serve("request-1").Code).To(Equal(http.StatusCreated))
+			Expect(calls).To(Equal(2))
+			Expect(logger.Entries).To(Equal([]LogEntry{{
+				Level:   "info",
+				Message: "request.retry-detected",
+				Data: map[string]interface{}{
+					"identity": "request-1",
+					"method":   "PUT",
+					"path":     "/v2/service_instances/instance-id",
+					"attempts": 2,
+				},
+			}}))
+		})
+
+		It("does not log requests with different identities", func() {
+			serve("request-1")
+			serve("request-2")
+
+			Expect(logger.Entries).To(BeEmpty())
+		})
+
+		It("does not log the same identity sent to different endpoints", func() {
+			serveTo("PUT", "/v2/service_instances/instance-id", "request-1")
+			serveTo("PATCH", "/v2/service_instances/instance-id", "request-1")
+			serveTo("PUT", "/v2/service_instances/other-instance-id", "request-1")
+
+			Expect(calls).To(Equal(3))
+			Expect(logger.Entries).To(BeEmpty())
+		})
+
+		It("does not log requests without an identity", func() {
+			serve("")
+			serve("")
+
+			Expect(calls).To(Equal(2))
+			Expect(logger.Entries).To(BeEmpty())
+		})
+
+		It("forgets identities once the window has passed", func() {
+			handler = middleware.NewRetryLogger(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}), logger, middleware.NewIdentityStore(time.Nanosecond), time.Nanosecond)
+
+			serve("request-1")
+			time.Sleep(time.Millisecond)
+			serve("request-1")
+
+			Expect(logger.Entries).To(BeEmpty())
+		})
+	})
+})
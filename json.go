@@ -0,0 +1,30 @@
+package envoy
+
+import "github.com/pivotal-cf-experimental/envoy/internal/handlers"
+
+// Marshaler defines the interface for a JSON library used to write the
+// bodies of broker responses, such as jsoniter or segmentio/encoding.
+type Marshaler interface {
+	Marshal(v interface{}) ([]byte, error)
+}
+
+// Unmarshaler defines the interface for a JSON library used to read the
+// bodies of broker requests.
+type Unmarshaler interface {
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// SetJSONMarshaler replaces encoding/json as the library used to write
+// response bodies for every broker handler. It should be called once,
+// before any requests are served. Passing nil restores encoding/json.
+func SetJSONMarshaler(marshaler Marshaler) {
+	handlers.SetMarshaler(marshaler)
+}
+
+// SetJSONUnmarshaler replaces encoding/json as the library used to read
+// request bodies for every broker handler. Request bodies are read in
+// full before being passed to the Unmarshaler. It should be called once,
+// before any requests are served. Passing nil restores encoding/json.
+func SetJSONUnmarshaler(unmarshaler Unmarshaler) {
+	handlers.SetUnmarshaler(unmarshaler)
+}
@@ -0,0 +1,83 @@
+package envoy_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/pivotal-cf-experimental/envoy"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type CountingJSON struct {
+	Marshals   int
+	Unmarshals int
+}
+
+func (c *CountingJSON) Marshal(v interface{}) ([]byte, error) {
+	c.Marshals++
+	return json.Marshal(v)
+}
+
+func (c *CountingJSON) Unmarshal(data []byte, v interface{}) error {
+	c.Unmarshals++
+	return json.Unmarshal(data, v)
+}
+
+var _ = Describe("JSON serializer", func() {
+	var codec *CountingJSON
+	var handler http.Handler
+
+	BeforeEach(func() {
+		codec = &CountingJSON{}
+		envoy.SetJSONMarshaler(codec)
+		envoy.SetJSONUnmarshaler(codec)
+
+		var err error
+		handler, err = envoy.NewBrokerHandler(NewTestBroker())
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		envoy.SetJSONMarshaler(nil)
+		envoy.SetJSONUnmarshaler(nil)
+	})
+
+	It("uses the replacement marshaler to write responses", func() {
+		request, err := http.NewRequest("GET", "/v2/catalog", nil)
+		if err != nil {
+			panic(err)
+		}
+		request.SetBasicAuth("username", "password")
+
+		writer := httptest.NewRecorder()
+		handler.ServeHTTP(writer, request)
+
+		Expect(writer.Code).To(Equal(http.StatusOK))
+		Expect(writer.Body.String()).To(MatchJSON(`{"services":[]}`))
+		Expect(codec.Marshals).To(Equal(1))
+	})
+
+	It("uses the replacement unmarshaler to read requests", func() {
+		body := strings.NewReader(`{
+			"service_id": "service-id",
+			"plan_id": "plan-id",
+			"organization_guid": "organization-guid",
+			"space_guid": "space-guid"
+		}`)
+		request, err := http.NewRequest("PUT", "/v2/service_instances/instance-id", body)
+		if err != nil {
+			panic(err)
+		}
+		request.SetBasicAuth("username", "password")
+
+		writer := httptest.NewRecorder()
+		handler.ServeHTTP(writer, request)
+
+		Expect(writer.Code).To(Equal(http.StatusCreated))
+		Expect(codec.Unmarshals).To(Equal(1))
+	})
+})
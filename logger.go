@@ -0,0 +1,47 @@
+package envoy
+
+import (
+	"encoding/json"
+	"log"
+)
+
+// Logger defines the interface for a structured logger that the service
+// broker can write to. It is small enough to be satisfied by an adapter
+// around most logging libraries, such as lager.
+type Logger interface {
+	Info(message string, data map[string]interface{})
+	Error(message string, data map[string]interface{})
+}
+
+// StandardLogger adapts a *log.Logger from the standard library to the
+// Logger interface.
+type StandardLogger struct {
+	logger *log.Logger
+}
+
+// NewStandardLogger returns a Logger that writes each message, along with
+// its data encoded as JSON, to the given *log.Logger.
+func NewStandardLogger(logger *log.Logger) StandardLogger {
+	return StandardLogger{
+		logger: logger,
+	}
+}
+
+// Info writes an informational message to the underlying logger.
+func (l StandardLogger) Info(message string, data map[string]interface{}) {
+	l.write("info", message, data)
+}
+
+// Error writes an error message to the underlying logger.
+func (l StandardLogger) Error(message string, data map[string]interface{}) {
+	l.write("error", message, data)
+}
+
+func (l StandardLogger) write(level, message string, data map[string]interface{}) {
+	encodedData, err := json.Marshal(data)
+	if err != nil {
+		encodedData = []byte(`{}`)
+	}
+
+	l.logger.Printf("[%s] %s %s", level, message, encodedData)
+}
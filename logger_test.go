@@ -0,0 +1,37 @@
+package envoy_test
+
+import (
+	"bytes"
+	"log"
+
+	"github.com/pivotal-cf-experimental/envoy"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("StandardLogger", func() {
+	var buffer *bytes.Buffer
+	var logger envoy.Logger
+
+	BeforeEach(func() {
+		buffer = bytes.NewBuffer([]byte{})
+		logger = envoy.NewStandardLogger(log.New(buffer, "", 0))
+	})
+
+	It("writes info messages with their data to the underlying logger", func() {
+		logger.Info("request.served", map[string]interface{}{
+			"status": 200,
+		})
+
+		Expect(buffer.String()).To(Equal("[info] request.served {\"status\":200}\n"))
+	})
+
+	It("writes error messages with their data to the underlying logger", func() {
+		logger.Error("request.failed", map[string]interface{}{
+			"status": 500,
+		})
+
+		Expect(buffer.String()).To(Equal("[error] request.failed {\"status\":500}\n"))
+	})
+})
@@ -0,0 +1,19 @@
+package matchers
+
+import (
+	"fmt"
+	"net/http/httptest"
+)
+
+func bodyOf(actual interface{}) ([]byte, error) {
+	switch actual := actual.(type) {
+	case []byte:
+		return actual, nil
+	case string:
+		return []byte(actual), nil
+	case *httptest.ResponseRecorder:
+		return actual.Body.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("expected a []byte, string or *httptest.ResponseRecorder, got %T", actual)
+	}
+}
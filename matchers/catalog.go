@@ -0,0 +1,80 @@
+package matchers
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/onsi/gomega/format"
+	"github.com/onsi/gomega/types"
+	"github.com/pivotal-cf-experimental/envoy/domain"
+)
+
+// BeAValidCatalog returns a matcher that succeeds when the actual response
+// body, given as a []byte, string or *httptest.ResponseRecorder, is a JSON
+// catalog in which every service and plan has its required fields and no
+// IDs are duplicated.
+func BeAValidCatalog() types.GomegaMatcher {
+	return &validCatalogMatcher{}
+}
+
+type validCatalogMatcher struct {
+	problem string
+}
+
+func (m *validCatalogMatcher) Match(actual interface{}) (bool, error) {
+	body, err := bodyOf(actual)
+	if err != nil {
+		return false, err
+	}
+
+	var document map[string]json.RawMessage
+	if err := json.Unmarshal(body, &document); err != nil {
+		m.problem = "catalog is not a JSON object"
+		return false, nil
+	}
+
+	if _, ok := document["services"]; !ok {
+		m.problem = `catalog is missing the "services" key`
+		return false, nil
+	}
+
+	var catalog domain.Catalog
+	if err := json.Unmarshal(body, &catalog); err != nil {
+		m.problem = fmt.Sprintf("catalog does not match the expected structure: %s", err)
+		return false, nil
+	}
+
+	for _, service := range catalog.Services {
+		if service.ID == "" || service.Name == "" || service.Description == "" {
+			m.problem = fmt.Sprintf("service %q is missing a required field", service.ID)
+			return false, nil
+		}
+
+		if len(service.Plans) == 0 {
+			m.problem = fmt.Sprintf("service %q has no plans", service.ID)
+			return false, nil
+		}
+
+		for _, plan := range service.Plans {
+			if plan.ID == "" || plan.Name == "" || plan.Description == "" {
+				m.problem = fmt.Sprintf("plan %q of service %q is missing a required field", plan.ID, service.ID)
+				return false, nil
+			}
+		}
+	}
+
+	if err := catalog.Validate(); err != nil {
+		m.problem = err.Error()
+		return false, nil
+	}
+
+	return true, nil
+}
+
+func (m *validCatalogMatcher) FailureMessage(actual interface{}) string {
+	return format.Message(actual, fmt.Sprintf("to be a valid catalog, but %s", m.problem))
+}
+
+func (m *validCatalogMatcher) NegatedFailureMessage(actual interface{}) string {
+	return format.Message(actual, "not to be a valid catalog")
+}
@@ -0,0 +1,78 @@
+package matchers_test
+
+import (
+	"github.com/pivotal-cf-experimental/envoy/matchers"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BeAValidCatalog", func() {
+	It("matches a valid catalog", func() {
+		Expect(`{
+			"services": [
+				{
+					"id": "service-1",
+					"name": "first",
+					"description": "The first service",
+					"bindable": true,
+					"plans": [
+						{
+							"id": "plan-1",
+							"name": "free",
+							"description": "A free plan"
+						}
+					]
+				}
+			]
+		}`).To(matchers.BeAValidCatalog())
+	})
+
+	It("matches an empty catalog", func() {
+		Expect(`{"services":[]}`).To(matchers.BeAValidCatalog())
+	})
+
+	It("does not match a catalog without the services key", func() {
+		Expect(`{}`).NotTo(matchers.BeAValidCatalog())
+	})
+
+	It("does not match a top-level array", func() {
+		Expect(`[]`).NotTo(matchers.BeAValidCatalog())
+	})
+
+	It("does not match a catalog with a service missing its name", func() {
+		Expect(`{
+			"services": [
+				{
+					"id": "service-1",
+					"description": "The first service",
+					"plans": [{"id": "plan-1", "name": "free", "description": "A free plan"}]
+				}
+			]
+		}`).NotTo(matchers.BeAValidCatalog())
+	})
+
+	It("does not match a catalog with duplicate plan IDs", func() {
+		Expect(`{
+			"services": [
+				{
+					"id": "service-1",
+					"name": "first",
+					"description": "The first service",
+					"plans": [
+						{"id": "plan-1", "name": "free", "description": "A free plan"},
+						{"id": "plan-1", "name": "paid", "description": "A paid plan"}
+					]
+				}
+			]
+		}`).NotTo(matchers.BeAValidCatalog())
+	})
+
+	It("explains why the catalog is not valid", func() {
+		matcher := matchers.BeAValidCatalog()
+		success, err := matcher.Match(`{"services":[{"id":"service-1","name":"first","description":"The first service"}]}`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(success).To(BeFalse())
+		Expect(matcher.FailureMessage(`...`)).To(ContainSubstring(`service "service-1" has no plans`))
+	})
+})
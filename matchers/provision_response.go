@@ -0,0 +1,58 @@
+package matchers
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/onsi/gomega/format"
+	"github.com/onsi/gomega/types"
+	"github.com/pivotal-cf-experimental/envoy/domain"
+)
+
+// MatchProvisionResponse returns a matcher that succeeds when the actual
+// response body, given as a []byte, string or *httptest.ResponseRecorder,
+// is the JSON representation of the expected provision response.
+func MatchProvisionResponse(expected domain.ProvisionResponse) types.GomegaMatcher {
+	return &provisionResponseMatcher{
+		expected: expected,
+	}
+}
+
+type provisionResponseMatcher struct {
+	expected domain.ProvisionResponse
+	actual   map[string]interface{}
+}
+
+func (m *provisionResponseMatcher) Match(actual interface{}) (bool, error) {
+	body, err := bodyOf(actual)
+	if err != nil {
+		return false, err
+	}
+
+	m.actual = map[string]interface{}{}
+	if err := json.Unmarshal(body, &m.actual); err != nil {
+		return false, fmt.Errorf("provision response is not a JSON object: %s", err)
+	}
+
+	for key := range m.actual {
+		if key != "dashboard_url" && key != "operation" {
+			return false, nil
+		}
+	}
+
+	return m.field("dashboard_url") == m.expected.DashboardURL &&
+		m.field("operation") == m.expected.OperationData, nil
+}
+
+func (m *provisionResponseMatcher) field(key string) string {
+	value, _ := m.actual[key].(string)
+	return value
+}
+
+func (m *provisionResponseMatcher) FailureMessage(actual interface{}) string {
+	return format.Message(m.actual, "to match provision response", m.expected)
+}
+
+func (m *provisionResponseMatcher) NegatedFailureMessage(actual interface{}) string {
+	return format.Message(m.actual, "not to match provision response", m.expected)
+}
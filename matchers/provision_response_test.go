@@ -0,0 +1,56 @@
+package matchers_test
+
+import (
+	"net/http/httptest"
+
+	"github.com/pivotal-cf-experimental/envoy/domain"
+	"github.com/pivotal-cf-experimental/envoy/matchers"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MatchProvisionResponse", func() {
+	It("matches an empty provision response", func() {
+		Expect(`{}`).To(matchers.MatchProvisionResponse(domain.ProvisionResponse{}))
+	})
+
+	It("matches a provision response with a dashboard URL and operation", func() {
+		Expect([]byte(`{"dashboard_url":"http://dashboard.example.com","operation":"task-1"}`)).To(
+			matchers.MatchProvisionResponse(domain.ProvisionResponse{
+				DashboardURL:  "http://dashboard.example.com",
+				OperationData: "task-1",
+			}))
+	})
+
+	It("matches the body of a response recorder", func() {
+		recorder := httptest.NewRecorder()
+		recorder.WriteString(`{"dashboard_url":"http://dashboard.example.com"}`)
+
+		Expect(recorder).To(matchers.MatchProvisionResponse(domain.ProvisionResponse{
+			DashboardURL: "http://dashboard.example.com",
+		}))
+	})
+
+	It("does not match a response with a different dashboard URL", func() {
+		Expect(`{"dashboard_url":"http://other.example.com"}`).NotTo(
+			matchers.MatchProvisionResponse(domain.ProvisionResponse{
+				DashboardURL: "http://dashboard.example.com",
+			}))
+	})
+
+	It("does not match a response with unexpected fields", func() {
+		Expect(`{"credentials":{}}`).NotTo(matchers.MatchProvisionResponse(domain.ProvisionResponse{}))
+	})
+
+	It("returns an error for a response that is not a JSON object", func() {
+		success, err := matchers.MatchProvisionResponse(domain.ProvisionResponse{}).Match(`[]`)
+		Expect(err).To(HaveOccurred())
+		Expect(success).To(BeFalse())
+	})
+
+	It("returns an error for an unsupported actual value", func() {
+		_, err := matchers.MatchProvisionResponse(domain.ProvisionResponse{}).Match(42)
+		Expect(err).To(HaveOccurred())
+	})
+})
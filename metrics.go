@@ -0,0 +1,19 @@
+package envoy
+
+import "github.com/pivotal-cf-experimental/envoy/internal/handlers"
+
+// Metrics defines the interface for a sink of counters, such as a StatsD or
+// Prometheus client, that the broker handler reports to.
+type Metrics interface {
+	IncrementCounter(name string)
+}
+
+const (
+	// CatalogCacheHitCounter is incremented each time the catalog is
+	// served from the cache configured with WithCatalogCache.
+	CatalogCacheHitCounter = handlers.CatalogCacheHitCounter
+
+	// CatalogCacheMissCounter is incremented each time the catalog is
+	// fetched from the broker because the cache was empty or expired.
+	CatalogCacheMissCounter = handlers.CatalogCacheMissCounter
+)
@@ -63,6 +63,6 @@ func (u Unbinder) Unbind(domain.UnbindRequest) error {
 type Deprovisioner struct{}
 
 // Deprovision returns an empty domain.DeprovisionResponse.
-func (d Deprovisioner) Deprovision(domain.DeprovisionRequest) error {
-	return nil
+func (d Deprovisioner) Deprovision(domain.DeprovisionRequest) (domain.DeprovisionResponse, error) {
+	return domain.DeprovisionResponse{}, nil
 }
@@ -0,0 +1,541 @@
+package envoy
+
+import (
+	"io"
+	"time"
+
+	"github.com/pivotal-cf-experimental/envoy/domain"
+)
+
+// Option configures optional behavior of the http.Handler returned by
+// NewBrokerHandler.
+type Option func(*config)
+
+type config struct {
+	logger               Logger
+	bodyReadTimeout      time.Duration
+	readOnlyCredentialer Credentialer
+	syncOperation        bool
+	requireHTTPS         bool
+	trustForwardedProto  bool
+	minimumAPIVersion    string
+	maximumAPIVersion    string
+	recoverPanics        bool
+	validateIdentity     bool
+	strictIdentity       bool
+	rejectUnknownPlans   bool
+	allowMissingSpace    bool
+	stripSyslogDrain     bool
+	messageAlias         bool
+	transformer          CredentialTransformer
+	requestIdentity      bool
+	auditLogger          AuditLogger
+	describeNotFound     bool
+	defaultPlanID        string
+	serviceCredentialers map[string][]Credentialer
+	credentialsProvider  CredentialsProvider
+	operationStore       domain.OperationStore
+	corsOrigins          []string
+	corsMethods          []string
+	corsHeaders          []string
+	idempotencyStore     IdempotencyStore
+	accessLog            io.Writer
+	accessLogOnly        bool
+	trustedProxies       []string
+	catalogTransformer   CatalogTransformer
+	warnParameters       bool
+	unbindNotFound       bool
+	guardOperations      bool
+	debugProvisions      bool
+	catalogTTL           time.Duration
+	metrics              Metrics
+	signOperations       bool
+	operationSigningKey  []byte
+	failUnknownOps       bool
+	replayWindow         time.Duration
+	recordedExchanges    int
+	warnSameIDs          bool
+	checkDeprovisions    bool
+	schemaSizeLimit      int
+	retryLogWindow       time.Duration
+	compress             bool
+	encoders             []encoder
+}
+
+type encoder struct {
+	name       string
+	newEncoder func(io.Writer) io.WriteCloser
+}
+
+func newConfig(options []Option) config {
+	var c config
+	for _, option := range options {
+		option(&c)
+	}
+
+	return c
+}
+
+// WithLogger configures the broker handler to log each request it serves
+// to the given Logger. Internal errors are also logged, and the response
+// for each includes a reference that can be used to find its log line.
+func WithLogger(logger Logger) Option {
+	return func(c *config) {
+		c.logger = logger
+	}
+}
+
+// WithBodyReadTimeout configures the maximum amount of time that the
+// provision, update, bind and deprovision handlers will wait to read a
+// request body. Requests whose bodies take longer to arrive are rejected
+// with a 408 Request Timeout, and the read of the body is interrupted. By
+// default, there is no limit.
+func WithBodyReadTimeout(timeout time.Duration) Option {
+	return func(c *config) {
+		c.bodyReadTimeout = timeout
+	}
+}
+
+// WithReadOnlyCredentials configures an additional set of Basic Auth
+// credentials that are only permitted to read from the service broker,
+// such as fetching the catalog. Requests that modify service instances or
+// bindings still require the credentials provided by the Broker.
+func WithReadOnlyCredentials(credentialer Credentialer) Option {
+	return func(c *config) {
+		c.readOnlyCredentialer = credentialer
+	}
+}
+
+// WithSyncProvisionOperation configures the provision handler to include
+// the operation returned by the Provisioner in the body of a synchronous
+// 201 Created response. This can be useful for platforms that record the
+// operation for auditing. By default, the operation is only included in
+// asynchronous 202 Accepted responses, as required by the specification.
+func WithSyncProvisionOperation() Option {
+	return func(c *config) {
+		c.syncOperation = true
+	}
+}
+
+// WithRequireHTTPS configures the broker handler to reject any request
+// that was not made over TLS with a 403 Forbidden. When the broker is
+// deployed behind a load balancer that terminates TLS, setting
+// trustForwardedProto will also accept requests carrying an
+// "X-Forwarded-Proto: https" header.
+func WithRequireHTTPS(trustForwardedProto bool) Option {
+	return func(c *config) {
+		c.requireHTTPS = true
+		c.trustForwardedProto = trustForwardedProto
+	}
+}
+
+// WithAPIVersions configures the broker handler to reject requests whose
+// X-Broker-API-Version header falls outside of the given inclusive range,
+// such as "2.13" to "2.16", with a 412 Precondition Failed.
+func WithAPIVersions(minimum, maximum string) Option {
+	return func(c *config) {
+		c.minimumAPIVersion = minimum
+		c.maximumAPIVersion = maximum
+	}
+}
+
+// WithPanicRecovery configures the broker handler to recover from a panic
+// in any of the Broker methods, responding to that request with a 500
+// Internal Server Error. When a Logger is also configured, the panic is
+// logged.
+func WithPanicRecovery() Option {
+	return func(c *config) {
+		c.recoverPanics = true
+	}
+}
+
+// WithOriginatingIdentityValidation configures the broker handler to
+// validate the X-Broker-API-Originating-Identity header, which must be a
+// platform name followed by a base64 encoded JSON object. By default, a
+// malformed header is removed from the request before it reaches the
+// Broker. When strict is set, the request is instead rejected with a 400
+// Bad Request.
+func WithOriginatingIdentityValidation(strict bool) Option {
+	return func(c *config) {
+		c.validateIdentity = true
+		c.strictIdentity = strict
+	}
+}
+
+// WithUnknownPlanValidation configures the provision handler to reject
+// requests for a service and plan combination that is not in the catalog
+// with a 422 Unprocessable Entity, rather than passing them on to the
+// Provisioner.
+func WithUnknownPlanValidation() Option {
+	return func(c *config) {
+		c.rejectUnknownPlans = true
+	}
+}
+
+// WithCompression configures the broker handler to gzip responses for
+// clients that advertise support for it in their Accept-Encoding header.
+// Only gzip is negotiated; other encodings, such as Brotli ("br"), are
+// negotiated only once an encoder for them is registered with
+// WithCompressionEncoder.
+func WithCompression() Option {
+	return func(c *config) {
+		c.compress = true
+	}
+}
+
+// WithCompressionEncoder enables compression as with WithCompression, and
+// registers an additional content encoding, such as "br", that is preferred
+// over gzip when the client advertises support for it. Encoders registered
+// first are preferred over those registered later. The broker handler does
+// not provide a Brotli encoder, so "br" is never negotiated unless one is
+// registered here.
+func WithCompressionEncoder(name string, newEncoder func(io.Writer) io.WriteCloser) Option {
+	return func(c *config) {
+		c.compress = true
+		c.encoders = append(c.encoders, encoder{name, newEncoder})
+	}
+}
+
+// WithOptionalOrganizationAndSpace configures the provision handler to
+// accept requests that omit the organization_guid and space_guid fields.
+// These are required by CloudFoundry, but platforms such as Kubernetes
+// may not provide them.
+func WithOptionalOrganizationAndSpace() Option {
+	return func(c *config) {
+		c.allowMissingSpace = true
+	}
+}
+
+// WithSyslogDrainStripping configures the bind handler to remove the
+// syslog_drain_url from a bind response when the service does not declare
+// "syslog_drain" in its requires field. CloudFoundry rejects such responses,
+// so the URL is dropped and a message is logged instead.
+func WithSyslogDrainStripping() Option {
+	return func(c *config) {
+		c.stripSyslogDrain = true
+	}
+}
+
+// WithErrorMessageAlias configures the broker handler to include a message
+// field, alongside the description field, in the body of each error
+// response. This is useful for tooling that reads the message field. By
+// default, only the description field is included.
+func WithErrorMessageAlias() Option {
+	return func(c *config) {
+		c.messageAlias = true
+	}
+}
+
+// WithCredentialTransformer configures the bind handler to pass binding
+// credentials through the given CredentialTransformer before they are
+// written to the response. By default, credentials are returned unchanged.
+func WithCredentialTransformer(transformer CredentialTransformer) Option {
+	return func(c *config) {
+		c.transformer = transformer
+	}
+}
+
+// WithRequestIdentity configures the broker handler to ensure that every
+// request has an X-Broker-API-Request-Identity, generating a UUID when the
+// platform does not send one. The identity is returned in the response
+// header of the same name, and is included in the log line for the request
+// when a Logger is configured.
+func WithRequestIdentity() Option {
+	return func(c *config) {
+		c.requestIdentity = true
+	}
+}
+
+// WithAuditLogger configures the broker handler to write an audit record
+// to the given AuditLogger before and after each request that provisions,
+// updates, binds, unbinds or deprovisions.
+func WithAuditLogger(auditLogger AuditLogger) Option {
+	return func(c *config) {
+		c.auditLogger = auditLogger
+	}
+}
+
+// WithNotFoundDescriptions configures the broker handler to include the
+// message of a ServiceInstanceNotFoundError as the description of the 404
+// response to a request to fetch a service instance. By default, the body
+// of the response is {}.
+func WithNotFoundDescriptions() Option {
+	return func(c *config) {
+		c.describeNotFound = true
+	}
+}
+
+// WithDefaultPlan configures the provision handler to provision the plan
+// with the given ID when a request omits the plan_id field. By default,
+// such requests are rejected with a 400 Bad Request.
+func WithDefaultPlan(planID string) Option {
+	return func(c *config) {
+		c.defaultPlanID = planID
+	}
+}
+
+// WithServiceCredentials configures a set of Basic Auth credentials for
+// requests that concern the service with the given ID, such as a broker
+// that aggregates several backends with their own credentials. Requests
+// for that service must use one of the credentials registered for it,
+// rather than the credentials provided by the Broker. The option may be
+// given more than once for the same service. The catalog and other
+// requests that do not concern a single service still require the
+// credentials provided by the Broker. The service is taken from the body
+// of a provision, bind or update, and from the query string of other
+// requests. Up to 1 MiB of the request body is read to find it, within
+// the WithBodyReadTimeout, but only once the credentials are known to
+// match one of the configured sets. Requests that name different services
+// in the query string and the body, or that name the service more than
+// once in the query string, are rejected with a 400 Bad Request.
+func WithServiceCredentials(serviceID string, credentialer Credentialer) Option {
+	return func(c *config) {
+		if c.serviceCredentialers == nil {
+			c.serviceCredentialers = map[string][]Credentialer{}
+		}
+
+		c.serviceCredentialers[serviceID] = append(c.serviceCredentialers[serviceID], credentialer)
+	}
+}
+
+// WithCredentialsProvider configures the broker handler to authenticate
+// requests with the credentials looked up by the given provider on each
+// request, rather than those returned by the Credentials method of the
+// Broker.
+func WithCredentialsProvider(provider CredentialsProvider) Option {
+	return func(c *config) {
+		c.credentialsProvider = provider
+	}
+}
+
+// WithOperationStore configures the last_operation handler to reject, with
+// a 400 Bad Request, requests to poll an operation other than the last one
+// recorded in the given store for the service instance. The broker remains
+// responsible for recording its operations in the store.
+func WithOperationStore(store domain.OperationStore) Option {
+	return func(c *config) {
+		c.operationStore = store
+	}
+}
+
+// WithCatalogCORS configures the broker handler to allow browsers to fetch
+// the catalog from the given origins, such as a broker dashboard served
+// from another domain. The origin "*" allows any origin, but browsers will
+// not send credentials to origins that are only allowed by it. When no
+// methods or headers are given, GET requests with the Authorization and
+// X-Broker-API-Version headers are allowed. Requests for the catalog must
+// still be authenticated.
+func WithCatalogCORS(allowedOrigins, allowedMethods, allowedHeaders []string) Option {
+	return func(c *config) {
+		c.corsOrigins = allowedOrigins
+		c.corsMethods = allowedMethods
+		c.corsHeaders = allowedHeaders
+	}
+}
+
+// WithIdempotencyKeys configures the broker handler to deduplicate retries
+// of requests that provision, update, bind, unbind or deprovision. When a
+// request repeats the Idempotency-Key header of an earlier request to the
+// same method and path, the response to the earlier request is returned
+// from the given store instead of calling the broker again.
+func WithIdempotencyKeys(store IdempotencyStore) Option {
+	return func(c *config) {
+		c.idempotencyStore = store
+	}
+}
+
+// WithCommonLogFormat configures the broker handler to write a line in the
+// Apache Common Log Format to the given writer for each request it serves.
+// The lines are written in addition to the structured request logs written
+// to the Logger given with WithLogger, unless replaceStructured is true, in
+// which case the Logger is only used for internal errors.
+func WithCommonLogFormat(accessLog io.Writer, replaceStructured bool) Option {
+	return func(c *config) {
+		c.accessLog = accessLog
+		c.accessLogOnly = replaceStructured
+	}
+}
+
+// WithTrustedProxies configures the broker handler to log the client IP
+// from the X-Forwarded-For header when a request comes from a proxy within
+// one of the given CIDR ranges, such as "10.0.0.0/8". Requests from other
+// peers are logged with their own address, since the header could have been
+// set by the client. NewBrokerHandler returns an error if a range is invalid.
+func WithTrustedProxies(cidrs ...string) Option {
+	return func(c *config) {
+		c.trustedProxies = append(c.trustedProxies, cidrs...)
+	}
+}
+
+// WithCatalogTransformer configures the catalog handler to pass the catalog
+// through the given CatalogTransformer before it is returned to the
+// platform. The catalog is validated before any transformation, when the
+// broker handler is created.
+func WithCatalogTransformer(transformer CatalogTransformer) Option {
+	return func(c *config) {
+		c.catalogTransformer = transformer
+	}
+}
+
+// WithUnrecognizedParameterWarnings configures the broker handler to add a
+// Warning header to responses to provision, update and bind requests with
+// parameters that are not declared in the properties of the plan's schema,
+// so that clients learn about typos. The request is still passed to the
+// broker. Plans without a schema declaring properties are not checked.
+func WithUnrecognizedParameterWarnings() Option {
+	return func(c *config) {
+		c.warnParameters = true
+	}
+}
+
+// WithUnbindMissingInstanceNotFound configures the unbind handler to
+// respond with a 404 Not Found when the broker returns a
+// ServiceInstanceNotFoundError, rather than the 410 Gone that the spec
+// requires when there is nothing to unbind. A missing binding is always
+// reported with a 410 Gone.
+func WithUnbindMissingInstanceNotFound() Option {
+	return func(c *config) {
+		c.unbindNotFound = true
+	}
+}
+
+// WithConcurrentOperationGuard configures the broker handler to reject
+// requests that update, bind, unbind or deprovision a service instance with
+// a 422 ConcurrencyError while the store given with WithOperationStore
+// records an operation on the instance as in progress, so that the broker
+// never starts two operations on one instance. NewBrokerHandler returns an
+// error if no operation store is configured.
+func WithConcurrentOperationGuard() Option {
+	return func(c *config) {
+		c.guardOperations = true
+	}
+}
+
+// WithProvisionRequestDebugging configures the broker handler to remember
+// the last successful provision request for each service instance, and to
+// return it, including its parameters, from GET requests to
+// /debug/service_instances/{instance_id}/provision_request. The requests
+// are kept in memory until the instance is deprovisioned. As parameters
+// may hold secrets, the endpoint only accepts the broker's credentials,
+// and it should not be enabled in production.
+func WithProvisionRequestDebugging() Option {
+	return func(c *config) {
+		c.debugProvisions = true
+	}
+}
+
+// WithCatalogCache configures the catalog handler to keep the catalog
+// returned by the broker for the given TTL, rather than asking the broker
+// for it on every request. Other handlers still read the catalog from the
+// broker.
+func WithCatalogCache(ttl time.Duration) Option {
+	return func(c *config) {
+		c.catalogTTL = ttl
+	}
+}
+
+// WithMetrics configures the broker handler to report counters to the
+// given Metrics, such as CatalogCacheHitCounter and
+// CatalogCacheMissCounter, so that operators can tune the catalog cache.
+func WithMetrics(metrics Metrics) Option {
+	return func(c *config) {
+		c.metrics = metrics
+	}
+}
+
+// WithOperationSigning configures the broker handler to sign the operation
+// data returned from asynchronous provision, update and bind requests with
+// an HMAC using the given key, and to reject requests to poll the last
+// operation with a 400 Bad Request when the operation's signature is
+// missing or does not match, so that clients cannot forge operations. The
+// broker only ever sees the operation data it returned. NewBrokerHandler
+// returns an error if the key is empty.
+func WithOperationSigning(key []byte) Option {
+	return func(c *config) {
+		c.signOperations = true
+		c.operationSigningKey = key
+	}
+}
+
+// WithUnknownOperationsFailed configures the broker handler to report an
+// operation that the broker does not recognize, signalled by returning a
+// domain.OperationNotFoundError from LastOperation, as a failed operation
+// rather than with a 404 Not Found. This stops clients from polling an
+// operation that was lost, such as when the broker restarted.
+func WithUnknownOperationsFailed() Option {
+	return func(c *config) {
+		c.failUnknownOps = true
+	}
+}
+
+// WithReplayProtection configures the broker handler to remember the
+// responses to mutating requests that completed within the window, keyed on
+// their method, path and X-Broker-API-Request-Identity, and to return the
+// prior response to a replay of the same request rather than passing it to
+// the broker again.
+// Requests without an identity, and requests that failed with a server
+// error, are always passed to the broker.
+func WithReplayProtection(window time.Duration) Option {
+	return func(c *config) {
+		c.replayWindow = window
+	}
+}
+
+// WithBodyRecording configures the broker handler to record the given
+// number of the most recent requests and the responses to them, including
+// their bodies, and to return them from GET requests to /debug/exchanges.
+// Binding credentials, and fields whose names mention a password, secret
+// or token, are redacted from JSON bodies. As the bodies may still hold
+// sensitive data, the endpoint only accepts the broker's credentials, and
+// it should not be enabled in production.
+func WithBodyRecording(size int) Option {
+	return func(c *config) {
+		c.recordedExchanges = size
+	}
+}
+
+// WithSameIDWarnings configures the bind and unbind handlers to add a
+// Warning header to the response when the binding_id is the same as the
+// instance_id. This is allowed by the spec, so the request is still served,
+// but it is more often the sign of a client bug.
+func WithSameIDWarnings() Option {
+	return func(c *config) {
+		c.warnSameIDs = true
+	}
+}
+
+// WithDeprovisionServiceValidation configures the deprovision handler to
+// look up the service instance with the broker's ServiceInstanceDetails
+// method, and to reject with a 400 Bad Request a request whose service_id
+// does not match the service the instance was provisioned with. The
+// plan_id is not checked, as it may be stale after a plan change.
+// NewBrokerHandler returns an error if the broker does not implement
+// ServiceInstanceDetailer.
+func WithDeprovisionServiceValidation() Option {
+	return func(c *config) {
+		c.checkDeprovisions = true
+	}
+}
+
+// WithSchemaSizeLimit configures NewBrokerHandler to return an error if
+// any plan in the catalog declares a schema that is larger than the limit,
+// in bytes, when written as JSON, so that a broker whose catalog would be
+// rejected by the platform fails when it starts.
+func WithSchemaSizeLimit(limit int) Option {
+	return func(c *config) {
+		c.schemaSizeLimit = limit
+	}
+}
+
+// WithRetryLogging configures the broker handler to log a line to the
+// Logger each time a request repeats the X-Broker-API-Request-Identity of
+// a request to the same method and path seen within the window, so that
+// operators can see how the platform retries requests. Identities
+// generated by WithRequestIdentity are never counted as retries. The
+// retry logger shares its store of identities with WithReplayProtection.
+// NewBrokerHandler returns an error if no Logger is configured.
+func WithRetryLogging(window time.Duration) Option {
+	return func(c *config) {
+		c.retryLogWindow = window
+	}
+}
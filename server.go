@@ -0,0 +1,235 @@
+package envoy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HealthPath is the path on which a Server reports its health. It responds
+// with a 200 OK while the server is accepting requests, and with a 503
+// Service Unavailable once the server has begun shutting down or when its
+// backend probe fails.
+const HealthPath = "/health"
+
+// BackendProber checks the connectivity of the backend of a service broker,
+// returning an error describing the failure when the backend is unreachable.
+type BackendProber interface {
+	BackendProbe() error
+}
+
+// OperationTracker reports how many asynchronous operations the broker is
+// still running in the background. The domain.MemoryOperationStore
+// implements it.
+type OperationTracker interface {
+	InProgress() int
+}
+
+// operationPollInterval is how often a Server that is shutting down checks
+// whether the tracked operations have finished.
+const operationPollInterval = 50 * time.Millisecond
+
+// Server serves a broker handler over HTTP, and supports shutting down
+// without dropping requests during a rolling deployment.
+type Server struct {
+	server     *http.Server
+	handler    http.Handler
+	drainDelay time.Duration
+	draining   int32
+
+	prober        BackendProber
+	probeInterval time.Duration
+	probeMutex    sync.Mutex
+	probedAt      time.Time
+	probeErr      error
+
+	operations     OperationTracker
+	operationGrace time.Duration
+}
+
+// ServerOption configures optional behavior of a Server.
+type ServerOption func(*Server)
+
+// WithReadTimeout configures the maximum amount of time that a Server will
+// spend reading a request, including its body, so that slow clients cannot
+// hold connections open indefinitely. By default, there is no limit.
+func WithReadTimeout(timeout time.Duration) ServerOption {
+	return func(s *Server) {
+		s.server.ReadTimeout = timeout
+	}
+}
+
+// WithWriteTimeout configures the maximum amount of time that a Server will
+// spend writing a response, measured from the end of reading the request
+// headers. By default, there is no limit.
+func WithWriteTimeout(timeout time.Duration) ServerOption {
+	return func(s *Server) {
+		s.server.WriteTimeout = timeout
+	}
+}
+
+// WithBackendProbe configures the health check to call the given prober, so
+// that it fails with a 503 Service Unavailable describing the error when the
+// backend is unreachable. The result of the probe is reused for the given
+// interval, so that frequent health checks do not overload the backend.
+func WithBackendProbe(prober BackendProber, interval time.Duration) ServerOption {
+	return func(s *Server) {
+		s.prober = prober
+		s.probeInterval = interval
+	}
+}
+
+// WithOperationGrace configures Shutdown to wait, once the server has
+// stopped serving requests, for up to the grace period for the operations
+// tracked by the given tracker to finish, so that asynchronous operations
+// running in the background are not cut off when the process exits.
+func WithOperationGrace(tracker OperationTracker, grace time.Duration) ServerOption {
+	return func(s *Server) {
+		s.operations = tracker
+		s.operationGrace = grace
+	}
+}
+
+// NewServer returns a Server that will listen on the given address and
+// serve the given handler. When the server is shut down, its health check
+// fails for the drain delay before it stops accepting connections, so that
+// a load balancer has time to stop routing requests to it.
+func NewServer(addr string, handler http.Handler, drainDelay time.Duration, options ...ServerOption) *Server {
+	s := &Server{
+		handler:    handler,
+		drainDelay: drainDelay,
+	}
+	s.server = &http.Server{
+		Addr:    addr,
+		Handler: s,
+	}
+
+	for _, option := range options {
+		option(s)
+	}
+
+	return s
+}
+
+// ServeHTTP serves the health check, and passes all other requests to the
+// underlying handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != HealthPath {
+		s.handler.ServeHTTP(w, req)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if s.Draining() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{}`))
+		return
+	}
+
+	if err := s.probe(); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(struct {
+			Description string `json:"description"`
+		}{err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{}`))
+}
+
+// probe calls the backend prober, if there is one, unless it was called
+// within the probe interval, in which case its last result is returned.
+func (s *Server) probe() error {
+	if s.prober == nil {
+		return nil
+	}
+
+	s.probeMutex.Lock()
+	defer s.probeMutex.Unlock()
+
+	if s.probedAt.IsZero() || time.Since(s.probedAt) >= s.probeInterval {
+		s.probeErr = s.prober.BackendProbe()
+		s.probedAt = time.Now()
+	}
+
+	return s.probeErr
+}
+
+// Draining reports whether the server has begun shutting down.
+func (s *Server) Draining() bool {
+	return atomic.LoadInt32(&s.draining) == 1
+}
+
+// ListenAndServe listens on the address of the server and serves requests
+// until it is shut down, at which point http.ErrServerClosed is returned.
+func (s *Server) ListenAndServe() error {
+	return s.server.ListenAndServe()
+}
+
+// Serve serves requests accepted from the given listener until the server
+// is shut down, at which point http.ErrServerClosed is returned.
+func (s *Server) Serve(listener net.Listener) error {
+	return s.server.Serve(listener)
+}
+
+// Shutdown fails the health check, waits for the drain delay, and then
+// gracefully stops the server, waiting for in-flight requests to complete,
+// and then for tracked operations when an operation grace period is
+// configured. If the context expires during the drain delay, the server is
+// closed immediately and the context error is returned. If it expires
+// later, its error is returned. An error is also returned if operations
+// are still in progress at the end of the grace period.
+func (s *Server) Shutdown(ctx context.Context) error {
+	atomic.StoreInt32(&s.draining, 1)
+
+	timer := time.NewTimer(s.drainDelay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		s.server.Close()
+		return ctx.Err()
+	}
+
+	if err := s.server.Shutdown(ctx); err != nil {
+		return err
+	}
+
+	return s.awaitOperations(ctx)
+}
+
+// awaitOperations waits for the tracked operations to finish, for up to the
+// operation grace period.
+func (s *Server) awaitOperations(ctx context.Context) error {
+	if s.operations == nil || s.operationGrace <= 0 {
+		return nil
+	}
+
+	grace := time.NewTimer(s.operationGrace)
+	defer grace.Stop()
+
+	ticker := time.NewTicker(operationPollInterval)
+	defer ticker.Stop()
+
+	for {
+		inProgress := s.operations.InProgress()
+		if inProgress == 0 {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-grace.C:
+			return fmt.Errorf("%d operations still in progress after the shutdown grace period", inProgress)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
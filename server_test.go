@@ -0,0 +1,245 @@
+package envoy_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/pivotal-cf-experimental/envoy"
+	"github.com/pivotal-cf-experimental/envoy/domain"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type TestBackendProber struct {
+	Err   error
+	Calls int
+}
+
+func (p *TestBackendProber) BackendProbe() error {
+	p.Calls++
+	return p.Err
+}
+
+var _ = Describe("Server", func() {
+	var server *envoy.Server
+	var listener net.Listener
+	var baseURL string
+	var release chan struct{}
+	var started chan struct{}
+
+	BeforeEach(func() {
+		var err error
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		baseURL = "http://" + listener.Addr().String()
+
+		release = make(chan struct{})
+		started = make(chan struct{})
+		handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			close(started)
+			<-release
+			w.WriteHeader(http.StatusTeapot)
+		})
+
+		server = envoy.NewServer("", handler, 200*time.Millisecond)
+		go server.Serve(listener)
+	})
+
+	AfterEach(func() {
+		listener.Close()
+	})
+
+	get := func(path string) int {
+		response, err := http.Get(baseURL + path)
+		Expect(err).NotTo(HaveOccurred())
+		defer response.Body.Close()
+
+		return response.StatusCode
+	}
+
+	It("reports healthy while serving", func() {
+		Expect(get(envoy.HealthPath)).To(Equal(http.StatusOK))
+		Expect(server.Draining()).To(BeFalse())
+	})
+
+	It("fails the health check while draining and completes in-flight requests", func() {
+		inFlight := make(chan int)
+		go func() {
+			defer GinkgoRecover()
+			inFlight <- get("/v2/catalog")
+		}()
+		<-started
+
+		shutdown := make(chan error)
+		go func() {
+			shutdown <- server.Shutdown(context.Background())
+		}()
+
+		Eventually(server.Draining).Should(BeTrue())
+		Expect(get(envoy.HealthPath)).To(Equal(http.StatusServiceUnavailable))
+
+		close(release)
+		Expect(<-inFlight).To(Equal(http.StatusTeapot))
+		Expect(<-shutdown).To(Succeed())
+	})
+
+	It("returns the context error when the context expires while draining", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		Expect(server.Shutdown(ctx)).To(MatchError(context.Canceled))
+		close(release)
+	})
+
+	It("stops serving when the context expires before the drain delay ends", func() {
+		closingListener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+
+		closing := envoy.NewServer("", http.NotFoundHandler(), time.Minute)
+		served := make(chan error, 1)
+		go func() {
+			served <- closing.Serve(closingListener)
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		Expect(closing.Shutdown(ctx)).To(MatchError(context.DeadlineExceeded))
+		Eventually(served).Should(Receive(Equal(http.ErrServerClosed)))
+
+		_, err = net.Dial("tcp", closingListener.Addr().String())
+		Expect(err).To(HaveOccurred())
+		close(release)
+	})
+
+	Context("when a read timeout is configured", func() {
+		var timeoutListener net.Listener
+
+		BeforeEach(func() {
+			var err error
+			timeoutListener, err = net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+
+			timeoutServer := envoy.NewServer("", http.NotFoundHandler(), 0,
+				envoy.WithReadTimeout(100*time.Millisecond),
+				envoy.WithWriteTimeout(time.Second))
+			go timeoutServer.Serve(timeoutListener)
+		})
+
+		AfterEach(func() {
+			timeoutListener.Close()
+		})
+
+		It("closes connections that do not finish sending a request in time", func() {
+			conn, err := net.Dial("tcp", timeoutListener.Addr().String())
+			Expect(err).NotTo(HaveOccurred())
+			defer conn.Close()
+
+			_, err = conn.Write([]byte("GET /v2/catalog HTTP/1.1\r\nHost: example.com\r\n"))
+			Expect(err).NotTo(HaveOccurred())
+
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			start := time.Now()
+			_, err = ioutil.ReadAll(conn)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(time.Since(start)).To(BeNumerically("<", 2*time.Second))
+		})
+	})
+
+	Context("when an operation grace period is configured", func() {
+		var store *domain.MemoryOperationStore
+
+		BeforeEach(func() {
+			store = domain.NewMemoryOperationStore()
+			Expect(store.Create("instance-id", domain.OperationRecord{ID: "op-1", State: domain.LastOperationInProgress})).To(Succeed())
+		})
+
+		It("waits for an in-flight asynchronous operation to finish before returning", func() {
+			graceful := envoy.NewServer("", http.NotFoundHandler(), 0, envoy.WithOperationGrace(store, 5*time.Second))
+
+			shutdown := make(chan error, 1)
+			go func() {
+				shutdown <- graceful.Shutdown(context.Background())
+			}()
+
+			Consistently(shutdown, 200*time.Millisecond).ShouldNot(Receive())
+
+			Expect(store.Update("instance-id", domain.OperationRecord{ID: "op-1", State: domain.LastOperationSucceeded})).To(Succeed())
+			Eventually(shutdown).Should(Receive(BeNil()))
+		})
+
+		It("returns an error when the operation is still in progress after the grace period", func() {
+			graceful := envoy.NewServer("", http.NotFoundHandler(), 0, envoy.WithOperationGrace(store, 100*time.Millisecond))
+
+			Expect(graceful.Shutdown(context.Background())).To(MatchError("1 operations still in progress after the shutdown grace period"))
+		})
+
+		It("returns the context error when the context expires while waiting", func() {
+			graceful := envoy.NewServer("", http.NotFoundHandler(), 0, envoy.WithOperationGrace(store, 5*time.Second))
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			Expect(graceful.Shutdown(ctx)).To(MatchError(context.DeadlineExceeded))
+		})
+	})
+
+	Context("when a backend probe is configured", func() {
+		var prober *TestBackendProber
+
+		BeforeEach(func() {
+			prober = &TestBackendProber{}
+		})
+
+		check := func(s *envoy.Server) *httptest.ResponseRecorder {
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, httptest.NewRequest("GET", envoy.HealthPath, nil))
+			return recorder
+		}
+
+		It("reports healthy when the backend is reachable", func() {
+			probed := envoy.NewServer("", http.NotFoundHandler(), 0, envoy.WithBackendProbe(prober, 0))
+
+			recorder := check(probed)
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Body.String()).To(MatchJSON(`{}`))
+			Expect(prober.Calls).To(Equal(1))
+		})
+
+		It("reports unhealthy with a description when the backend is unreachable", func() {
+			prober.Err = errors.New("database is unreachable")
+			probed := envoy.NewServer("", http.NotFoundHandler(), 0, envoy.WithBackendProbe(prober, 0))
+
+			recorder := check(probed)
+			Expect(recorder.Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(recorder.Body.String()).To(MatchJSON(`{"description": "database is unreachable"}`))
+		})
+
+		It("reuses the result of the probe within the interval", func() {
+			prober.Err = errors.New("database is unreachable")
+			probed := envoy.NewServer("", http.NotFoundHandler(), 0, envoy.WithBackendProbe(prober, time.Hour))
+
+			Expect(check(probed).Code).To(Equal(http.StatusServiceUnavailable))
+
+			prober.Err = nil
+			Expect(check(probed).Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(prober.Calls).To(Equal(1))
+		})
+
+		It("probes again once the interval has passed", func() {
+			probed := envoy.NewServer("", http.NotFoundHandler(), 0, envoy.WithBackendProbe(prober, 10*time.Millisecond))
+
+			Expect(check(probed).Code).To(Equal(http.StatusOK))
+
+			prober.Err = errors.New("database is unreachable")
+			Eventually(func() int { return check(probed).Code }).Should(Equal(http.StatusServiceUnavailable))
+			Expect(prober.Calls).To(BeNumerically(">", 1))
+		})
+	})
+})